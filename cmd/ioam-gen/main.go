@@ -0,0 +1,387 @@
+// Command ioam-gen writes synthetic IOAM packets to a pcap file or sends
+// them on an interface, to test the agent and the collector without a
+// kernel configured for IOAM.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+)
+
+// Options generated with -option
+const (
+	OptionPrealloc    = "prealloc"
+	OptionIncremental = "incremental"
+	OptionE2E         = "e2e"
+	OptionDEX         = "dex"
+)
+
+type Config struct {
+	Output   string
+	Iface    string
+	Count    uint
+	Interval time.Duration
+
+	Option    string
+	Namespace uint
+	Type      uint
+	Nodes     uint
+	RemLen    uint
+	Overflow  bool
+	Loopback  bool
+	Active    bool
+
+	HopLimit        uint
+	NodeID          uint64
+	IngressID       uint
+	EgressID        uint
+	HopDelay        time.Duration
+	TransitDelay    time.Duration
+	TimestampFormat string
+	QueueDepth      uint
+	BufferOccupancy uint
+	NamespaceData   []byte
+	NamespaceDataW  []byte
+	OSSSchema       uint
+	OSSData         []byte
+	CsumMismatch    uint // Node whose Checksum Complement is wrong, from 1
+
+	E2EType   uint
+	DEXFlowID uint
+
+	Src, Dst     net.IP
+	SrcMAC       net.HardwareAddr
+	DstMAC       net.HardwareAddr
+	SPort, DPort uint
+	Payload      uint
+}
+
+func parseFlags() *Config {
+	cfg := &Config{}
+	flag.StringVar(&cfg.Output, "w", "", "Write the packets to a pcap file")
+	flag.StringVar(&cfg.Iface, "i", "", "Send the packets on an interface")
+	flag.UintVar(&cfg.Count, "c", 1, "Number of packets")
+	flag.DurationVar(&cfg.Interval, "interval", 0, "Interval between packets")
+
+	flag.StringVar(&cfg.Option, "option", OptionPrealloc, "IOAM option: prealloc, incremental, e2e or dex")
+	flag.UintVar(&cfg.Namespace, "ns", 123, "IOAM namespace")
+	flag.UintVar(&cfg.Type, "type", 0xf6e002, "IOAM-Trace-Type (24 bits, e.g. 0xf6e002)")
+	flag.UintVar(&cfg.Nodes, "nodes", 3, "Number of nodes in the trace")
+	flag.UintVar(&cfg.RemLen, "remlen", 0, "Free space left in the trace, in 4-octet units")
+	flag.BoolVar(&cfg.Overflow, "overflow", false, "Set the overflow flag")
+	flag.BoolVar(&cfg.Loopback, "loopback", false, "Set the loopback flag")
+	flag.BoolVar(&cfg.Active, "active", false, "Set the active flag")
+
+	flag.UintVar(&cfg.HopLimit, "hop-limit", 64, "Hop limit of the first node, decremented at every node")
+	flag.Uint64Var(&cfg.NodeID, "node-id", 1, "ID of the first node, incremented at every node")
+	flag.UintVar(&cfg.IngressID, "ingress-id", 1, "Ingress interface ID of every node")
+	flag.UintVar(&cfg.EgressID, "egress-id", 2, "Egress interface ID of every node")
+	flag.DurationVar(&cfg.HopDelay, "hop-delay", 100*time.Microsecond, "Delay between the timestamps of two consecutive nodes")
+	flag.DurationVar(&cfg.TransitDelay, "transit-delay", 10*time.Microsecond, "Transit delay of every node")
+	flag.StringVar(&cfg.TimestampFormat, "timestamp-format", config.TimestampPOSIX, "Timestamp format: posix, ptp or ntp")
+	flag.UintVar(&cfg.QueueDepth, "queue-depth", 0, "Queue depth of every node")
+	flag.UintVar(&cfg.BufferOccupancy, "buffer-occupancy", 0, "Buffer occupancy of every node")
+	flag.Func("namespace-data", "Namespace specific data of every node (hex, 4 octets)", hexFlag(&cfg.NamespaceData))
+	flag.Func("namespace-data-wide", "Wide namespace specific data of every node (hex, 8 octets)", hexFlag(&cfg.NamespaceDataW))
+	flag.UintVar(&cfg.OSSSchema, "oss-schema", 0, "Opaque state schema ID of every node")
+	flag.Func("oss-data", "Opaque state data of every node (hex, multiple of 4 octets)", hexFlag(&cfg.OSSData))
+	flag.UintVar(&cfg.CsumMismatch, "csum-mismatch", 0, "Node (from 1) whose Checksum Complement does not match its data, 0 for none")
+
+	flag.UintVar(&cfg.E2EType, "e2e-type", uint(ioam.E2ESequence64|ioam.E2ETimestampSecs|ioam.E2ETimestampFrac), "IOAM-E2E-Type (16 bits)")
+	flag.UintVar(&cfg.DEXFlowID, "dex-flow-id", 0, "Flow ID of the direct export option (0 omits it)")
+
+	src := flag.String("src", "2001:db8::1", "Source address")
+	dst := flag.String("dst", "2001:db8::2", "Destination address")
+	srcMAC := flag.String("src-mac", "02:00:00:00:00:01", "Source MAC address")
+	dstMAC := flag.String("dst-mac", "02:00:00:00:00:02", "Destination MAC address")
+	flag.UintVar(&cfg.SPort, "sport", 12345, "UDP source port")
+	flag.UintVar(&cfg.DPort, "dport", 9, "UDP destination port")
+	flag.UintVar(&cfg.Payload, "payload", 64, "UDP payload size")
+	flag.Parse()
+
+	if (cfg.Output == "") == (cfg.Iface == "") {
+		log.Println("[IOAM Gen] Exactly one of -w and -i is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	if cfg.Src = net.ParseIP(*src); cfg.Src == nil || cfg.Src.To4() != nil {
+		log.Fatalf("[IOAM Gen] Invalid IPv6 source address: %s", *src)
+	}
+	if cfg.Dst = net.ParseIP(*dst); cfg.Dst == nil || cfg.Dst.To4() != nil {
+		log.Fatalf("[IOAM Gen] Invalid IPv6 destination address: %s", *dst)
+	}
+	if cfg.SrcMAC, err = net.ParseMAC(*srcMAC); err != nil {
+		log.Fatalf("[IOAM Gen] Invalid source MAC address: %v", err)
+	}
+	if cfg.DstMAC, err = net.ParseMAC(*dstMAC); err != nil {
+		log.Fatalf("[IOAM Gen] Invalid destination MAC address: %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("[IOAM Gen] %v", err)
+	}
+
+	return cfg
+}
+
+func hexFlag(dst *[]byte) func(string) error {
+	return func(s string) error {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		*dst = b
+		return nil
+	}
+}
+
+func (cfg *Config) validate() error {
+	switch cfg.Option {
+	case OptionPrealloc, OptionIncremental, OptionE2E, OptionDEX:
+	default:
+		return fmt.Errorf("Unknown option %q", cfg.Option)
+	}
+	switch cfg.TimestampFormat {
+	case config.TimestampPOSIX, config.TimestampPTP, config.TimestampNTP:
+	default:
+		return fmt.Errorf("Unknown timestamp format %q", cfg.TimestampFormat)
+	}
+	if cfg.Namespace > 0xFFFF {
+		return fmt.Errorf("Namespace %d does not fit in 16 bits", cfg.Namespace)
+	}
+	if cfg.Type > 0xFFFFFF {
+		return fmt.Errorf("Trace type %#x does not fit in 24 bits", cfg.Type)
+	}
+	if cfg.E2EType > 0xFFFF {
+		return fmt.Errorf("E2E type %#x does not fit in 16 bits", cfg.E2EType)
+	}
+	if cfg.HopLimit > ioam.MaxHopLimit {
+		return fmt.Errorf("Hop limit %d does not fit in 8 bits", cfg.HopLimit)
+	}
+	if cfg.IngressID > 0xFFFF || cfg.EgressID > 0xFFFF {
+		return fmt.Errorf("Interface IDs must fit in 16 bits")
+	}
+	if cfg.OSSSchema > ioam.MaxSchemaID {
+		return fmt.Errorf("Schema ID %d does not fit in 24 bits", cfg.OSSSchema)
+	}
+	if len(cfg.OSSData)%4 != 0 {
+		return fmt.Errorf("Opaque state data must be a multiple of 4 octets")
+	}
+	return nil
+}
+
+func main() {
+	cfg := parseFlags()
+
+	var write func([]byte) error
+	var closeFunc func() error
+
+	if cfg.Output != "" {
+		f, err := os.Create(cfg.Output)
+		if err != nil {
+			log.Fatalf("[IOAM Gen] Couldn't create %s: %v", cfg.Output, err)
+		}
+		w := pcapgo.NewWriter(f)
+		if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+			log.Fatalf("[IOAM Gen] Couldn't write pcap header: %v", err)
+		}
+		write = func(data []byte) error {
+			return w.WritePacket(gopacket.CaptureInfo{
+				Timestamp:     time.Now(),
+				CaptureLength: len(data),
+				Length:        len(data),
+			}, data)
+		}
+		closeFunc = f.Close
+	} else {
+		handle, err := pcap.OpenLive(cfg.Iface, 65535, false, pcap.BlockForever)
+		if err != nil {
+			log.Fatalf("[IOAM Gen] Couldn't open device %s: %v", cfg.Iface, err)
+		}
+		write = handle.WritePacketData
+		closeFunc = func() error { handle.Close(); return nil }
+	}
+
+	for seq := uint(0); seq < cfg.Count; seq++ {
+		if seq > 0 && cfg.Interval > 0 {
+			time.Sleep(cfg.Interval)
+		}
+		data, err := cfg.packet(uint32(seq), time.Now())
+		if err != nil {
+			log.Fatalf("[IOAM Gen] Couldn't build packet: %v", err)
+		}
+		if err := write(data); err != nil {
+			log.Fatalf("[IOAM Gen] Couldn't write packet: %v", err)
+		}
+	}
+
+	if err := closeFunc(); err != nil {
+		log.Fatalf("[IOAM Gen] %v", err)
+	}
+	log.Printf("[IOAM Gen] %d packets written", cfg.Count)
+}
+
+// packet builds an Ethernet/IPv6/UDP packet carrying the IOAM option in a
+// Hop-by-Hop Options header.
+func (cfg *Config) packet(seq uint32, now time.Time) ([]byte, error) {
+	optType, data, err := cfg.option(seq, now)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := ioam.AppendOption(nil, ioam.IPv6OptionHopByHop, optType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := &layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolIPv6HopByHop,
+		HopLimit:   64,
+		SrcIP:      cfg.Src,
+		DstIP:      cfg.Dst,
+	}
+	udp := &layers.UDP{
+		SrcPort: layers.UDPPort(cfg.SPort),
+		DstPort: layers.UDPPort(cfg.DPort),
+	}
+	// The checksum is computed with the pseudo-header of the IPv6 layer
+	udp.SetNetworkLayerForChecksum(ip)
+
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, opts, udp, gopacket.Payload(make([]byte, cfg.Payload))); err != nil {
+		return nil, err
+	}
+
+	hbh, err := ioam.AppendOptionsHeader(nil, uint8(layers.IPProtocolUDP), opt)
+	if err != nil {
+		return nil, err
+	}
+
+	eth := &layers.Ethernet{
+		SrcMAC:       cfg.SrcMAC,
+		DstMAC:       cfg.DstMAC,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	pkt := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(pkt, opts, eth, ip, gopacket.Payload(append(hbh, buf.Bytes()...))); err != nil {
+		return nil, err
+	}
+	return pkt.Bytes(), nil
+}
+
+// option returns the type and data of the IOAM option of the packet.
+func (cfg *Config) option(seq uint32, now time.Time) (ioam.OptionType, []byte, error) {
+	switch cfg.Option {
+	case OptionE2E:
+		secs, frac := cfg.timestamp(now)
+		return ioam.OptionE2E, ioam.AppendE2E(nil, &ioam.E2E{
+			Namespace:     uint16(cfg.Namespace),
+			Type:          ioam.E2EType(cfg.E2EType),
+			Sequence64:    uint64(seq),
+			Sequence32:    seq,
+			TimestampSecs: secs,
+			TimestampFrac: frac,
+		}), nil
+	case OptionDEX:
+		dex := &ioam.DEX{
+			Namespace:      uint16(cfg.Namespace),
+			ExtensionFlags: ioam.DEXSequence,
+			Type:           ioam.TraceType(cfg.Type),
+			FlowID:         uint32(cfg.DEXFlowID),
+			Sequence:       seq,
+		}
+		if cfg.DEXFlowID != 0 {
+			dex.ExtensionFlags |= ioam.DEXFlowID
+		}
+		return ioam.OptionDEX, ioam.AppendDEX(nil, dex), nil
+	}
+
+	optType := ioam.OptionPreallocatedTrace
+	if cfg.Option == OptionIncremental {
+		optType = ioam.OptionIncrementalTrace
+	}
+	data, err := cfg.trace(now)
+	return optType, data, err
+}
+
+// trace returns the data of a trace option filled by cfg.Nodes nodes, the
+// first one at now.
+func (cfg *Config) trace(now time.Time) ([]byte, error) {
+	trace := &ioam.Trace{
+		Namespace: uint16(cfg.Namespace),
+		RemLen:    uint8(cfg.RemLen),
+		Type:      ioam.TraceType(cfg.Type),
+		Nodes:     make([]ioam.Node, cfg.Nodes),
+	}
+	if cfg.Overflow {
+		trace.Flags |= ioam.FlagOverflow
+	}
+	if cfg.Loopback {
+		trace.Flags |= ioam.FlagLoopback
+	}
+	if cfg.Active {
+		trace.Flags |= ioam.FlagActive
+	}
+
+	for i := range trace.Nodes {
+		secs, frac := cfg.timestamp(now.Add(time.Duration(i) * cfg.HopDelay))
+		node := &trace.Nodes[i]
+		*node = ioam.Node{
+			HopLimit:          uint8(cfg.HopLimit - uint(i)),
+			ID:                uint32(cfg.NodeID+uint64(i)) & ioam.MaxNodeID,
+			IngressID:         uint16(cfg.IngressID),
+			EgressID:          uint16(cfg.EgressID),
+			TimestampSecs:     secs,
+			TimestampFrac:     frac,
+			TransitDelay:      uint32(cfg.TransitDelay.Nanoseconds()),
+			NamespaceData:     cfg.NamespaceData,
+			QueueDepth:        uint32(cfg.QueueDepth),
+			IDWide:            (cfg.NodeID + uint64(i)) & ioam.MaxNodeIDWide,
+			IngressIDWide:     uint32(cfg.IngressID),
+			EgressIDWide:      uint32(cfg.EgressID),
+			NamespaceDataWide: cfg.NamespaceDataW,
+			BufferOccupancy:   uint32(cfg.BufferOccupancy),
+		}
+		if trace.Type&ioam.TraceTypeOSS != 0 && len(cfg.OSSData) > 0 {
+			node.OSS = &ioam.OSS{SchemaID: uint32(cfg.OSSSchema), Data: cfg.OSSData}
+		}
+		if trace.Type&ioam.TraceTypeChecksumComplement != 0 {
+			node.SetChecksumComplement(trace.Type)
+			if uint(i+1) == cfg.CsumMismatch {
+				// One more than the right value, never 0 in one's complement
+				comp := ioam.Checksum(uint16(node.ChecksumComplement>>16), []byte{0, 1})
+				node.ChecksumComplement = uint32(comp)<<16 | node.ChecksumComplement&0xFFFF
+			}
+		}
+	}
+
+	return ioam.AppendTrace(nil, trace)
+}
+
+// timestamp returns the seconds and fraction of t in the configured format.
+func (cfg *Config) timestamp(t time.Time) (uint32, uint32) {
+	switch cfg.TimestampFormat {
+	case config.TimestampPTP:
+		return uint32(t.Unix()), uint32(t.Nanosecond())
+	case config.TimestampNTP:
+		const ntpEpochOffset = 2208988800
+		return uint32(t.Unix() + ntpEpochOffset), uint32((uint64(t.Nanosecond()) << 32) / 1e9)
+	default:
+		return uint32(t.Unix()), uint32(t.Nanosecond() / 1e3)
+	}
+}
@@ -3,15 +3,21 @@ module github.com/Advanced-Observability/ioam-agent
 go 1.25.6
 
 require (
+	github.com/Advanced-Observability/ioam-agent/pkg/ioam v0.0.0
 	github.com/Advanced-Observability/ioam-api v0.0.0-20260204130817-42dd1e6ec517
 	github.com/google/gopacket v1.1.19
+	golang.org/x/sys v0.38.0
 	google.golang.org/grpc v1.78.0
+	google.golang.org/protobuf v1.36.11
 )
 
 require (
 	golang.org/x/net v0.47.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251029180050-ab9386a59fda // indirect
-	google.golang.org/protobuf v1.36.11 // indirect
+)
+
+replace (
+	github.com/Advanced-Observability/ioam-agent/pkg/ioam => ./pkg/ioam
+	github.com/Advanced-Observability/ioam-api => ./ioam-api
 )
@@ -0,0 +1,279 @@
+package aggregate
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+const (
+	FieldHopDelay = "hop_delay_ns" // Delay from the previous node
+
+	maxSamples = 1024 // Per field, for the percentiles (reservoir sampling)
+	maxGroups  = 4096 // Per window, the traces of the other groups are reported as is
+)
+
+type fieldStats struct {
+	min, max int64
+	sum      float64
+	count    uint64
+	samples  []int64
+}
+
+func (fs *fieldStats) add(v int64) {
+	if fs.count == 0 || v < fs.min {
+		fs.min = v
+	}
+	if fs.count == 0 || v > fs.max {
+		fs.max = v
+	}
+	fs.sum += float64(v)
+	fs.count++
+
+	if len(fs.samples) < maxSamples {
+		fs.samples = append(fs.samples, v)
+	} else if i := rand.Uint64N(fs.count); i < maxSamples {
+		fs.samples[i] = v
+	}
+}
+
+func (fs *fieldStats) summary(name string) *ioamAPI.FieldSummary {
+	sort.Slice(fs.samples, func(i, j int) bool { return fs.samples[i] < fs.samples[j] })
+	return &ioamAPI.FieldSummary{
+		Name: name,
+		Min:  fs.min,
+		Max:  fs.max,
+		Avg:  fs.sum / float64(fs.count),
+		P50:  percentile(fs.samples, 50),
+		P90:  percentile(fs.samples, 90),
+		P99:  percentile(fs.samples, 99),
+	}
+}
+
+type group struct {
+	trace   *report.Trace // First trace of the group, reported with the summary
+	packets uint64
+	nodes   []map[string]*fieldStats
+}
+
+func (g *group) add(trace *report.Trace) {
+	g.packets++
+	for i, node := range trace.GetNodes() {
+		if i >= len(g.nodes) {
+			break
+		}
+		for name, v := range nodeFields(trace, i, node) {
+			fs, ok := g.nodes[i][name]
+			if !ok {
+				fs = &fieldStats{}
+				g.nodes[i][name] = fs
+			}
+			fs.add(v)
+		}
+	}
+}
+
+// Aggregator groups the traces by namespace, path, addresses and upper-layer
+// protocol over a window and reports one summary per group instead of every
+// trace.
+type Aggregator struct {
+	window time.Duration
+	sample uint64
+	emit   func(*report.Trace)
+	count  uint64
+	done   chan struct{}
+	closed sync.Once
+
+	mu       sync.Mutex
+	start    time.Time
+	groups   map[string]*group
+	overflow uint64 // Traces reported as is, beyond maxGroups
+}
+
+// New creates an aggregator reporting the summaries to emit at the end of
+// every window. If sample is not zero, one in sample traces is also
+// reported as is.
+func New(window time.Duration, sample uint64, emit func(*report.Trace)) *Aggregator {
+	a := &Aggregator{
+		window: window,
+		sample: sample,
+		emit:   emit,
+		start:  time.Now(),
+		groups: make(map[string]*group),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.flush()
+			case <-a.done:
+				return
+			}
+		}
+	}()
+	return a
+}
+
+// Close reports the summaries of the current window, which is cut short.
+// The aggregator must not be used afterwards; only the first call has an
+// effect.
+func (a *Aggregator) Close() {
+	a.closed.Do(func() {
+		close(a.done)
+		a.flush()
+	})
+}
+
+// Add accounts the trace in its group.
+func (a *Aggregator) Add(trace *report.Trace) {
+	key := groupKey(trace)
+
+	a.mu.Lock()
+	g, ok := a.groups[key]
+	if !ok && len(a.groups) >= maxGroups {
+		a.overflow++
+		a.mu.Unlock()
+		a.emit(trace)
+		return
+	}
+	if !ok {
+		trace.Retain()
+		g = &group{trace: trace, nodes: make([]map[string]*fieldStats, len(trace.GetNodes()))}
+		for i := range g.nodes {
+			g.nodes[i] = make(map[string]*fieldStats)
+		}
+		a.groups[key] = g
+	}
+	g.add(trace)
+	a.mu.Unlock()
+
+	if a.sample > 0 && atomic.AddUint64(&a.count, 1)%a.sample == 0 {
+		a.emit(trace)
+	}
+}
+
+func (a *Aggregator) flush() {
+	now := time.Now()
+
+	a.mu.Lock()
+	groups, start, overflow := a.groups, a.start, a.overflow
+	a.groups = make(map[string]*group)
+	a.start = now
+	a.overflow = 0
+	a.mu.Unlock()
+
+	if overflow > 0 {
+		log.Printf("[IOAM Agent] More than %d groups of traces in the aggregation window, %d traces reported as is", maxGroups, overflow)
+	}
+
+	for _, g := range groups {
+		summary := &ioamAPI.Summary{
+			Packets: g.packets,
+			Start:   uint64(start.UnixNano()),
+			End:     uint64(now.UnixNano()),
+			Nodes:   make([]*ioamAPI.NodeSummary, len(g.nodes)),
+		}
+		for i, fields := range g.nodes {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			ns := &ioamAPI.NodeSummary{}
+			for _, name := range names {
+				ns.Fields = append(ns.Fields, fields[name].summary(name))
+			}
+			summary.Nodes[i] = ns
+		}
+
+		// The summary is attached to a copy so that the sampled trace
+		// possibly reported as is keeps its original form.
+		trace := *g.trace
+		trace.IOAMTrace = &ioamAPI.IOAMTrace{
+			NamespaceId: g.trace.GetNamespaceId(),
+			BitField:    g.trace.GetBitField(),
+			Nodes:       g.trace.GetNodes(),
+			Flow:        groupFlow(g.trace.GetFlow()),
+			Summary:     summary,
+		}
+		a.emit(&trace)
+	}
+}
+
+// nodeFields returns the numeric fields of the i-th node of the trace that
+// are aggregated.
+func nodeFields(trace *report.Trace, i int, node *ioamAPI.IOAMNode) map[string]int64 {
+	fields := make(map[string]int64)
+	traceType := ioam.TraceType(trace.GetBitField())
+
+	if traceType.Has(ioam.TraceTypeTransitDelay) {
+		fields[config.FieldTransitDelay] = int64(node.GetTransitDelay() & 0x7FFFFFFF)
+	}
+	if traceType.Has(ioam.TraceTypeQueueDepth) {
+		fields[config.FieldQueueDepth] = int64(node.GetQueueDepth())
+	}
+	if traceType.Has(ioam.TraceTypeBufferOccupancy) {
+		fields[config.FieldBufferOccupancy] = int64(node.GetBufferOccupancy())
+	}
+	if trace.Delays != nil && i > 0 && i <= len(trace.Delays.Hops) {
+		fields[FieldHopDelay] = trace.Delays.Hops[i-1].Nanoseconds()
+	}
+
+	return fields
+}
+
+// groupKey identifies the group of the trace. The ports are left out so
+// that the number of groups does not grow with the number of connections.
+func groupKey(trace *report.Trace) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d/%06x|", trace.GetNamespaceId(), trace.GetBitField())
+	for _, node := range trace.GetNodes() {
+		ingress, egress := trace.Interfaces(node)
+		fmt.Fprintf(&b, "%d(%d/%d)", trace.NodeID(node), ingress, egress)
+	}
+	if flow := trace.InnerFlow(); flow != nil {
+		fmt.Fprintf(&b, "|%s %s %d", net.IP(flow.GetSrcAddr()), net.IP(flow.GetDstAddr()), flow.GetNextHeader())
+	}
+	return b.String()
+}
+
+// groupFlow returns a copy of the flow of the first trace of a group
+// without the ports and flow labels, which may differ in the group.
+func groupFlow(flow *ioamAPI.Flow) *ioamAPI.Flow {
+	if flow == nil {
+		return nil
+	}
+	return &ioamAPI.Flow{
+		SrcAddr:    flow.GetSrcAddr(),
+		DstAddr:    flow.GetDstAddr(),
+		NextHeader: flow.GetNextHeader(),
+		Inner:      groupFlow(flow.GetInner()),
+	}
+}
+
+// percentile returns the p-th percentile (nearest rank) of sorted values.
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
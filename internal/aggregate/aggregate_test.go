@@ -0,0 +1,143 @@
+package aggregate
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func flowTrace(dst string, port uint32, depths ...uint32) *report.Trace {
+	trace := &ioamAPI.IOAMTrace{
+		NamespaceId: 1,
+		BitField:    uint32(ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeQueueDepth),
+		Flow: &ioamAPI.Flow{
+			SrcAddr: net.ParseIP("2001:db8::1"), DstAddr: net.ParseIP(dst),
+			NextHeader: 17, SrcPort: port, DstPort: 53, FlowLabel: port,
+		},
+	}
+	for i, depth := range depths {
+		trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: uint32(i + 1), QueueDepth: depth})
+	}
+	return &report.Trace{IOAMTrace: trace}
+}
+
+func TestWindow(t *testing.T) {
+	var emitted []*report.Trace
+	a := New(time.Hour, 0, func(trace *report.Trace) { emitted = append(emitted, trace) })
+
+	// Two groups: the ports are not part of the key
+	for i := range 10 {
+		a.Add(flowTrace("2001:db8::2", uint32(1000+i), uint32(i), 100))
+	}
+	a.Add(flowTrace("2001:db8::3", 1000, 5, 5))
+	if len(emitted) != 0 {
+		t.Fatalf("%d traces reported before the end of the window", len(emitted))
+	}
+
+	a.Close()
+	if len(emitted) != 2 {
+		t.Fatalf("%d summaries, want 2", len(emitted))
+	}
+	for _, trace := range emitted {
+		summary := trace.GetSummary()
+		if summary == nil || summary.GetEnd() < summary.GetStart() || len(summary.GetNodes()) != 2 {
+			t.Fatalf("summary %v", summary)
+		}
+		if flow := trace.GetFlow(); flow.GetSrcPort() != 0 || flow.GetDstPort() != 0 || flow.GetFlowLabel() != 0 || flow.GetNextHeader() != 17 {
+			t.Errorf("flow %v of the summary, want no ports", flow)
+		}
+		if net.IP(trace.GetFlow().GetDstAddr()).String() != "2001:db8::2" {
+			continue
+		}
+		if summary.GetPackets() != 10 {
+			t.Errorf("%d packets, want 10", summary.GetPackets())
+		}
+		fields := summary.GetNodes()[0].GetFields()
+		if len(fields) != 1 || fields[0].GetName() != config.FieldQueueDepth {
+			t.Fatalf("fields %v, want %s", fields, config.FieldQueueDepth)
+		}
+		if f := fields[0]; f.GetMin() != 0 || f.GetMax() != 9 || f.GetAvg() != 4.5 || f.GetP50() != 4 || f.GetP90() != 8 {
+			t.Errorf("summary %v", f)
+		}
+	}
+
+	// Only the first call reports
+	a.Close()
+	if len(emitted) != 2 {
+		t.Errorf("%d summaries after a second Close", len(emitted))
+	}
+}
+
+func TestSample(t *testing.T) {
+	var emitted []*report.Trace
+	a := New(time.Hour, 3, func(trace *report.Trace) { emitted = append(emitted, trace) })
+	defer a.Close()
+
+	for i := range 10 {
+		a.Add(flowTrace("2001:db8::2", uint32(i), 1))
+	}
+	if len(emitted) != 3 {
+		t.Fatalf("%d traces reported as is, want 3", len(emitted))
+	}
+	for _, trace := range emitted {
+		if trace.GetSummary() != nil {
+			t.Errorf("sampled trace with a summary")
+		}
+	}
+}
+
+func TestMaxGroups(t *testing.T) {
+	var emitted []*report.Trace
+	a := New(time.Hour, 0, func(trace *report.Trace) { emitted = append(emitted, trace) })
+
+	for i := range maxGroups + 5 {
+		ip := net.ParseIP("2001:db8::")
+		ip[14], ip[15] = byte(i>>8), byte(i)
+		a.Add(flowTrace(ip.String(), 1000, 1))
+	}
+	if len(emitted) != 5 {
+		t.Fatalf("%d traces reported as is, want 5", len(emitted))
+	}
+	a.Close()
+	if len(emitted) != maxGroups+5 {
+		t.Errorf("%d traces and summaries, want %d", len(emitted), maxGroups+5)
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var fs fieldStats
+	for v := range int64(100 * 100) {
+		fs.add(v % 100)
+	}
+	if len(fs.samples) != maxSamples {
+		t.Fatalf("%d samples kept, want %d", len(fs.samples), maxSamples)
+	}
+	s := fs.summary("f")
+	if s.GetMin() != 0 || s.GetMax() != 99 || s.GetAvg() != 49.5 {
+		t.Errorf("min %d, max %d, avg %f", s.GetMin(), s.GetMax(), s.GetAvg())
+	}
+	// The reservoir is a sample: allow some error
+	for _, p := range []struct{ got, want int64 }{{s.GetP50(), 50}, {s.GetP90(), 90}, {s.GetP99(), 99}} {
+		if p.got < p.want-10 || p.got > p.want+10 {
+			t.Errorf("percentile %d, want about %d", p.got, p.want)
+		}
+	}
+
+	sorted := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, p := range []struct {
+		p    int
+		want int64
+	}{{1, 1}, {50, 5}, {90, 9}, {99, 10}, {100, 10}} {
+		if got := percentile(sorted, p.p); got != p.want {
+			t.Errorf("percentile(%d) = %d, want %d", p.p, got, p.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no values = %d", got)
+	}
+}
@@ -0,0 +1,270 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+const (
+	queueSize    = 64               // Alerts waiting to be delivered to the sinks
+	numShards    = 16               // The states are sharded by key so that workers rarely contend
+	tickInterval = 10 * time.Second // Between two re-evaluations of the states
+	staleAfter   = time.Minute      // States of the nodes absent from the traces for that long are dropped
+)
+
+// Alert states
+const (
+	Firing   = "firing"
+	Resolved = "resolved"
+)
+
+// Alert is a notification that a rule fired or was resolved for a node.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	State     string    `json:"state"`
+	Namespace uint32    `json:"namespace"`
+	Node      uint64    `json:"node"`
+	Field     string    `json:"field"`
+	Value     uint32    `json:"value"`
+	Threshold uint32    `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+type key struct {
+	rule      int
+	namespace uint32
+	node      uint64
+}
+
+// shard returns the index of the shard holding the state of the key.
+func (k key) shard() int {
+	h := (k.node ^ uint64(k.namespace)<<32 ^ uint64(k.rule)) * 0x9E3779B97F4A7C15
+	return int(h>>32) % numShards
+}
+
+type state struct {
+	since    time.Time // When the value went above the threshold, zero if below
+	firing   bool
+	value    uint32    // Last value
+	lastSeen time.Time // When the last value was received
+}
+
+type shard struct {
+	mu     sync.Mutex
+	states map[key]*state
+}
+
+// Evaluator checks the alert rules against incoming traces.
+type Evaluator struct {
+	rules  []config.AlertRule
+	alerts chan Alert
+	shards [numShards]shard
+}
+
+// NewEvaluator creates an evaluator for the configured rules, or returns
+// nil if there is none. Alerts are delivered asynchronously to the sinks.
+func NewEvaluator(cfg config.AlertConfig) (*Evaluator, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	var sinks []func(Alert)
+	if cfg.Log || (cfg.Webhook == "" && cfg.File == "") {
+		sinks = append(sinks, logAlert)
+	}
+	if cfg.Webhook != "" {
+		client := &http.Client{Timeout: 5 * time.Second}
+		sinks = append(sinks, func(a Alert) {
+			postAlert(client, cfg.Webhook, a)
+		})
+	}
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot open alert file: %v", err)
+		}
+		enc := json.NewEncoder(f)
+		sinks = append(sinks, func(a Alert) {
+			if err := enc.Encode(a); err != nil {
+				log.Printf("Error writing alert to file: %v", err)
+			}
+		})
+	}
+
+	e := newEvaluator(cfg.Rules)
+	go func() {
+		for a := range e.alerts {
+			for _, sink := range sinks {
+				sink(a)
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			e.tick(now)
+		}
+	}()
+
+	log.Printf("[IOAM Agent] Evaluating %d alert rule(s)", len(cfg.Rules))
+	return e, nil
+}
+
+func newEvaluator(rules []config.AlertRule) *Evaluator {
+	e := &Evaluator{
+		rules:  rules,
+		alerts: make(chan Alert, queueSize),
+	}
+	for i := range e.shards {
+		e.shards[i].states = make(map[key]*state)
+	}
+	return e
+}
+
+// Evaluate updates the state of the rules matching the nodes of the trace.
+func (e *Evaluator) Evaluate(trace *report.Trace) {
+	e.evaluate(trace, time.Now())
+}
+
+func (e *Evaluator) evaluate(trace *report.Trace, now time.Time) {
+	for i, rule := range e.rules {
+		if rule.Namespace != nil && *rule.Namespace != trace.GetNamespaceId() {
+			continue
+		}
+		for _, node := range trace.GetNodes() {
+			id := trace.NodeID(node)
+			if rule.Node != nil && *rule.Node != id {
+				continue
+			}
+			value, ok := fieldValue(node, ioam.TraceType(trace.GetBitField()), rule.Field)
+			if !ok {
+				continue
+			}
+
+			k := key{rule: i, namespace: trace.GetNamespaceId(), node: id}
+			sh := &e.shards[k.shard()]
+			sh.mu.Lock()
+			st, ok := sh.states[k]
+			if !ok {
+				st = &state{}
+				sh.states[k] = st
+			}
+			st.value, st.lastSeen = value, now
+			e.step(rule, k, st, now)
+			sh.mu.Unlock()
+		}
+	}
+}
+
+// step updates the state of a rule for a node from its last value. Must be
+// called with the lock of its shard held.
+func (e *Evaluator) step(rule config.AlertRule, k key, st *state, now time.Time) {
+	switch {
+	case st.value > rule.Threshold:
+		if st.since.IsZero() {
+			st.since = now
+		}
+		if !st.firing && now.Sub(st.since) >= time.Duration(rule.Duration) {
+			st.firing = true
+			e.notify(rule, Firing, k, st.value, now)
+		}
+	case st.value <= rule.Threshold-rule.Hysteresis:
+		st.since = time.Time{}
+		if st.firing {
+			st.firing = false
+			e.notify(rule, Resolved, k, st.value, now)
+		}
+	default:
+		// Within the hysteresis band: a firing alert keeps firing,
+		// a pending one must start over.
+		if !st.firing {
+			st.since = time.Time{}
+		}
+	}
+}
+
+// tick re-evaluates the states without waiting for the next trace, so that
+// a pending alert fires once its duration elapsed, and drops the states of
+// the nodes that left the traces, resolving their firing alerts.
+func (e *Evaluator) tick(now time.Time) {
+	for i := range e.shards {
+		sh := &e.shards[i]
+		sh.mu.Lock()
+		for k, st := range sh.states {
+			rule := e.rules[k.rule]
+			if now.Sub(st.lastSeen) > staleAfter {
+				if st.firing {
+					e.notify(rule, Resolved, k, st.value, now)
+				}
+				delete(sh.states, k)
+				continue
+			}
+			e.step(rule, k, st, now)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+func (e *Evaluator) notify(rule config.AlertRule, st string, k key, value uint32, now time.Time) {
+	a := Alert{
+		Rule:      rule.Name,
+		State:     st,
+		Namespace: k.namespace,
+		Node:      k.node,
+		Field:     rule.Field,
+		Value:     value,
+		Threshold: rule.Threshold,
+		Time:      now,
+	}
+	select {
+	case e.alerts <- a:
+	default:
+		log.Printf("Alert queue full, dropping alert %s (%s) for node %d", a.Rule, a.State, a.Node)
+	}
+}
+
+func fieldValue(node *ioamAPI.IOAMNode, traceType ioam.TraceType, field string) (uint32, bool) {
+	switch field {
+	case config.FieldQueueDepth:
+		return node.GetQueueDepth(), traceType.Has(ioam.TraceTypeQueueDepth)
+	case config.FieldBufferOccupancy:
+		return node.GetBufferOccupancy(), traceType.Has(ioam.TraceTypeBufferOccupancy)
+	case config.FieldTransitDelay:
+		// The most significant bit is the overflow flag
+		return node.GetTransitDelay() & 0x7FFFFFFF, traceType.Has(ioam.TraceTypeTransitDelay)
+	}
+	return 0, false
+}
+
+func logAlert(a Alert) {
+	log.Printf("[IOAM Agent] Alert %s %s: namespace %d node %d %s=%d (threshold %d)",
+		a.Rule, a.State, a.Namespace, a.Node, a.Field, a.Value, a.Threshold)
+}
+
+func postAlert(client *http.Client, url string, a Alert) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to send alert to webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Webhook rejected alert: %s", resp.Status)
+	}
+}
@@ -0,0 +1,120 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func queueTrace(depths ...uint32) *report.Trace {
+	trace := &ioamAPI.IOAMTrace{
+		NamespaceId: 1,
+		BitField:    uint32(ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeQueueDepth),
+	}
+	for i, depth := range depths {
+		trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: uint32(i + 1), QueueDepth: depth})
+	}
+	return &report.Trace{IOAMTrace: trace}
+}
+
+// received returns the alerts queued so far.
+func received(e *Evaluator) []Alert {
+	var alerts []Alert
+	for {
+		select {
+		case a := <-e.alerts:
+			alerts = append(alerts, a)
+		default:
+			return alerts
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	node := uint64(2)
+	e := newEvaluator([]config.AlertRule{{
+		Name:       "queue",
+		Node:       &node,
+		Field:      config.FieldQueueDepth,
+		Threshold:  100,
+		Duration:   config.Duration(10 * time.Second),
+		Hysteresis: 20,
+	}})
+	start := time.Now()
+
+	steps := []struct {
+		after time.Duration
+		depth uint32
+		state string // Alert sent, if any
+	}{
+		{0, 150, ""},
+		{5 * time.Second, 150, ""},
+		{9 * time.Second, 90, ""}, // Pending alert reset in the hysteresis band
+		{10 * time.Second, 150, ""},
+		{15 * time.Second, 150, ""},
+		{20 * time.Second, 101, Firing},
+		{25 * time.Second, 200, ""},
+		{30 * time.Second, 81, ""}, // Still firing in the hysteresis band
+		{35 * time.Second, 80, Resolved},
+		{40 * time.Second, 60, ""},
+		{45 * time.Second, 101, ""},
+	}
+	for _, step := range steps {
+		// Node 1 is not matched by the rule
+		e.evaluate(queueTrace(1000, step.depth), start.Add(step.after))
+		alerts := received(e)
+		if step.state == "" {
+			if len(alerts) != 0 {
+				t.Fatalf("after %v: unexpected alerts %+v", step.after, alerts)
+			}
+			continue
+		}
+		if len(alerts) != 1 {
+			t.Fatalf("after %v: alerts %+v, want one %s", step.after, alerts, step.state)
+		}
+		a := alerts[0]
+		if a.State != step.state || a.Rule != "queue" || a.Namespace != 1 || a.Node != 2 || a.Value != step.depth || a.Threshold != 100 {
+			t.Errorf("after %v: alert %+v, want %s with value %d", step.after, a, step.state, step.depth)
+		}
+	}
+}
+
+func TestTick(t *testing.T) {
+	e := newEvaluator([]config.AlertRule{{
+		Name:      "queue",
+		Field:     config.FieldQueueDepth,
+		Threshold: 100,
+		Duration:  config.Duration(10 * time.Second),
+	}})
+	start := time.Now()
+
+	// The pending alert of node 1 fires without a new trace
+	e.evaluate(queueTrace(150, 50), start)
+	e.tick(start.Add(5 * time.Second))
+	if alerts := received(e); len(alerts) != 0 {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+	e.tick(start.Add(10 * time.Second))
+	if alerts := received(e); len(alerts) != 1 || alerts[0].State != Firing || alerts[0].Node != 1 {
+		t.Fatalf("alerts %+v, want node 1 firing", alerts)
+	}
+
+	// It is resolved once the node is no longer seen
+	e.tick(start.Add(staleAfter))
+	if alerts := received(e); len(alerts) != 0 {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+	e.tick(start.Add(staleAfter + time.Second))
+	if alerts := received(e); len(alerts) != 1 || alerts[0].State != Resolved || alerts[0].Node != 1 || alerts[0].Value != 150 {
+		t.Fatalf("alerts %+v, want node 1 resolved", alerts)
+	}
+	for i := range e.shards {
+		if n := len(e.shards[i].states); n != 0 {
+			t.Errorf("shard %d keeps %d stale states", i, n)
+		}
+	}
+}
@@ -7,20 +7,24 @@ import (
 	"log"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
-func InitializeCapture(interfaceName string) (*gopacket.PacketSource, error) {
+// InitializeCapture opens the capture of the IPv6 packets with a Hop-by-Hop
+// Options header. The data read from the source is only valid until the
+// next read.
+func InitializeCapture(interfaceName string) (gopacket.ZeroCopyPacketDataSource, layers.LinkType, error) {
 	log.Println("[IOAM Agent] Initializing capture with libpcap")
 	handle, err := pcap.OpenLive(interfaceName, 2048, true, pcap.BlockForever)
 	if err != nil {
-		return nil, fmt.Errorf("Couldn't open device %s: %v", interfaceName, err)
+		return nil, 0, fmt.Errorf("Couldn't open device %s: %v", interfaceName, err)
 	}
 	if err := handle.SetBPFFilter("ip6[6] == 0"); err != nil {
-		return nil, fmt.Errorf("Couldn't set BPF filter: %v", err)
+		return nil, 0, fmt.Errorf("Couldn't set BPF filter: %v", err)
 	}
 	if err := handle.SetDirection(pcap.DirectionIn); err != nil {
-		return nil, fmt.Errorf("Error setting handle direction: %v", err)
+		return nil, 0, fmt.Errorf("Error setting handle direction: %v", err)
 	}
-	return gopacket.NewPacketSource(handle, handle.LinkType()), nil
+	return handle, handle.LinkType(), nil
 }
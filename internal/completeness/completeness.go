@@ -0,0 +1,89 @@
+package completeness
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+)
+
+// NamespaceStats counts the incomplete traces of a namespace.
+type NamespaceStats struct {
+	Namespace  uint32
+	Traces     uint64
+	Partial    uint64 // Pre-allocated traces with free node slots left
+	Undersized uint64 // Traces whose option was too small for the path
+	Gapped     uint64 // Traces with hops that did not add their data
+	Missing    uint64 // Hops that did not add their data, over all traces
+	Filled     uint64 // Node slots filled, over all traces
+	Allocated  uint64 // Node slots allocated (filled + free), over all traces
+}
+
+// Analyzer aggregates the completeness of the traces per namespace.
+type Analyzer struct {
+	mu         sync.Mutex
+	namespaces map[uint32]*NamespaceStats
+}
+
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{namespaces: make(map[uint32]*NamespaceStats)}
+}
+
+// Observe records the completeness of the trace.
+func (a *Analyzer) Observe(trace *report.Trace) {
+	c := trace.GetCompleteness()
+	if c == nil {
+		return
+	}
+	ns := trace.GetNamespaceId()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.namespaces[ns]
+	if !ok {
+		s = &NamespaceStats{Namespace: ns}
+		a.namespaces[ns] = s
+	}
+	s.Traces++
+	if c.GetPreallocated() && c.GetAllocated() > c.GetFilled() {
+		s.Partial++
+	}
+	if c.GetUndersized() {
+		s.Undersized++
+	}
+	if c.GetMissing() > 0 {
+		s.Gapped++
+	}
+	s.Missing += uint64(c.GetMissing())
+	s.Filled += uint64(c.GetFilled())
+	s.Allocated += uint64(c.GetAllocated())
+}
+
+// Stats returns the completeness counters of every namespace seen.
+func (a *Analyzer) Stats() []NamespaceStats {
+	a.mu.Lock()
+	stats := make([]NamespaceStats, 0, len(a.namespaces))
+	for _, s := range a.namespaces {
+		stats = append(stats, *s)
+	}
+	a.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Namespace < stats[j].Namespace })
+	return stats
+}
+
+// WriteStats writes one line per namespace, the fill ratio being the share
+// of the allocated node slots that were filled.
+func (a *Analyzer) WriteStats(w io.Writer) {
+	for _, s := range a.Stats() {
+		fill := 100.0
+		if s.Allocated > 0 {
+			fill = 100 * float64(s.Filled) / float64(s.Allocated)
+		}
+		fmt.Fprintf(w, "completeness ns=%d traces=%d partial=%d undersized=%d gapped=%d missing-hops=%d fill=%.1f%%\n",
+			s.Namespace, s.Traces, s.Partial, s.Undersized, s.Gapped, s.Missing, fill)
+	}
+}
@@ -0,0 +1,46 @@
+package completeness
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func completeTrace(ns uint32, c *ioamAPI.Completeness) *report.Trace {
+	return &report.Trace{IOAMTrace: &ioamAPI.IOAMTrace{NamespaceId: ns, Completeness: c}}
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer()
+	a.Observe(completeTrace(2, &ioamAPI.Completeness{Preallocated: true, Allocated: 4, Filled: 4}))
+	a.Observe(completeTrace(2, &ioamAPI.Completeness{Preallocated: true, Allocated: 4, Filled: 2, Gaps: []uint32{3}, Missing: 3}))
+	a.Observe(completeTrace(2, &ioamAPI.Completeness{Allocated: 3, Filled: 1}))
+	a.Observe(completeTrace(2, &ioamAPI.Completeness{Preallocated: true, Allocated: 2, Filled: 2, Gaps: []uint32{1}, Missing: 1, Undersized: true}))
+	a.Observe(completeTrace(1, &ioamAPI.Completeness{Preallocated: true, Allocated: 1, Filled: 1, Undersized: true}))
+	a.Observe(completeTrace(1, nil)) // Not counted
+
+	stats := a.Stats()
+	want := []NamespaceStats{
+		{Namespace: 1, Traces: 1, Undersized: 1, Filled: 1, Allocated: 1},
+		// Only the pre-allocated trace with free slots is partial
+		{Namespace: 2, Traces: 4, Partial: 1, Undersized: 1, Gapped: 2, Missing: 4, Filled: 9, Allocated: 13},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("Stats() = %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("Stats()[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	a.WriteStats(&buf)
+	wantStats := "completeness ns=1 traces=1 partial=0 undersized=1 gapped=0 missing-hops=0 fill=100.0%\n" +
+		"completeness ns=2 traces=4 partial=1 undersized=1 gapped=2 missing-hops=4 fill=69.2%\n"
+	if buf.String() != wantStats {
+		t.Errorf("WriteStats() = %q, want %q", buf.String(), wantStats)
+	}
+}
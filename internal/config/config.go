@@ -1,21 +1,230 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"log"
 	"os"
+	"slices"
 	"strings"
 	"time"
 )
 
+// Version of the agent, set at build time (-ldflags "-X ...config.Version=...").
+var Version = "dev"
+
+// Timestamp formats of the IOAM timestamp fields (RFC 9197, section 5)
+const (
+	TimestampPOSIX = "posix" // seconds + microseconds since 1970 (Linux default)
+	TimestampPTP   = "ptp"   // truncated PTP: seconds + nanoseconds
+	TimestampNTP   = "ntp"   // NTP 64-bit: seconds since 1900 + 2^-32 fractions
+)
+
+// Handling of the malformed IOAM options
+const (
+	ParseStrict  = "strict"  // Drop the malformed options
+	ParseLenient = "lenient" // Keep the valid nodes of the malformed options
+)
+
+// Formats of the namespace data fields
+const (
+	DataHex   = "hex"   // Hexadecimal (default)
+	DataUint  = "uint"  // Unsigned big-endian integer
+	DataASCII = "ascii" // Text, trailing NULs removed
+	DataIPv4  = "ipv4"  // IPv4 address, 4-octet field only
+)
+
+// Handling of the traces with the Loopback or Active flag
+const (
+	FlagReport   = "report"   // Like the other traces
+	FlagDrop     = "drop"     // Neither analyzed nor reported
+	FlagSeparate = "separate" // Only reported to the separate sink
+)
+
 type Config struct {
-	Interface string
-	Collector string
-	Dumpfile  string
-	Statfile  string
-	Interval  time.Duration
-	Console   bool
-	Workers   uint
-	Loopback  bool // unused
+	Interface   string
+	Collector   string
+	Dumpfile    string
+	Statfile    string
+	Interval    time.Duration
+	Console     bool
+	Workers     uint
+	QueueSize   uint // Packets queued per worker
+	PinWorkers  bool
+	DelayWindow time.Duration
+	Listen      string
+	PrefixLen   int
+	Aggregate   time.Duration
+	Sample      uint64
+	ParseMode   string
+	Namespaces  map[uint32]NamespaceConfig
+	Alerts      AlertConfig
+	Flags       FlagsConfig
+	Reporters   ReportersConfig
+	OSSSchemas  map[uint32]OSSSchemaConfig
+	Inventory   InventoryConfig
+	Checksum    ChecksumConfig
+	Hash        string // Identifies the configuration (flags and file), reported to the collector
+}
+
+// NamespaceConfig holds the settings specific to one IOAM namespace. The
+// configured namespaces make up the registry: once one is configured, the
+// traces of the other namespaces are flagged as unknown.
+type NamespaceConfig struct {
+	Name              string   `json:"name"`
+	TimestampFormat   string   `json:"timestamp_format"`
+	NamespaceData     string   `json:"namespace_data"`      // Format of the 4-octet namespace data
+	NamespaceDataWide string   `json:"namespace_data_wide"` // Format of the 8-octet namespace data
+	Nodes             []uint64 `json:"nodes"`               // Expected node IDs, any if empty
+	OSSSchema         *uint32  `json:"oss_schema"`          // Expected OSS schema ID, any if unset
+}
+
+// OSSSchemaConfig is the layout of the opaque state snapshots of a schema:
+// the name of a built-in decoder, or a list of fields.
+type OSSSchemaConfig struct {
+	Builtin string     `json:"builtin"`
+	Fields  []OSSField `json:"fields"`
+}
+
+// OSSField is a field of an opaque state snapshot.
+type OSSField struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"` // In octets from the start of the snapshot data
+	Width  int    `json:"width"`  // In octets, up to the end of the data if 0 (hex and ascii only)
+	Type   string `json:"type"`
+}
+
+// Types of the OSS fields
+const (
+	OSSTypeUint  = "uint"  // Unsigned big-endian integer, 1 to 8 octets
+	OSSTypeInt   = "int"   // Signed big-endian integer, 1 to 8 octets
+	OSSTypeHex   = "hex"   // Hexadecimal
+	OSSTypeASCII = "ascii" // Text, trailing NULs removed
+	OSSTypeIPv4  = "ipv4"  // IPv4 address, 4 octets
+	OSSTypeIPv6  = "ipv6"  // IPv6 address, 16 octets
+)
+
+// InventoryConfig is the inventory file naming the nodes and interfaces
+// (see pkg/ioam/inventory), reloaded when it changes.
+type InventoryConfig struct {
+	File   string   `json:"file"`
+	Reload Duration `json:"reload"` // Interval between checks for changes, 10s if unset
+}
+
+// ChecksumConfig sets the handling of the traces whose Checksum Complement
+// verification suggests that a node corrupted the packet.
+type ChecksumConfig struct {
+	Flag bool `json:"flag"` // Set Corrupted in the Checksum of the trace
+}
+
+// ReportersConfig restricts the namespaces reported by every reporter,
+// the file and collector ones including those of the separate sink.
+type ReportersConfig struct {
+	Console   NamespaceFilter `json:"console"`
+	File      NamespaceFilter `json:"file"`
+	Collector NamespaceFilter `json:"collector"`
+}
+
+// NamespaceFilter is an allow list (all namespaces if empty) and a deny
+// list of namespaces.
+type NamespaceFilter struct {
+	Allow []uint32 `json:"allow"`
+	Deny  []uint32 `json:"deny"`
+}
+
+// Allows reports whether the traces of the namespace pass the filter.
+func (f NamespaceFilter) Allows(ns uint32) bool {
+	return (len(f.Allow) == 0 || slices.Contains(f.Allow, ns)) && !slices.Contains(f.Deny, ns)
+}
+
+// AlertConfig holds the alert rules and where fired alerts are sent.
+type AlertConfig struct {
+	Rules   []AlertRule `json:"rules"`
+	Log     bool        `json:"log"`     // Print alerts in the agent log
+	Webhook string      `json:"webhook"` // POST alerts (JSON) to this URL
+	File    string      `json:"file"`    // Append alerts (JSON lines) to this file
+}
+
+// AlertRule fires when a node field stays above Threshold for at least
+// Duration, and clears once it drops to Threshold-Hysteresis or below.
+type AlertRule struct {
+	Name       string   `json:"name"`
+	Namespace  *uint32  `json:"namespace"` // Any namespace if unset
+	Node       *uint64  `json:"node"`      // Any node if unset
+	Field      string   `json:"field"`
+	Threshold  uint32   `json:"threshold"`
+	Duration   Duration `json:"duration"`
+	Hysteresis uint32   `json:"hysteresis"`
+}
+
+// FlagsConfig sets the handling of the loopback (RFC 9322) and active
+// measurement traces.
+type FlagsConfig struct {
+	Loopback string     `json:"loopback"`
+	Active   string     `json:"active"`
+	Sink     SinkConfig `json:"sink"`
+}
+
+// SinkConfig is where the traces handled as FlagSeparate are reported.
+type SinkConfig struct {
+	File      string `json:"file"`      // CSV, like -d
+	Collector string `json:"collector"` // gRPC, like -c
+}
+
+// Handling returns how a trace with the given flags is handled, dropping
+// taking precedence over the separate sink.
+func (f FlagsConfig) Handling(loopback, active bool) string {
+	var l, a string
+	if loopback {
+		l = f.Loopback
+	}
+	if active {
+		a = f.Active
+	}
+	switch {
+	case l == FlagDrop || a == FlagDrop:
+		return FlagDrop
+	case l == FlagSeparate || a == FlagSeparate:
+		return FlagSeparate
+	}
+	return FlagReport
+}
+
+// Fields that alert rules can be defined on
+const (
+	FieldQueueDepth      = "queue_depth"
+	FieldBufferOccupancy = "buffer_occupancy"
+	FieldTransitDelay    = "transit_delay"
+)
+
+// Duration is a time.Duration read from a JSON string such as "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// fileConfig is the layout of the JSON configuration file.
+type fileConfig struct {
+	Namespaces map[uint32]NamespaceConfig `json:"namespaces"`
+	Alerts     AlertConfig                `json:"alerts"`
+	Flags      FlagsConfig                `json:"flags"`
+	Reporters  ReportersConfig            `json:"reporters"`
+	OSSSchemas map[uint32]OSSSchemaConfig `json:"oss_schemas"`
+	Inventory  InventoryConfig            `json:"inventory"`
+	Checksum   ChecksumConfig             `json:"checksum"`
 }
 
 func ParseFlags() *Config {
@@ -26,22 +235,177 @@ func ParseFlags() *Config {
 	interval := flag.Duration("t", time.Second, "Interval for updating statistics file (0 disables)")
 	console := flag.Bool("o", false, "Reporter: Print IOAM traces to console")
 	workers := flag.Uint("g", 8, "Number of Goroutines for packet parsing")
+	queueSize := flag.Uint("q", 64, "Number of packets queued per parsing Goroutine")
+	pin := flag.Bool("b", false, "Bind every parsing Goroutine to a CPU")
+	cfile := flag.String("f", "", "Configuration file (JSON) with per-namespace settings")
+	window := flag.Duration("w", time.Minute, "Sliding window for per-link delay statistics")
+	listen := flag.String("l", "", "HTTP listen address for on-demand exports (e.g. the topology)")
+	prefixLen := flag.Int("p", 128, "Prefix length of the source/destination addresses grouped for route-change detection")
+	aggregate := flag.Duration("a", 0, "Aggregation mode: report one summary per namespace, path and flow every interval (0 disables)")
+	sample := flag.Uint64("n", 0, "Aggregation mode: also report 1 in N traces as is (0 disables)")
+	parseMode := flag.String("m", ParseStrict, "Handling of malformed IOAM options: strict (drop them) or lenient (keep their valid nodes)")
 	flag.Parse()
 
-	if *iface == "" || *workers == 0 {
+	if *iface == "" || *workers == 0 || *queueSize == 0 || *window <= 0 || *prefixLen < 0 || *prefixLen > 128 || *aggregate < 0 ||
+		(*parseMode != ParseStrict && *parseMode != ParseLenient) {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	return &Config{
-		Interface: *iface,
-		Collector: *collector,
-		Dumpfile:  *dfile,
-		Statfile:  expandFilename(*sfile, time.Now()),
-		Interval:  *interval,
-		Console:   *console,
-		Workers:   *workers,
+	cfg := &Config{
+		Interface:   *iface,
+		Collector:   *collector,
+		Dumpfile:    *dfile,
+		Statfile:    expandFilename(*sfile, time.Now()),
+		Interval:    *interval,
+		Console:     *console,
+		Workers:     *workers,
+		QueueSize:   *queueSize,
+		PinWorkers:  *pin,
+		DelayWindow: *window,
+		Listen:      *listen,
+		PrefixLen:   *prefixLen,
+		Aggregate:   *aggregate,
+		Sample:      *sample,
+		ParseMode:   *parseMode,
+	}
+
+	// The flags are hashed sorted by name, so that the hash does not depend
+	// on their order or syntax (-p 64, -p=64)
+	h := sha256.New()
+	flag.Visit(func(f *flag.Flag) {
+		fmt.Fprintf(h, "%s=%s\x00", f.Name, f.Value)
+	})
+	if *cfile != "" {
+		data, err := cfg.loadFile(*cfile)
+		if err != nil {
+			log.Fatalf("Cannot load configuration file: %v", err)
+		}
+		h.Write(data)
+	}
+	cfg.Hash = hex.EncodeToString(h.Sum(nil))[:16]
+
+	return cfg
+}
+
+// TimestampFormat returns the timestamp format used in the given namespace.
+func (cfg *Config) TimestampFormat(ns uint32) string {
+	if nsCfg, ok := cfg.Namespaces[ns]; ok && nsCfg.TimestampFormat != "" {
+		return nsCfg.TimestampFormat
+	}
+	return TimestampPOSIX
+}
+
+// loadFile applies the settings of the configuration file and returns its
+// content.
+func (cfg *Config) loadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for ns, nsCfg := range fc.Namespaces {
+		switch nsCfg.TimestampFormat {
+		case "", TimestampPOSIX, TimestampPTP, TimestampNTP:
+		default:
+			return nil, fmt.Errorf("namespace %d: unknown timestamp format %q", ns, nsCfg.TimestampFormat)
+		}
+		for _, format := range []string{nsCfg.NamespaceData, nsCfg.NamespaceDataWide} {
+			switch format {
+			case "", DataHex, DataUint, DataASCII, DataIPv4:
+			default:
+				return nil, fmt.Errorf("namespace %d: unknown namespace data format %q", ns, format)
+			}
+		}
+		if nsCfg.NamespaceDataWide == DataIPv4 {
+			return nil, fmt.Errorf("namespace %d: %s format of the 8-octet namespace data", ns, DataIPv4)
+		}
+	}
+	cfg.Namespaces = fc.Namespaces
+
+	for i, rule := range fc.Alerts.Rules {
+		switch rule.Field {
+		case FieldQueueDepth, FieldBufferOccupancy, FieldTransitDelay:
+		default:
+			return nil, fmt.Errorf("alert rule %d (%s): unknown field %q", i, rule.Name, rule.Field)
+		}
+		if rule.Hysteresis > rule.Threshold {
+			return nil, fmt.Errorf("alert rule %d (%s): hysteresis larger than threshold", i, rule.Name)
+		}
+	}
+	cfg.Alerts = fc.Alerts
+
+	separate := false
+	for flag, handling := range map[string]string{"loopback": fc.Flags.Loopback, "active": fc.Flags.Active} {
+		switch handling {
+		case "", FlagReport, FlagDrop:
+		case FlagSeparate:
+			separate = true
+		default:
+			return nil, fmt.Errorf("flags: unknown handling %q of the %s traces", handling, flag)
+		}
+	}
+	if separate && fc.Flags.Sink.File == "" && fc.Flags.Sink.Collector == "" {
+		return nil, fmt.Errorf("flags: no file or collector for the separate sink")
+	}
+	cfg.Flags = fc.Flags
+	cfg.Reporters = fc.Reporters
+
+	for schema, schemaCfg := range fc.OSSSchemas {
+		if (schemaCfg.Builtin == "") == (len(schemaCfg.Fields) == 0) {
+			return nil, fmt.Errorf("OSS schema %d: either a built-in decoder or fields required", schema)
+		}
+		for i, field := range schemaCfg.Fields {
+			if err := checkOSSField(field); err != nil {
+				return nil, fmt.Errorf("OSS schema %d, field %d (%s): %v", schema, i, field.Name, err)
+			}
+		}
+	}
+	cfg.OSSSchemas = fc.OSSSchemas
+
+	if fc.Inventory.Reload < 0 {
+		return nil, fmt.Errorf("inventory: negative reload interval")
+	}
+	if fc.Inventory.Reload == 0 {
+		fc.Inventory.Reload = Duration(10 * time.Second)
+	}
+	cfg.Inventory = fc.Inventory
+	cfg.Checksum = fc.Checksum
+
+	return data, nil
+}
+
+// checkOSSField returns an error if the field cannot be decoded.
+func checkOSSField(field OSSField) error {
+	if field.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	if field.Offset < 0 || field.Width < 0 {
+		return fmt.Errorf("negative offset or width")
+	}
+	switch field.Type {
+	case OSSTypeUint, OSSTypeInt:
+		if field.Width < 1 || field.Width > 8 {
+			return fmt.Errorf("width of a %s field must be 1 to 8 octets", field.Type)
+		}
+	case OSSTypeHex, OSSTypeASCII:
+	case OSSTypeIPv4:
+		if field.Width != 4 {
+			return fmt.Errorf("width of an %s field must be 4 octets", field.Type)
+		}
+	case OSSTypeIPv6:
+		if field.Width != 16 {
+			return fmt.Errorf("width of an %s field must be 16 octets", field.Type)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", field.Type)
 	}
+	return nil
 }
 
 func expandFilename(pattern string, t time.Time) string {
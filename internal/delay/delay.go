@@ -0,0 +1,267 @@
+package delay
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+const (
+	maxSamples = 4096 // Per link, oldest samples are dropped first
+)
+
+// Link is a directed hop between two IOAM nodes of a namespace.
+type Link struct {
+	Namespace uint32
+	From      uint64
+	To        uint64
+}
+
+// LinkStats summarizes the delays observed on a link within the window.
+type LinkStats struct {
+	Link
+	Samples int
+	Min     time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
+
+type sample struct {
+	at    time.Time
+	delay time.Duration
+}
+
+// samples is a ring buffer of the samples of a link, oldest first. It grows
+// up to maxSamples, then overwrites the oldest sample.
+type samples struct {
+	buf   []sample
+	start int // Index of the oldest sample in buf
+	len   int
+}
+
+func (s *samples) at(i int) sample {
+	return s.buf[(s.start+i)%len(s.buf)]
+}
+
+func (s *samples) push(x sample) {
+	if s.len == len(s.buf) {
+		if len(s.buf) == maxSamples {
+			s.buf[s.start] = x
+			s.start = (s.start + 1) % len(s.buf)
+			return
+		}
+		buf := make([]sample, min(max(2*len(s.buf), 16), maxSamples))
+		n := copy(buf, s.buf[s.start:])
+		copy(buf[n:], s.buf[:s.start])
+		s.buf, s.start = buf, 0
+	}
+	s.buf[(s.start+s.len)%len(s.buf)] = x
+	s.len++
+}
+
+// Analyzer computes hop-to-hop and path delays from the node timestamps
+// and aggregates per-link delays over a sliding window.
+type Analyzer struct {
+	cfg       *config.Config
+	window    time.Duration
+	inventory func() *inventory.Inventory // Names the nodes in the statistics, if set
+
+	mu    sync.Mutex
+	links map[Link]*samples
+}
+
+func NewAnalyzer(cfg *config.Config) *Analyzer {
+	return &Analyzer{
+		cfg:    cfg,
+		window: cfg.DelayWindow,
+		links:  make(map[Link]*samples),
+	}
+}
+
+// SetInventory names the nodes of the statistics with the inventory
+// returned by inv. It must be called before the analyzer is used.
+func (a *Analyzer) SetInventory(inv func() *inventory.Inventory) {
+	a.inventory = inv
+}
+
+// Analyze attaches the delays of the trace to it and records them.
+func (a *Analyzer) Analyze(trace *report.Trace) {
+	delays := Compute(trace.IOAMTrace, a.cfg.TimestampFormat(trace.GetNamespaceId()))
+	trace.Delays = delays
+	if delays == nil || len(delays.Hops) == 0 {
+		return
+	}
+
+	now := time.Now()
+	nodes := trace.GetNodes()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, d := range delays.Hops {
+		link := Link{
+			Namespace: trace.GetNamespaceId(),
+			From:      trace.NodeID(nodes[i]),
+			To:        trace.NodeID(nodes[i+1]),
+		}
+		s, ok := a.links[link]
+		if !ok {
+			s = &samples{}
+			a.links[link] = s
+		}
+		a.prune(s, now)
+		s.push(sample{at: now, delay: d})
+	}
+}
+
+// Compute returns the delays between consecutive nodes of the trace and
+// along the whole path, or nil if the trace has no (valid) timestamps.
+func Compute(trace *ioamAPI.IOAMTrace, format string) *report.Delays {
+	if !ioam.TraceType(trace.GetBitField()).Has(ioam.TraceTypeTimestampSecs | ioam.TraceTypeTimestampFrac) {
+		return nil
+	}
+
+	nodes := trace.GetNodes()
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	delays := &report.Delays{Hops: make([]time.Duration, 0, len(nodes)-1)}
+	for i := 1; i < len(nodes); i++ {
+		d, ok := between(nodes[i-1], nodes[i], format)
+		if !ok {
+			return nil
+		}
+		delays.Hops = append(delays.Hops, d)
+	}
+	delays.Total, _ = between(nodes[0], nodes[len(nodes)-1], format)
+
+	return delays
+}
+
+// between returns the delay from the timestamp of node a to the one of b.
+// The seconds are subtracted modulo 2^32 so that a wraparound of the
+// seconds field between both nodes yields the right (small) delay.
+func between(a, b *ioamAPI.IOAMNode, format string) (time.Duration, bool) {
+	fa, ok := fracToNanos(a.GetTimestampFrac(), format)
+	if !ok {
+		return 0, false
+	}
+	fb, ok := fracToNanos(b.GetTimestampFrac(), format)
+	if !ok {
+		return 0, false
+	}
+
+	secs := int64(int32(b.GetTimestampSecs() - a.GetTimestampSecs()))
+	return time.Duration(secs*int64(time.Second) + fb - fa), true
+}
+
+func fracToNanos(frac uint32, format string) (int64, bool) {
+	switch format {
+	case config.TimestampPTP:
+		if frac >= 1e9 {
+			return 0, false
+		}
+		return int64(frac), true
+	case config.TimestampNTP:
+		return int64((uint64(frac) * 1e9) >> 32), true
+	default:
+		if frac >= 1e6 {
+			return 0, false
+		}
+		return int64(frac) * 1e3, true
+	}
+}
+
+// prune drops the samples that left the window. Must be called with a.mu held.
+func (a *Analyzer) prune(s *samples, now time.Time) {
+	for s.len > 0 && now.Sub(s.at(0).at) > a.window {
+		s.start = (s.start + 1) % len(s.buf)
+		s.len--
+	}
+}
+
+// Stats returns the delay distribution of every link seen within the window.
+func (a *Analyzer) Stats() []LinkStats {
+	now := time.Now()
+
+	a.mu.Lock()
+	var stats []LinkStats
+	for link, s := range a.links {
+		a.prune(s, now)
+		if s.len == 0 {
+			delete(a.links, link)
+			continue
+		}
+
+		delays := make([]time.Duration, s.len)
+		for i := range delays {
+			delays[i] = s.at(i).delay
+		}
+		sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+		stats = append(stats, LinkStats{
+			Link:    link,
+			Samples: len(delays),
+			Min:     delays[0],
+			P50:     percentile(delays, 50),
+			P90:     percentile(delays, 90),
+			P99:     percentile(delays, 99),
+			Max:     delays[len(delays)-1],
+		})
+	}
+	a.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Namespace != stats[j].Namespace {
+			return stats[i].Namespace < stats[j].Namespace
+		}
+		if stats[i].From != stats[j].From {
+			return stats[i].From < stats[j].From
+		}
+		return stats[i].To < stats[j].To
+	})
+	return stats
+}
+
+// WriteStats prints one line per link, to be appended to the statistics
+// file. The nodes are named by their hostname in the inventory, if any.
+func (a *Analyzer) WriteStats(w io.Writer) {
+	var inv *inventory.Inventory
+	if a.inventory != nil {
+		inv = a.inventory()
+	}
+	for _, s := range a.Stats() {
+		fmt.Fprintf(w, "link ns=%d %s->%s samples=%d min=%s p50=%s p90=%s p99=%s max=%s\n",
+			s.Namespace, nodeLabel(inv, s.Namespace, s.From), nodeLabel(inv, s.Namespace, s.To),
+			s.Samples, s.Min, s.P50, s.P90, s.P99, s.Max)
+	}
+}
+
+// nodeLabel returns the hostname of a node in the inventory, or its ID.
+func nodeLabel(inv *inventory.Inventory, ns uint32, id uint64) string {
+	if n := inv.Node(ns, id); n != nil && n.Hostname != "" {
+		return n.Hostname
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// percentile returns the p-th percentile (nearest rank) of sorted values.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
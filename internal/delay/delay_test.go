@@ -0,0 +1,144 @@
+package delay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func timestampTrace(stamps ...[2]uint32) *ioamAPI.IOAMTrace {
+	trace := &ioamAPI.IOAMTrace{
+		NamespaceId: 1,
+		BitField:    uint32(ioam.TraceTypeTimestampSecs | ioam.TraceTypeTimestampFrac | ioam.TraceTypeHopLimitNodeID),
+	}
+	for i, s := range stamps {
+		trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: uint32(i + 1), TimestampSecs: s[0], TimestampFrac: s[1]})
+	}
+	return trace
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		stamps [][2]uint32
+		hops   []time.Duration // nil if not computed
+		total  time.Duration
+	}{
+		{"posix", config.TimestampPOSIX, [][2]uint32{{100, 999_000}, {101, 1_500}}, []time.Duration{2500 * time.Microsecond}, 2500 * time.Microsecond},
+		{"posix invalid", config.TimestampPOSIX, [][2]uint32{{100, 0}, {100, 1_000_000}}, nil, 0},
+		{"ptp", config.TimestampPTP, [][2]uint32{{100, 999_999_999}, {101, 1}, {101, 11}}, []time.Duration{2, 10}, 12},
+		{"ptp invalid", config.TimestampPTP, [][2]uint32{{100, 0}, {100, 1_000_000_000}}, nil, 0},
+		{"ntp", config.TimestampNTP, [][2]uint32{{100, 1 << 31}, {100, 3 << 30}}, []time.Duration{250 * time.Millisecond}, 250 * time.Millisecond},
+		{"seconds wraparound", config.TimestampPTP, [][2]uint32{{0xFFFFFFFF, 500_000_000}, {0, 250_000_000}}, []time.Duration{750 * time.Millisecond}, 750 * time.Millisecond},
+		{"negative", config.TimestampPOSIX, [][2]uint32{{101, 0}, {100, 500_000}}, []time.Duration{-500 * time.Millisecond}, -500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := Compute(timestampTrace(tt.stamps...), tt.format)
+			if tt.hops == nil {
+				if delays != nil {
+					t.Fatalf("Compute() = %v, want nil", delays)
+				}
+				return
+			}
+			if delays == nil || len(delays.Hops) != len(tt.hops) {
+				t.Fatalf("Compute() = %v, want %v hops", delays, tt.hops)
+			}
+			for i, d := range delays.Hops {
+				if d != tt.hops[i] {
+					t.Errorf("hop %d delay %v, want %v", i, d, tt.hops[i])
+				}
+			}
+			if delays.Total != tt.total {
+				t.Errorf("total delay %v, want %v", delays.Total, tt.total)
+			}
+		})
+	}
+
+	// Without the fraction bit
+	trace := timestampTrace([2]uint32{100, 0}, [2]uint32{101, 0})
+	trace.BitField = uint32(ioam.TraceTypeTimestampSecs)
+	if delays := Compute(trace, config.TimestampPOSIX); delays != nil {
+		t.Errorf("Compute() without fractions = %v, want nil", delays)
+	}
+}
+
+func TestAnalyzerSamples(t *testing.T) {
+	a := NewAnalyzer(&config.Config{DelayWindow: time.Hour})
+	for i := range maxSamples + 10 {
+		a.Analyze(&report.Trace{IOAMTrace: timestampTrace([2]uint32{100, 0}, [2]uint32{100, uint32(i)})})
+	}
+
+	stats := a.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("%d links, want 1", len(stats))
+	}
+	s := stats[0]
+	if s.Link != (Link{Namespace: 1, From: 1, To: 2}) || s.Samples != maxSamples {
+		t.Errorf("link %+v with %d samples, want 1->2 with %d", s.Link, s.Samples, maxSamples)
+	}
+	// The 10 oldest samples, of 0 to 9 µs, were dropped
+	if s.Min != 10*time.Microsecond || s.Max != (maxSamples+9)*time.Microsecond {
+		t.Errorf("min %v, max %v", s.Min, s.Max)
+	}
+	if l := a.links[s.Link]; len(l.buf) != maxSamples {
+		t.Errorf("buffer of %d samples, want %d", len(l.buf), maxSamples)
+	}
+}
+
+func TestAnalyzerWindow(t *testing.T) {
+	a := NewAnalyzer(&config.Config{DelayWindow: time.Minute})
+	link := Link{Namespace: 1, From: 1, To: 2}
+	now := time.Now()
+	s := &samples{}
+	for i := range 20 {
+		s.push(sample{at: now.Add(time.Duration(i-20) * 10 * time.Second), delay: time.Duration(i)})
+	}
+	a.links[link] = s
+
+	stats := a.Stats()
+	if len(stats) != 1 || stats[0].Samples != 5 || stats[0].Min != 15 || stats[0].Max != 19 {
+		t.Fatalf("Stats() = %+v, want the 5 samples of the last minute", stats)
+	}
+
+	s.start, s.len = 0, 0
+	if stats := a.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() = %+v without samples", stats)
+	}
+	if _, ok := a.links[link]; ok {
+		t.Error("link without samples not removed")
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	a := NewAnalyzer(&config.Config{DelayWindow: time.Hour})
+	a.Analyze(&report.Trace{IOAMTrace: timestampTrace([2]uint32{100, 0}, [2]uint32{100, 5}, [2]uint32{100, 15})})
+
+	var out strings.Builder
+	a.WriteStats(&out)
+	want := "link ns=1 1->2 samples=1 min=5µs p50=5µs p90=5µs p99=5µs max=5µs\n" +
+		"link ns=1 2->3 samples=1 min=10µs p50=10µs p90=10µs p99=10µs max=10µs\n"
+	if out.String() != want {
+		t.Errorf("WriteStats() = %q, want %q", out.String(), want)
+	}
+
+	// Named by the hostnames of the inventory, the IDs of the other nodes
+	inv := &inventory.Inventory{Namespaces: map[uint32]*inventory.Namespace{
+		1: {Nodes: map[uint64]*inventory.Node{1: {Hostname: "r1"}, 2: {Hostname: "r2"}, 3: {Site: "paris"}}},
+	}}
+	a.SetInventory(func() *inventory.Inventory { return inv })
+	out.Reset()
+	a.WriteStats(&out)
+	want = "link ns=1 r1->r2 samples=1 min=5µs p50=5µs p90=5µs p99=5µs max=5µs\n" +
+		"link ns=1 r2->3 samples=1 min=10µs p50=10µs p90=10µs p99=10µs max=10µs\n"
+	if out.String() != want {
+		t.Errorf("WriteStats() = %q, want %q", out.String(), want)
+	}
+}
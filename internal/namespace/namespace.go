@@ -0,0 +1,157 @@
+package namespace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/oss"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// counters are the traces seen in a namespace.
+type counters struct {
+	traces            uint64
+	unexpectedNodes   uint64 // Traces with node IDs not expected in the namespace
+	unexpectedSchemas uint64 // Traces with OSS of another schema than expected
+}
+
+// entry is a namespace of the registry.
+type entry struct {
+	cfg   config.NamespaceConfig
+	known *ioamAPI.Namespace // Shared by the traces without unexpected nodes or schemas, read-only
+}
+
+// Registry annotates the traces with the properties of their namespace set
+// in the configuration file: name, decoded namespace data, and the nodes
+// and OSS schemas that are not expected in the namespace. The traces of the
+// namespaces that are not configured are flagged as unknown.
+type Registry struct {
+	entries map[uint32]*entry
+	unknown *ioamAPI.Namespace // Shared by the traces of unknown namespaces, read-only
+
+	mu    sync.Mutex
+	stats map[uint32]*counters
+}
+
+// NewRegistry returns the registry of the configured namespaces, nil if
+// there is none.
+func NewRegistry(namespaces map[uint32]config.NamespaceConfig) *Registry {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	r := &Registry{
+		entries: make(map[uint32]*entry, len(namespaces)),
+		unknown: &ioamAPI.Namespace{Unknown: true},
+		stats:   make(map[uint32]*counters),
+	}
+	for ns, cfg := range namespaces {
+		r.entries[ns] = &entry{cfg: cfg, known: &ioamAPI.Namespace{Name: cfg.Name}}
+	}
+	return r
+}
+
+// Annotate sets the Namespace of the trace and decodes the namespace data
+// of its nodes.
+func (r *Registry) Annotate(trace *report.Trace) {
+	ns := trace.GetNamespaceId()
+	e, ok := r.entries[ns]
+	if !ok {
+		trace.Namespace = r.unknown
+		r.count(ns, false, false)
+		return
+	}
+
+	var nodes, schemas []uint32
+	traceType := ioam.TraceType(trace.GetBitField())
+	for i, node := range trace.GetNodes() {
+		if len(e.cfg.Nodes) > 0 && !slices.Contains(e.cfg.Nodes, trace.NodeID(node)) {
+			nodes = append(nodes, uint32(i))
+		}
+		if e.cfg.OSSSchema != nil && node.GetOSS() != nil && node.GetOSS().GetSchemaId() != *e.cfg.OSSSchema {
+			schemas = append(schemas, uint32(i))
+		}
+		if traceType&ioam.TraceTypeNamespaceData != 0 && e.cfg.NamespaceData != "" {
+			node.NamespaceDataText = decodeData(node.GetNamespaceData(), e.cfg.NamespaceData)
+		}
+		if traceType&ioam.TraceTypeNamespaceDataWide != 0 && e.cfg.NamespaceDataWide != "" {
+			node.NamespaceDataWideText = decodeData(node.GetNamespaceDataWide(), e.cfg.NamespaceDataWide)
+		}
+	}
+
+	trace.Namespace = e.known
+	if nodes != nil || schemas != nil {
+		trace.Namespace = &ioamAPI.Namespace{Name: e.cfg.Name, UnexpectedNodes: nodes, UnexpectedSchemas: schemas}
+	}
+	r.count(ns, nodes != nil, schemas != nil)
+}
+
+func (r *Registry) count(ns uint32, unexpectedNodes, unexpectedSchemas bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.stats[ns]
+	if !ok {
+		c = &counters{}
+		r.stats[ns] = c
+	}
+	c.traces++
+	if unexpectedNodes {
+		c.unexpectedNodes++
+	}
+	if unexpectedSchemas {
+		c.unexpectedSchemas++
+	}
+}
+
+// decodeData returns a namespace data field in the given format.
+func decodeData(data []byte, format string) string {
+	switch format {
+	case config.DataUint:
+		var v uint64
+		for _, b := range data {
+			v = v<<8 | uint64(b)
+		}
+		return strconv.FormatUint(v, 10)
+	case config.DataASCII:
+		return oss.Text(data)
+	case config.DataIPv4:
+		if len(data) == 4 {
+			return net.IP(data).String()
+		}
+	}
+	return hex.EncodeToString(data)
+}
+
+// WriteStats writes one line per namespace seen: its name, or unknown if
+// it is not in the registry, and the number of traces, of which with node
+// IDs or OSS schemas not expected in the namespace.
+func (r *Registry) WriteStats(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespaces := make([]uint32, 0, len(r.stats))
+	for ns := range r.stats {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i] < namespaces[j] })
+
+	for _, ns := range namespaces {
+		c := r.stats[ns]
+		e, ok := r.entries[ns]
+		if !ok {
+			fmt.Fprintf(w, "namespace ns=%d unknown traces=%d\n", ns, c.traces)
+			continue
+		}
+		fmt.Fprintf(w, "namespace ns=%d name=%q traces=%d unexpected-nodes=%d unexpected-schemas=%d\n",
+			ns, e.cfg.Name, c.traces, c.unexpectedNodes, c.unexpectedSchemas)
+	}
+}
@@ -0,0 +1,122 @@
+package namespace
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func TestDecodeData(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   string
+	}{
+		{"hex", []byte{0xDE, 0xAD, 0xBE, 0xEF}, config.DataHex, "deadbeef"},
+		{"default", []byte{0, 1}, "", "0001"},
+		{"uint", []byte{0, 0, 1, 0}, config.DataUint, "256"},
+		{"wide uint", []byte{1, 0, 0, 0, 0, 0, 0, 0}, config.DataUint, "72057594037927936"},
+		{"ascii", []byte("eu1\x00"), config.DataASCII, "eu1"},
+		{"ipv4", []byte{192, 0, 2, 1}, config.DataIPv4, "192.0.2.1"},
+		{"wide ipv4", []byte{0, 0, 0, 0, 192, 0, 2, 1}, config.DataIPv4, "00000000c0000201"},
+	}
+	for _, tt := range tests {
+		if got := decodeData(tt.data, tt.format); got != tt.want {
+			t.Errorf("%s: decodeData() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter config.NamespaceFilter
+		allows []uint32
+		denies []uint32
+	}{
+		{"all", config.NamespaceFilter{}, []uint32{0, 123, 0xFFFF}, nil},
+		{"allow list", config.NamespaceFilter{Allow: []uint32{1, 2}}, []uint32{1, 2}, []uint32{0, 3}},
+		{"deny list", config.NamespaceFilter{Deny: []uint32{2}}, []uint32{1, 3}, []uint32{2}},
+		{"denied in allow list", config.NamespaceFilter{Allow: []uint32{1, 2}, Deny: []uint32{2}}, []uint32{1}, []uint32{2, 3}},
+	}
+	for _, tt := range tests {
+		for _, ns := range tt.allows {
+			if !tt.filter.Allows(ns) {
+				t.Errorf("%s: Allows(%d) = false, want true", tt.name, ns)
+			}
+		}
+		for _, ns := range tt.denies {
+			if tt.filter.Allows(ns) {
+				t.Errorf("%s: Allows(%d) = true, want false", tt.name, ns)
+			}
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if r := NewRegistry(nil); r != nil {
+		t.Errorf("NewRegistry(nil) = %v, want nil", r)
+	}
+
+	schema := uint32(7)
+	r := NewRegistry(map[uint32]config.NamespaceConfig{
+		123: {Name: "core", Nodes: []uint64{1, 2}, OSSSchema: &schema, NamespaceData: config.DataUint},
+		124: {Name: "edge", NamespaceDataWide: config.DataASCII},
+	})
+	trace := func(ns uint32, nodes ...*ioamAPI.IOAMNode) *report.Trace {
+		fields := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeNamespaceData | ioam.TraceTypeNamespaceDataWide | ioam.TraceTypeOSS
+		return &report.Trace{IOAMTrace: &ioamAPI.IOAMTrace{NamespaceId: ns, BitField: uint32(fields), Nodes: nodes}}
+	}
+	node := func(id uint32, schema uint32) *ioamAPI.IOAMNode {
+		return &ioamAPI.IOAMNode{Id: id, NamespaceData: []byte{0, 0, 0, 9}, NamespaceDataWide: []byte("edge\x00\x00\x00\x00"),
+			OSS: &ioamAPI.Opaque{SchemaId: schema, Data: []byte{1, 2, 3, 4}}}
+	}
+
+	tests := []struct {
+		name     string
+		trace    *report.Trace
+		want     *ioamAPI.Namespace
+		data     string // Decoded data of the first node
+		dataWide string
+	}{
+		{"expected", trace(123, node(1, 7), node(2, 7)), &ioamAPI.Namespace{Name: "core"}, "9", ""},
+		{"unexpected node", trace(123, node(1, 7), node(3, 7), node(4, 7)),
+			&ioamAPI.Namespace{Name: "core", UnexpectedNodes: []uint32{1, 2}}, "9", ""},
+		{"unexpected schema", trace(123, node(1, 8), node(2, 7)),
+			&ioamAPI.Namespace{Name: "core", UnexpectedSchemas: []uint32{0}}, "9", ""},
+		{"any node and schema", trace(124, node(5, 8)), &ioamAPI.Namespace{Name: "edge"}, "", "edge"},
+		{"unknown", trace(125, node(1, 7)), &ioamAPI.Namespace{Unknown: true}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.Annotate(tt.trace)
+			got := tt.trace.Namespace
+			if got.GetName() != tt.want.GetName() || got.GetUnknown() != tt.want.GetUnknown() ||
+				!slices.Equal(got.GetUnexpectedNodes(), tt.want.GetUnexpectedNodes()) ||
+				!slices.Equal(got.GetUnexpectedSchemas(), tt.want.GetUnexpectedSchemas()) {
+				t.Errorf("Namespace = %v, want %v", got, tt.want)
+			}
+			first := tt.trace.GetNodes()[0]
+			if first.GetNamespaceDataText() != tt.data || first.GetNamespaceDataWideText() != tt.dataWide {
+				t.Errorf("namespace data %q and %q, want %q and %q",
+					first.GetNamespaceDataText(), first.GetNamespaceDataWideText(), tt.data, tt.dataWide)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	r.WriteStats(&out)
+	want := `namespace ns=123 name="core" traces=3 unexpected-nodes=1 unexpected-schemas=1
+namespace ns=124 name="edge" traces=1 unexpected-nodes=0 unexpected-schemas=0
+namespace ns=125 unknown traces=1
+`
+	if out.String() != want {
+		t.Errorf("WriteStats() = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,235 @@
+// Package oss decodes the Opaque State Snapshots (trace type bit 22) of the
+// schemas the agent knows, into named fields.
+package oss
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+var (
+	ErrShortData = errors.New("snapshot data shorter than the layout")
+	ErrAlignment = errors.New("snapshot data not a multiple of the word size")
+)
+
+// Decoder decodes the data of the snapshots of a schema into fields.
+type Decoder interface {
+	Decode(data []byte) ([]*ioamAPI.OSSField, error)
+}
+
+// DecoderFunc is a function used as a Decoder.
+type DecoderFunc func(data []byte) ([]*ioamAPI.OSSField, error)
+
+func (f DecoderFunc) Decode(data []byte) ([]*ioamAPI.OSSField, error) {
+	return f(data)
+}
+
+// Builtins are the built-in decoders, by name:
+//   - text: the data as a single "text" field
+//   - kv: "key=value" pairs separated by ';', ',', spaces or NULs
+//   - uint32, uint64: big-endian counters, named by their index from 0
+var Builtins = map[string]Decoder{
+	"text":   DecoderFunc(decodeText),
+	"kv":     DecoderFunc(decodeKeyValues),
+	"uint32": words(4),
+	"uint64": words(8),
+}
+
+// Text returns the data as text: trailing NULs are removed, and the
+// characters that are not printable or are CSV separators are replaced by
+// '.'.
+func Text(data []byte) string {
+	return strings.Map(func(c rune) rune {
+		if c < 0x20 || c > 0x7E || c == ',' || c == '"' {
+			return '.'
+		}
+		return c
+	}, strings.TrimRight(string(data), "\x00"))
+}
+
+func decodeText(data []byte) ([]*ioamAPI.OSSField, error) {
+	return []*ioamAPI.OSSField{{Name: "text", Value: Text(data)}}, nil
+}
+
+func decodeKeyValues(data []byte) ([]*ioamAPI.OSSField, error) {
+	var fields []*ioamAPI.OSSField
+	pairs := strings.FieldsFunc(string(data), func(c rune) bool {
+		return c == ';' || c == ',' || c == ' ' || c == 0
+	})
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		fields = append(fields, &ioamAPI.OSSField{Name: Text([]byte(key)), Value: Text([]byte(value))})
+	}
+	return fields, nil
+}
+
+// words returns a decoder of big-endian counters of the given size.
+func words(size int) Decoder {
+	return DecoderFunc(func(data []byte) ([]*ioamAPI.OSSField, error) {
+		if len(data)%size != 0 {
+			return nil, ErrAlignment
+		}
+		fields := make([]*ioamAPI.OSSField, 0, len(data)/size)
+		for i := 0; i < len(data); i += size {
+			fields = append(fields, &ioamAPI.OSSField{
+				Name:  strconv.Itoa(i / size),
+				Value: strconv.FormatUint(bigEndian(data[i:i+size]), 10),
+			})
+		}
+		return fields, nil
+	})
+}
+
+// bigEndian returns the big-endian unsigned integer of up to 8 octets.
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// Layout decodes the fields described in the configuration file, checked
+// by the config package.
+type Layout []config.OSSField
+
+func (l Layout) Decode(data []byte) ([]*ioamAPI.OSSField, error) {
+	fields := make([]*ioamAPI.OSSField, 0, len(l))
+	for _, f := range l {
+		end := f.Offset + f.Width
+		if f.Width == 0 {
+			end = len(data)
+		}
+		if f.Offset > len(data) || end > len(data) {
+			return nil, fmt.Errorf("%s: %w", f.Name, ErrShortData)
+		}
+		b := data[f.Offset:end]
+
+		var value string
+		switch f.Type {
+		case config.OSSTypeUint:
+			value = strconv.FormatUint(bigEndian(b), 10)
+		case config.OSSTypeInt:
+			// Sign-extend from the width of the field
+			shift := 64 - 8*len(b)
+			value = strconv.FormatInt(int64(bigEndian(b)<<shift)>>shift, 10)
+		case config.OSSTypeASCII:
+			value = Text(b)
+		case config.OSSTypeIPv4, config.OSSTypeIPv6:
+			value = net.IP(b).String()
+		default:
+			value = hex.EncodeToString(b)
+		}
+		fields = append(fields, &ioamAPI.OSSField{Name: f.Name, Value: value})
+	}
+	return fields, nil
+}
+
+// counters are the snapshots of a schema seen.
+type counters struct {
+	decoded uint64
+	failed  uint64
+}
+
+// Registry holds the decoders of the known schemas, by schema ID.
+type Registry struct {
+	decoders map[uint32]Decoder
+
+	mu    sync.Mutex
+	stats map[uint32]*counters
+}
+
+// NewRegistry returns a registry of the schemas of the configuration file,
+// nil if there is none.
+func NewRegistry(schemas map[uint32]config.OSSSchemaConfig) (*Registry, error) {
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+	r := &Registry{
+		decoders: make(map[uint32]Decoder, len(schemas)),
+		stats:    make(map[uint32]*counters),
+	}
+	for schema, cfg := range schemas {
+		if cfg.Builtin == "" {
+			r.Register(schema, Layout(cfg.Fields))
+			continue
+		}
+		d, ok := Builtins[cfg.Builtin]
+		if !ok {
+			return nil, fmt.Errorf("OSS schema %d: unknown built-in decoder %q", schema, cfg.Builtin)
+		}
+		r.Register(schema, d)
+	}
+	return r, nil
+}
+
+// Register sets the decoder of a schema. It must be called before the
+// registry is used.
+func (r *Registry) Register(schema uint32, d Decoder) {
+	r.decoders[schema] = d
+}
+
+// Decode sets the fields of the snapshots of the trace with a known schema.
+// The snapshots that cannot be decoded are left as is.
+func (r *Registry) Decode(trace *report.Trace) {
+	for _, node := range trace.GetNodes() {
+		oss := node.GetOSS()
+		if oss == nil {
+			continue
+		}
+		d, ok := r.decoders[oss.GetSchemaId()]
+		if !ok {
+			continue
+		}
+		fields, err := d.Decode(oss.GetData())
+		r.count(oss.GetSchemaId(), err == nil)
+		if err == nil {
+			oss.Fields = fields
+		}
+	}
+}
+
+func (r *Registry) count(schema uint32, decoded bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.stats[schema]
+	if !ok {
+		c = &counters{}
+		r.stats[schema] = c
+	}
+	if decoded {
+		c.decoded++
+	} else {
+		c.failed++
+	}
+}
+
+// WriteStats writes one line per known schema seen, with the number of
+// snapshots decoded and of those that could not be.
+func (r *Registry) WriteStats(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schemas := make([]uint32, 0, len(r.stats))
+	for schema := range r.stats {
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i] < schemas[j] })
+
+	for _, schema := range schemas {
+		c := r.stats[schema]
+		fmt.Fprintf(w, "oss schema=%d decoded=%d failed=%d\n", schema, c.decoded, c.failed)
+	}
+}
@@ -0,0 +1,72 @@
+package oss
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func TestDecoders(t *testing.T) {
+	layout := Layout{
+		{Name: "cpu", Offset: 0, Width: 1, Type: config.OSSTypeUint},
+		{Name: "temperature", Offset: 2, Width: 2, Type: config.OSSTypeInt},
+		{Name: "gateway", Offset: 4, Width: 4, Type: config.OSSTypeIPv4},
+		{Name: "label", Offset: 8, Type: config.OSSTypeASCII},
+	}
+	tests := []struct {
+		name    string
+		decoder Decoder
+		data    []byte
+		want    []string // name=value
+		err     error
+	}{
+		{"layout", layout, []byte{3, 0, 0xFF, 0xF6, 192, 0, 2, 1, 'e', 'd', ',', 'e', 0, 0, 0, 0}, []string{"cpu=3", "temperature=-10", "gateway=192.0.2.1", "label=ed.e"}, nil},
+		{"short layout", layout, []byte{3, 0, 0, 1}, nil, ErrShortData},
+		{"text", Builtins["text"], []byte("up\x00\x00"), []string{"text=up"}, nil},
+		{"kv", Builtins["kv"], []byte("load=3;state=ok\x00"), []string{"load=3", "state=ok"}, nil},
+		{"uint32", Builtins["uint32"], []byte{0, 0, 0, 1, 0, 0, 1, 0}, []string{"0=1", "1=256"}, nil},
+		{"unaligned uint64", Builtins["uint64"], []byte{0, 0, 0, 1}, nil, ErrAlignment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := tt.decoder.Decode(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("%d fields, want %d", len(fields), len(tt.want))
+			}
+			for i, f := range fields {
+				if got := f.GetName() + "=" + f.GetValue(); got != tt.want[i] {
+					t.Errorf("field %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if _, err := NewRegistry(map[uint32]config.OSSSchemaConfig{1: {Builtin: "unknown"}}); err == nil {
+		t.Error("unknown built-in decoder accepted")
+	}
+
+	r, err := NewRegistry(map[uint32]config.OSSSchemaConfig{7: {Builtin: "uint32"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := &ioamAPI.Opaque{SchemaId: 7, Data: []byte{0, 0, 0, 5}}
+	other := &ioamAPI.Opaque{SchemaId: 8, Data: []byte{0, 0, 0, 5}}
+	r.Decode(&report.Trace{IOAMTrace: &ioamAPI.IOAMTrace{
+		Nodes: []*ioamAPI.IOAMNode{{OSS: known}, {OSS: other}, {}},
+	}})
+	if len(known.GetFields()) != 1 || known.GetFields()[0].GetValue() != "5" {
+		t.Errorf("known schema decoded as %v", known.GetFields())
+	}
+	if len(other.GetFields()) != 0 {
+		t.Errorf("unknown schema decoded as %v", other.GetFields())
+	}
+}
@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// fillChecksum sets c from a decoded trace option with the Checksum
+// Complement, appending the indexes of the mismatching nodes to
+// mismatches[:0], and from the verification of the upper-layer checksum of
+// the packet.
+func fillChecksum(c *ioamAPI.Checksum, t *ioam.Trace, mismatches []uint32, verified, valid bool) {
+	mismatches = mismatches[:0]
+	for i := range t.Nodes {
+		if t.Nodes[i].ChecksumMismatch() {
+			mismatches = append(mismatches, uint32(i))
+		}
+	}
+	c.Mismatches = mismatches
+	c.Verified = verified
+	c.Valid = valid
+}
+
+// upperLayerChecksum verifies the TCP or UDP checksum (RFC 8200 section
+// 8.1) of the IPv6 packet starting at ip. It is not verified for the other
+// upper-layer protocols, fragments, truncated packets, jumbograms, routing
+// headers other than the Segment Routing Header, and UDP checksums of 0.
+//
+// The IOAM data of the Hop-by-Hop Options header are not covered by the
+// checksum: an invalid one means that the packet was corrupted on the path.
+func upperLayerChecksum(ip []byte) (verified, valid bool) {
+	if len(ip) < 40 {
+		return false, false
+	}
+	length := int(ip[4])<<8 | int(ip[5])
+	if length == 0 || 40+length > len(ip) {
+		return false, false
+	}
+	ip = ip[:40+length]
+	dst := ip[24:40]
+
+	next := layers.IPProtocol(ip[6])
+	offset := 40
+	for next == layers.IPProtocolIPv6HopByHop || next == layers.IPProtocolIPv6Destination || next == layers.IPProtocolIPv6Routing {
+		if offset+8 > len(ip) || offset+(int(ip[offset+1])+1)*8 > len(ip) {
+			return false, false
+		}
+		if next == layers.IPProtocolIPv6Routing {
+			// The pseudo-header holds the final destination, the first
+			// segment of a Segment Routing Header (RFC 8754)
+			if ip[offset+2] != 4 || ip[offset+1] < 2 {
+				return false, false
+			}
+			dst = ip[offset+8 : offset+24]
+		}
+		next = layers.IPProtocol(ip[offset])
+		offset += (int(ip[offset+1]) + 1) * 8
+	}
+
+	segment := ip[offset:]
+	switch next {
+	case layers.IPProtocolTCP:
+		if len(segment) < 20 {
+			return false, false
+		}
+	case layers.IPProtocolUDP:
+		if len(segment) < 8 || segment[6] == 0 && segment[7] == 0 {
+			return false, false
+		}
+		udpLen := int(binary.BigEndian.Uint16(segment[4:6]))
+		if udpLen < 8 || udpLen > len(segment) {
+			return false, false
+		}
+		segment = segment[:udpLen]
+	default:
+		return false, false
+	}
+
+	var pseudo [8]byte
+	binary.BigEndian.PutUint32(pseudo[:4], uint32(len(segment)))
+	pseudo[7] = byte(next)
+	sum := ioam.Checksum(0, ip[8:24])
+	sum = ioam.Checksum(sum, dst)
+	sum = ioam.Checksum(sum, pseudo[:])
+	sum = ioam.Checksum(sum, segment)
+	return true, sum == 0xFFFF
+}
+
+const (
+	maxChecksumNodes = 4096             // Nodes in the checksum statistics, the others are counted as untracked
+	checksumTTL      = 10 * time.Minute // Nodes not seen for that long are forgotten
+)
+
+// checksumNode identifies a node in the checksum statistics.
+type checksumNode struct {
+	namespace uint32
+	id        uint64
+}
+
+// checksumCounters are the traces with the Checksum Complement of a node.
+type checksumCounters struct {
+	traces     uint64
+	mismatches uint64
+	lastSeen   time.Time
+}
+
+var (
+	checksumVerified atomic.Uint64 // Traces whose upper-layer checksum was verified
+	checksumInvalid  atomic.Uint64 // Of which with an invalid checksum
+
+	checksumMu        sync.Mutex
+	checksumNodes     = make(map[checksumNode]*checksumCounters)
+	checksumUntracked uint64 // Nodes of traces not counted, maxChecksumNodes being reached
+)
+
+func countChecksum(trace *ioamAPI.IOAMTrace) {
+	c := trace.GetChecksum()
+	if c == nil {
+		return
+	}
+	if c.GetVerified() {
+		checksumVerified.Add(1)
+		if !c.GetValid() {
+			checksumInvalid.Add(1)
+		}
+	}
+
+	t := report.Trace{IOAMTrace: trace}
+	mismatches := c.GetMismatches()
+	now := time.Now()
+
+	checksumMu.Lock()
+	defer checksumMu.Unlock()
+
+	for i, node := range trace.GetNodes() {
+		// Mismatches are in node order
+		mismatch := len(mismatches) > 0 && mismatches[0] == uint32(i)
+		if mismatch {
+			mismatches = mismatches[1:]
+		}
+
+		key := checksumNode{namespace: trace.GetNamespaceId(), id: t.NodeID(node)}
+		counters, ok := checksumNodes[key]
+		if !ok {
+			if len(checksumNodes) >= maxChecksumNodes {
+				pruneChecksumNodes(now)
+			}
+			if len(checksumNodes) >= maxChecksumNodes {
+				checksumUntracked++
+				continue
+			}
+			counters = &checksumCounters{}
+			checksumNodes[key] = counters
+		}
+		counters.traces++
+		counters.lastSeen = now
+		if mismatch {
+			counters.mismatches++
+		}
+	}
+}
+
+// pruneChecksumNodes forgets the nodes not seen for checksumTTL, with
+// checksumMu held.
+func pruneChecksumNodes(now time.Time) {
+	for key, counters := range checksumNodes {
+		if now.Sub(counters.lastSeen) > checksumTTL {
+			delete(checksumNodes, key)
+		}
+	}
+}
+
+// WriteChecksumStats writes the number of traces whose upper-layer checksum
+// was verified, of which invalid, the number of nodes not counted past
+// maxChecksumNodes, and one line per node recently seen in traces with the
+// Checksum Complement, with the number of its data that were not
+// checksum-neutral.
+func WriteChecksumStats(w io.Writer) {
+	checksumMu.Lock()
+	defer checksumMu.Unlock()
+
+	fmt.Fprintf(w, "checksum verified=%d invalid=%d untracked=%d\n", checksumVerified.Load(), checksumInvalid.Load(), checksumUntracked)
+	pruneChecksumNodes(time.Now())
+
+	nodes := make([]checksumNode, 0, len(checksumNodes))
+	for node := range checksumNodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].namespace != nodes[j].namespace {
+			return nodes[i].namespace < nodes[j].namespace
+		}
+		return nodes[i].id < nodes[j].id
+	})
+
+	for _, node := range nodes {
+		c := checksumNodes[node]
+		fmt.Fprintf(w, "checksum ns=%d node=%d traces=%d mismatches=%d\n", node.namespace, node.id, c.traces, c.mismatches)
+	}
+}
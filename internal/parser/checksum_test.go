@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func TestChecksumMismatches(t *testing.T) {
+	typ := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeChecksumComplement | ioam.TraceTypeOSS
+	trace := &ioam.Trace{Namespace: 123, Type: typ, Nodes: make([]ioam.Node, 4)}
+	for i := range trace.Nodes {
+		node := &trace.Nodes[i]
+		node.HopLimit, node.ID = uint8(64-i), uint32(i+1)
+		node.OSS = &ioam.OSS{SchemaID: 7, Data: []byte{1, 2, 3, byte(i)}}
+		node.SetChecksumComplement(typ)
+	}
+	trace.Nodes[1].OSS.Data = []byte{9, 9, 9, 9} // Changed after its complement
+	trace.Nodes[2].ChecksumComplement = 0        // Upper-layer checksum updated instead
+	trace.Nodes[3].ChecksumComplement = 0x00010000
+
+	data, err := ioam.AppendTrace(nil, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traces, err := parseHopByHop(hopByHop(t, data), false)
+	if err != nil || len(traces) != 1 {
+		t.Fatalf("parseHopByHop() = %d traces, error %v", len(traces), err)
+	}
+	if got, want := traces[0].GetChecksum().GetMismatches(), []uint32{1, 3}; !slices.Equal(got, want) {
+		t.Errorf("mismatches %v, want %v", got, want)
+	}
+}
+
+func TestChecksumNodes(t *testing.T) {
+	checksumMu.Lock()
+	saved, savedUntracked := checksumNodes, checksumUntracked
+	checksumNodes, checksumUntracked = make(map[checksumNode]*checksumCounters), 0
+	checksumMu.Unlock()
+	t.Cleanup(func() {
+		checksumMu.Lock()
+		checksumNodes, checksumUntracked = saved, savedUntracked
+		checksumMu.Unlock()
+	})
+
+	count := func(ns uint32, ids ...uint32) {
+		trace := &ioamAPI.IOAMTrace{
+			NamespaceId: ns,
+			BitField:    uint32(ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeChecksumComplement),
+			Checksum:    &ioamAPI.Checksum{Mismatches: []uint32{0}},
+		}
+		for _, id := range ids {
+			trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: id})
+		}
+		countChecksum(trace)
+	}
+
+	for id := range uint32(maxChecksumNodes) {
+		count(2, id)
+	}
+	count(2, 0, maxChecksumNodes) // The known node is still counted
+	if len(checksumNodes) != maxChecksumNodes || checksumUntracked != 1 {
+		t.Fatalf("%d nodes, %d untracked, want %d and 1", len(checksumNodes), checksumUntracked, maxChecksumNodes)
+	}
+	if c := checksumNodes[checksumNode{namespace: 2, id: 0}]; c.traces != 2 || c.mismatches != 2 {
+		t.Errorf("node 0: %d traces, %d mismatches, want 2 and 2", c.traces, c.mismatches)
+	}
+
+	// Nodes not seen recently make room for new ones
+	for key, c := range checksumNodes {
+		if key.id != 0 {
+			c.lastSeen = time.Now().Add(-checksumTTL - time.Second)
+		}
+	}
+	count(1, 5)
+	if len(checksumNodes) != 2 || checksumUntracked != 1 {
+		t.Fatalf("%d nodes, %d untracked after pruning, want 2 and 1", len(checksumNodes), checksumUntracked)
+	}
+
+	var buf bytes.Buffer
+	WriteChecksumStats(&buf)
+	want := []string{"untracked=1", "checksum ns=1 node=5 traces=1 mismatches=1\nchecksum ns=2 node=0 traces=2 mismatches=2\n"}
+	for _, s := range want {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("WriteChecksumStats() = %q, want %q", buf.String(), s)
+		}
+	}
+}
+
+func TestUpperLayerChecksum(t *testing.T) {
+	hbh := hopByHop(t, encodeTrace(t, ioam.TraceTypeHopLimitNodeID|ioam.TraceTypeChecksumComplement, nil, 1))
+	udp := []byte{0x12, 0x34, 0x56, 0x78, 0, 12, 0, 0, 0xde, 0xad, 0xbe, 0xef}
+	srh := []byte{byte(layers.IPProtocolUDP), 2, 4, 0, 0, 0, 0, 0, 0xdb, 0x03, 23: 1}
+	fragment := []byte{byte(layers.IPProtocolUDP), 0, 0, 1, 0, 0, 0, 1}
+	dst := testIPv6(t, layers.IPProtocolUDP, 1)[24:40]
+
+	tests := []struct {
+		name     string
+		ip       []byte // Without the Ethernet header
+		final    []byte // Destination of the pseudo-header
+		corrupt  bool
+		verified bool
+	}{
+		{"valid", testPacket(t, 0, hbh, layers.IPProtocolUDP, udp)[14:], dst, false, true},
+		{"corrupted", testPacket(t, 0, hbh, layers.IPProtocolUDP, udp)[14:], dst, true, true},
+		{"segment routing", testPacket(t, 0, hbh, layers.IPProtocolIPv6Routing, srh, udp)[14:], srh[8:24], false, true},
+		{"fragment", testPacket(t, 0, hbh, layers.IPProtocolIPv6Fragment, fragment, udp)[14:], nil, false, false},
+		{"truncated", testPacket(t, 0, hbh, layers.IPProtocolUDP, udp)[14:60], nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.verified {
+				setUDPChecksum(tt.ip[len(tt.ip)-len(udp):], tt.ip[8:24], tt.final)
+			}
+			if tt.corrupt {
+				tt.ip[len(tt.ip)-1] ^= 0x01
+			}
+			verified, valid := upperLayerChecksum(tt.ip)
+			if verified != tt.verified || valid != (tt.verified && !tt.corrupt) {
+				t.Errorf("verified %v, valid %v, want %v, %v", verified, valid, tt.verified, tt.verified && !tt.corrupt)
+			}
+		})
+	}
+
+	// A UDP checksum of 0 is not verified
+	if verified, _ := upperLayerChecksum(testPacket(t, 0, hbh, layers.IPProtocolUDP, udp)[14:]); verified {
+		t.Error("UDP checksum of 0 verified")
+	}
+}
+
+// setUDPChecksum sets the checksum of a UDP datagram sent from src to dst.
+func setUDPChecksum(udp, src, dst []byte) {
+	udp[6], udp[7] = 0, 0
+	pseudo := []byte{0, 0, 0, byte(len(udp)), 0, 0, 0, byte(layers.IPProtocolUDP)}
+	sum := ioam.Checksum(0, src)
+	sum = ioam.Checksum(sum, dst)
+	sum = ioam.Checksum(sum, pseudo)
+	sum = ioam.Checksum(sum, udp)
+	binary.BigEndian.PutUint16(udp[6:], ^sum)
+}
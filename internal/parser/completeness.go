@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// fillCompleteness sets c from a decoded trace option of the given type,
+// appending the gaps to gaps[:0].
+//
+// A gap is the number of hops between two consecutive nodes that did not
+// add their data (e.g. transit nodes without IOAM), i.e. the decrease of
+// the hop limit minus one. Gaps are only known if the trace type has a hop
+// limit; a hop limit that does not decrease (e.g. reset by an
+// encapsulating node) counts as no gap. The trace is undersized if a node
+// found no room left (overflow flag), see also setUndersized.
+func fillCompleteness(c *ioamAPI.Completeness, t *ioam.Trace, optType ioam.OptionType, gaps []uint32) {
+	c.Preallocated = optType == ioam.OptionPreallocatedTrace
+	c.Filled = uint32(len(t.Nodes))
+	c.Allocated = c.Filled + uint32(t.FreeNodes())
+	c.Missing = 0
+	c.Undersized = t.Flags&ioam.FlagOverflow != 0
+
+	gaps = gaps[:0]
+	if t.Type&(ioam.TraceTypeHopLimitNodeID|ioam.TraceTypeHopLimitNodeIDWide) != 0 {
+		for i := 1; i < len(t.Nodes); i++ {
+			var gap uint32
+			if prev, hl := t.Nodes[i-1].HopLimit, t.Nodes[i].HopLimit; prev > hl {
+				gap = uint32(prev-hl) - 1
+			}
+			gaps = append(gaps, gap)
+			c.Missing += gap
+		}
+	}
+	c.Gaps = gaps
+}
+
+// setUndersized also reports the trace option as too small for the path
+// when the trace is full and the hop limit of the packet, hopLimit, shows
+// that more hops forwarded it since the first node than it has node slots. Every node records the hop
+// limit of the packet it forwards, so that the hops from the first node to
+// the agent are the decrease of the hop limit plus one. Hop limits that do
+// not decrease (e.g. reset by an encapsulating node) say nothing.
+func setUndersized(trace *ioamAPI.IOAMTrace, hopLimit uint8) {
+	c := trace.GetCompleteness()
+	if c == nil {
+		return
+	}
+	nodes := trace.GetNodes()
+	if c.Undersized || len(nodes) == 0 || c.GetFilled() < c.GetAllocated() ||
+		ioam.TraceType(trace.GetBitField())&(ioam.TraceTypeHopLimitNodeID|ioam.TraceTypeHopLimitNodeIDWide) == 0 {
+		return
+	}
+	first, last := nodes[0].GetHopLimit(), nodes[len(nodes)-1].GetHopLimit()
+	if first < last || last < uint32(hopLimit) {
+		return
+	}
+	c.Undersized = first-uint32(hopLimit)+1 > c.GetAllocated()
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+)
+
+func TestCompleteness(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceType   ioam.TraceType
+		remLen      uint8
+		hopLimits   []uint8 // In path order
+		allocated   uint32
+		wantGaps    []uint32
+		wantMissing uint32
+	}{
+		{"full", ioam.TraceTypeHopLimitNodeID, 0, []uint8{64, 63, 62}, 3, []uint32{0, 0}, 0},
+		{"partial", ioam.TraceTypeHopLimitNodeID, 5, []uint8{64, 63}, 7, []uint32{0}, 0},
+		{"one gap", ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeInterfaceIDs, 4, []uint8{64, 61, 60}, 5, []uint32{2, 0}, 2},
+		{"gaps", ioam.TraceTypeHopLimitNodeIDWide, 0, []uint8{255, 250, 249, 240}, 4, []uint32{4, 0, 8}, 12},
+		{"hop limit reset", ioam.TraceTypeHopLimitNodeID, 0, []uint8{2, 64, 63}, 3, []uint32{0, 0}, 0},
+		{"no hop limit", ioam.TraceTypeQueueDepth, 3, []uint8{64, 60}, 5, nil, 0},
+		{"OSS", ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeOSS, 5, []uint8{64}, 3, nil, 0},
+		{"single node", ioam.TraceTypeHopLimitNodeID, 1, []uint8{64}, 2, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := &ioam.Trace{Namespace: 123, RemLen: tt.remLen, Type: tt.traceType}
+			for _, hl := range tt.hopLimits {
+				trace.Nodes = append(trace.Nodes, ioam.Node{HopLimit: hl, ID: 1, QueueDepth: 1})
+			}
+			data, err := ioam.AppendTrace(nil, trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			traces, err := parseHopByHop(hopByHop(t, data), false)
+			if err != nil || len(traces) != 1 {
+				t.Fatalf("parseHopByHop() = %d traces, error %v", len(traces), err)
+			}
+			c := traces[0].GetCompleteness()
+			if !c.GetPreallocated() {
+				t.Error("pre-allocated trace not reported as such")
+			}
+			if c.GetFilled() != uint32(len(tt.hopLimits)) || c.GetAllocated() != tt.allocated {
+				t.Errorf("filled %d/%d, want %d/%d", c.GetFilled(), c.GetAllocated(), len(tt.hopLimits), tt.allocated)
+			}
+			if !slices.Equal(c.GetGaps(), tt.wantGaps) || c.GetMissing() != tt.wantMissing {
+				t.Errorf("gaps %v (missing %d), want %v (missing %d)", c.GetGaps(), c.GetMissing(), tt.wantGaps, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestUndersized(t *testing.T) {
+	tests := []struct {
+		name      string
+		traceType ioam.TraceType
+		flags     ioam.Flags
+		remLen    uint8
+		hopLimits []uint8 // In path order
+		packet    uint8   // Hop limit of the packet at the agent
+		want      bool
+	}{
+		{"full", ioam.TraceTypeHopLimitNodeID, 0, 0, []uint8{64, 63, 62}, 62, false},
+		{"hops after a full trace", ioam.TraceTypeHopLimitNodeID, 0, 0, []uint8{64, 63, 62}, 60, true},
+		{"gaps within a full trace", ioam.TraceTypeHopLimitNodeID, 0, 0, []uint8{64, 61, 60}, 60, true},
+		{"free slots", ioam.TraceTypeHopLimitNodeID, 0, 2, []uint8{64, 63, 62}, 50, false},
+		{"overflow", ioam.TraceTypeHopLimitNodeID, ioam.FlagOverflow, 0, []uint8{64}, 64, true},
+		{"no hop limit", ioam.TraceTypeQueueDepth, 0, 0, []uint8{64, 63}, 50, false},
+		{"hop limit reset", ioam.TraceTypeHopLimitNodeIDWide, 0, 0, []uint8{2, 64}, 50, false},
+		{"hop limit reset after the trace", ioam.TraceTypeHopLimitNodeID, 0, 0, []uint8{64, 63}, 64, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := &ioam.Trace{Namespace: 123, Flags: tt.flags, RemLen: tt.remLen, Type: tt.traceType}
+			for _, hl := range tt.hopLimits {
+				trace.Nodes = append(trace.Nodes, ioam.Node{HopLimit: hl, ID: 1, QueueDepth: 1})
+			}
+			data, err := ioam.AppendTrace(nil, trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet := testPacket(t, 0, hopByHop(t, data), layers.IPProtocolNoNextHeader)
+			packet[14+7] = tt.packet
+
+			traces := decodePackets([][]byte{packet}, false)
+			ParsePacket(gopacket.NewPacket(packet, layers.LinkTypeEthernet, gopacket.Default), false, func(trace *report.Trace) {
+				traces = append(traces, trace.IOAMTrace)
+			})
+			if len(traces) != 2 {
+				t.Fatalf("%d traces, want 1 from each parser", len(traces))
+			}
+			for _, trace := range traces {
+				if got := trace.GetCompleteness().GetUndersized(); got != tt.want {
+					t.Errorf("undersized %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
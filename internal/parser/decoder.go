@@ -0,0 +1,342 @@
+package parser
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/internal/stats"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// maxHeaders is the maximum number of nested IPv6 headers of a packet.
+const maxHeaders = 4
+
+var (
+	errIPv6Truncated = errors.New("Truncated IPv6 header")
+	errIPv6Nested    = errors.New("Too many nested IPv6 headers")
+)
+
+// ipv6Header is what the flow of a packet needs from an IPv6 header.
+type ipv6Header struct {
+	src, dst  []byte
+	flowLabel uint32
+	next      layers.IPProtocol // After the extension headers
+	srcPort   uint16
+	dstPort   uint16
+	packet    []byte // From the IPv6 header, for the upper-layer checksum
+}
+
+// ipv6Layer is a DecodingLayer for IPv6 that skips the extension headers
+// without allocating. It is decoded again for every encapsulated IPv6
+// header, which are all recorded.
+type ipv6Layer struct {
+	headers  []ipv6Header
+	hopByHop []byte // Of the outermost header, nil if none
+	hopLimit uint8  // Of the IPv6 header of hopByHop
+	payload  []byte
+	next     gopacket.LayerType
+}
+
+func (l *ipv6Layer) reset() {
+	l.headers = l.headers[:0]
+	l.hopByHop = nil
+}
+
+func (l *ipv6Layer) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeIPv6
+}
+
+func (l *ipv6Layer) NextLayerType() gopacket.LayerType {
+	return l.next
+}
+
+func (l *ipv6Layer) LayerPayload() []byte {
+	return l.payload
+}
+
+func (l *ipv6Layer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 40 {
+		df.SetTruncated()
+		return errIPv6Truncated
+	}
+	if len(l.headers) == maxHeaders {
+		return errIPv6Nested
+	}
+	// Drop the link layer padding, a length of 0 being a jumbogram
+	if length := int(data[4])<<8 | int(data[5]); length != 0 && 40+length <= len(data) {
+		data = data[:40+length]
+	}
+	h := ipv6Header{
+		packet:    data,
+		src:       data[8:24],
+		dst:       data[24:40],
+		flowLabel: uint32(data[1]&0x0F)<<16 | uint32(data[2])<<8 | uint32(data[3]),
+		next:      layers.IPProtocol(data[6]),
+	}
+	l.next = gopacket.LayerTypePayload
+
+	var hopByHop []byte
+	var offset int
+	h.next, offset, hopByHop = skipExtensions(data, 40, h.next)
+	if l.hopByHop == nil {
+		l.hopByHop = hopByHop
+		l.hopLimit = data[7]
+	}
+	l.headers = append(l.headers, h)
+	if offset < 0 {
+		return nil
+	}
+	l.payload = data[offset:]
+	switch h.next {
+	case layers.IPProtocolIPv6, layers.IPProtocolTCP, layers.IPProtocolUDP:
+		l.next = h.next.LayerType()
+	}
+	return nil
+}
+
+// skipExtensions skips the IPv6 extension headers from offset, next being
+// the type of the first one. It returns the upper-layer protocol and the
+// offset of its header, -1 if the header is not in data (truncated packet
+// or fragment other than the first), and the first Hop-by-Hop Options
+// header, nil if none.
+func skipExtensions(data []byte, offset int, next layers.IPProtocol) (layers.IPProtocol, int, []byte) {
+	var hopByHop []byte
+
+	// Same extension headers as the flows of ParsePacket
+	for {
+		switch next {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Destination, layers.IPProtocolIPv6Routing:
+			if offset+8 > len(data) || offset+(int(data[offset+1])+1)*8 > len(data) {
+				return next, -1, hopByHop
+			}
+			end := offset + (int(data[offset+1])+1)*8
+			if next == layers.IPProtocolIPv6HopByHop && hopByHop == nil {
+				hopByHop = data[offset:end]
+			}
+			next = layers.IPProtocol(data[offset])
+			offset = end
+		case layers.IPProtocolIPv6Fragment:
+			if offset+8 > len(data) {
+				return next, -1, hopByHop
+			}
+			next = layers.IPProtocol(data[offset])
+			// Only the first fragment holds the upper-layer header
+			if data[offset+2] != 0 || data[offset+3]&0xF8 != 0 {
+				return next, -1, hopByHop
+			}
+			offset += 8
+		default:
+			return next, offset, hopByHop
+		}
+	}
+}
+
+// pooledTrace is a trace whose messages and buffers are reused for the next
+// packets once reported, unless retained.
+type pooledTrace struct {
+	report.Trace
+
+	msg   ioamAPI.IOAMTrace
+	nodes []ioamAPI.IOAMNode
+	ptrs  []*ioamAPI.IOAMNode
+	oss   []ioamAPI.Opaque
+	flows [maxHeaders]ioamAPI.Flow
+	comp  ioamAPI.Completeness
+	gaps  []uint32
+	csum  ioamAPI.Checksum
+	mism  []uint32 // Nodes whose checksum mismatches
+	buf   []byte   // Copies of the byte fields, the packet data being reused
+}
+
+var tracePool = sync.Pool{
+	New: func() any { return &pooledTrace{} },
+}
+
+// copyBytes returns a copy of b in the buffer of the trace.
+func (p *pooledTrace) copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	start := len(p.buf)
+	p.buf = append(p.buf, b...)
+	return p.buf[start:len(p.buf):len(p.buf)]
+}
+
+// fill sets the trace from the decoded option of the given type and the
+// flow of the packet.
+func (p *pooledTrace) fill(t *ioam.Trace, optType ioam.OptionType, headers []ipv6Header) {
+	p.Trace = report.Trace{IOAMTrace: &p.msg}
+	p.msg.Reset()
+	p.buf = p.buf[:0]
+
+	if cap(p.nodes) < len(t.Nodes) {
+		p.nodes = make([]ioamAPI.IOAMNode, len(t.Nodes))
+		p.ptrs = make([]*ioamAPI.IOAMNode, len(t.Nodes))
+		p.oss = make([]ioamAPI.Opaque, len(t.Nodes))
+	}
+	p.ptrs = p.ptrs[:len(t.Nodes)]
+
+	for i := range t.Nodes {
+		n, node := &t.Nodes[i], &p.nodes[i]
+		node.Reset()
+		node.HopLimit = uint32(n.HopLimit)
+		node.Id = n.ID
+		node.IngressId = uint32(n.IngressID)
+		node.EgressId = uint32(n.EgressID)
+		node.TimestampSecs = n.TimestampSecs
+		node.TimestampFrac = n.TimestampFrac
+		node.TransitDelay = n.TransitDelay
+		node.NamespaceData = p.copyBytes(n.NamespaceData)
+		node.QueueDepth = n.QueueDepth
+		node.CsumComp = n.ChecksumComplement
+		node.IdWide = n.IDWide
+		node.IngressIdWide = n.IngressIDWide
+		node.EgressIdWide = n.EgressIDWide
+		node.NamespaceDataWide = p.copyBytes(n.NamespaceDataWide)
+		node.BufferOccupancy = n.BufferOccupancy
+		if n.OSS != nil {
+			oss := &p.oss[i]
+			oss.Reset()
+			oss.SchemaId = n.OSS.SchemaID
+			oss.Data = p.copyBytes(n.OSS.Data)
+			node.OSS = oss
+		}
+		p.ptrs[i] = node
+	}
+
+	p.msg.NamespaceId = uint32(t.Namespace)
+	p.msg.BitField = uint32(t.Type)
+	p.msg.Nodes = p.ptrs
+	p.msg.Overflow = t.Flags&ioam.FlagOverflow != 0
+	p.msg.Loopback = t.Flags&ioam.FlagLoopback != 0
+	p.msg.Active = t.Flags&ioam.FlagActive != 0
+	p.comp.Reset()
+	fillCompleteness(&p.comp, t, optType, p.gaps)
+	p.gaps = p.comp.Gaps
+	p.msg.Completeness = &p.comp
+	if t.Type&ioam.TraceTypeChecksumComplement != 0 {
+		p.csum.Reset()
+		verified, valid := upperLayerChecksum(headers[len(headers)-1].packet)
+		fillChecksum(&p.csum, t, p.mism, verified, valid)
+		p.mism = p.csum.Mismatches
+		p.msg.Checksum = &p.csum
+	}
+
+	var outer *ioamAPI.Flow
+	for i := len(headers) - 1; i >= 0; i-- {
+		h, flow := &headers[i], &p.flows[i]
+		flow.Reset()
+		flow.SrcAddr = p.copyBytes(h.src)
+		flow.DstAddr = p.copyBytes(h.dst)
+		flow.NextHeader = uint32(h.next)
+		flow.SrcPort = uint32(h.srcPort)
+		flow.DstPort = uint32(h.dstPort)
+		flow.FlowLabel = h.flowLabel
+		flow.Inner = outer
+		outer = flow
+	}
+	p.msg.Flow = outer
+}
+
+// Decoder decodes the packets of an Ethernet link with a
+// DecodingLayerParser. Once warmed up, it allocates nothing for valid
+// packets: the layers and the decoded options are reused, and the reported
+// traces come from a pool. A Decoder must not be used concurrently.
+type Decoder struct {
+	parser  *gopacket.DecodingLayerParser
+	eth     layers.Ethernet
+	dot1q   layers.Dot1Q
+	ip6     ipv6Layer
+	tcp     layers.TCP
+	udp     layers.UDP
+	decoded []gopacket.LayerType
+
+	lenient bool
+	options []ioam.Option
+	trace   ioam.Trace
+}
+
+func NewDecoder(lenient bool) *Decoder {
+	d := &Decoder{lenient: lenient}
+	d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &d.eth, &d.dot1q, &d.ip6, &d.tcp, &d.udp)
+	d.parser.IgnoreUnsupported = true
+	return d
+}
+
+// Decode reports the IOAM traces of the packet to process, like
+// ParsePacket. The packet data can be reused once Decode returns, and so
+// can the traces that process does not retain (see report.Trace.Retain).
+func (d *Decoder) Decode(data []byte, process func(*report.Trace)) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicCount.Add(1)
+			log.Printf("[IOAM Agent] Recovered from a panic while handling a packet: %v", r)
+		}
+	}()
+
+	d.ip6.reset()
+	d.decoded = d.decoded[:0]
+	// Errors after the IPv6 headers only leave the ports unset
+	d.parser.DecodeLayers(data, &d.decoded)
+	if len(d.ip6.headers) == 0 {
+		return
+	}
+	atomic.AddUint64(&stats.Ipv6PacketCount, 1)
+	if d.ip6.hopByHop == nil {
+		return
+	}
+
+	headers := d.ip6.headers
+	last := &headers[len(headers)-1]
+	for _, typ := range d.decoded {
+		switch typ {
+		case layers.LayerTypeTCP:
+			last.srcPort, last.dstPort = uint16(d.tcp.SrcPort), uint16(d.tcp.DstPort)
+		case layers.LayerTypeUDP:
+			last.srcPort, last.dstPort = uint16(d.udp.SrcPort), uint16(d.udp.DstPort)
+		}
+	}
+
+	var err error
+	d.options, err = ioam.AppendOptions(d.options[:0], d.ip6.hopByHop)
+	if err != nil {
+		countMalformed(err)
+		log.Printf("Hop-by-Hop parse error: %v", err)
+		if !d.lenient {
+			return
+		}
+	}
+
+	for _, opt := range d.options {
+		if opt.Type != ioam.OptionPreallocatedTrace && opt.Type != ioam.OptionIncrementalTrace {
+			continue
+		}
+		atomic.AddUint64(&stats.IoamPacketCount, 1)
+
+		if err := d.trace.Decode(opt.Data, d.lenient); err != nil {
+			countMalformed(err)
+			log.Printf("Hop-by-Hop parse error: %v", err)
+			if !d.lenient || len(d.trace.Nodes) == 0 {
+				continue
+			}
+			salvagedCount.Add(1)
+		}
+
+		p := tracePool.Get().(*pooledTrace)
+		p.fill(&d.trace, opt.Type, headers)
+		setUndersized(&p.msg, d.ip6.hopLimit)
+		countFlags(&p.msg)
+		countChecksum(&p.msg)
+		process(&p.Trace)
+		if !p.Retained() {
+			tracePool.Put(p)
+		}
+	}
+}
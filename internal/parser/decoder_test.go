@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// testPackets returns the packets of the golden corpus and generated
+// packets covering the extension headers, the encapsulation and malformed
+// options.
+func testPackets(t testing.TB) [][]byte {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "*.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets [][]byte
+	for _, file := range files {
+		for _, packet := range readPcap(t, file) {
+			packets = append(packets, packet.Data())
+		}
+	}
+
+	typ := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeTimestampSecs | ioam.TraceTypeTimestampFrac | ioam.TraceTypeOSS
+	valid := hopByHop(t, encodeTrace(t, typ, &ioam.OSS{SchemaID: 1, Data: []byte{1, 2, 3, 4}}, 3))
+	truncated := hopByHop(t, encodeTrace(t, typ, nil, 2)[:20])
+	udp := []byte{0x12, 0x34, 0x56, 0x78, 0, 8, 0, 0}
+	tcp := make([]byte, 20)
+	copy(tcp, []byte{0x9a, 0xbc, 0xde, 0xf0})
+	tcp[12] = 5 << 4
+	fragment := []byte{byte(layers.IPProtocolUDP), 0, 0, 8, 0, 0, 0, 1}
+	routing := []byte{byte(layers.IPProtocolTCP), 0, 0, 0, 0, 0, 0, 0}
+	inner := append(testIPv6(t, layers.IPProtocolUDP, 2), udp...)
+	binary.BigEndian.PutUint16(inner[4:], uint16(len(udp)))
+
+	packets = append(packets,
+		testPacket(t, 0, valid, layers.IPProtocolUDP, udp),
+		testPacket(t, 0, valid, layers.IPProtocolIPv6Fragment, fragment, udp),
+		testPacket(t, 0, valid, layers.IPProtocolIPv6Routing, routing, tcp),
+		testPacket(t, 0, truncated, layers.IPProtocolUDP, udp),
+		testPacket(t, 0, mustHeader(t, []byte{ioam.IPv6OptionHopByHop, 0xF0, 0, 0}), layers.IPProtocolUDP, udp),
+		testPacket(t, 0, valid, layers.IPProtocolIPv6, inner),
+		testPacket(t, 100, valid, layers.IPProtocolUDP, udp),
+		testPacket(t, 0, valid[:len(valid)-8], layers.IPProtocolNoNextHeader),
+	)
+	return packets
+}
+
+// testIPv6 returns an IPv6 header whose addresses end with n.
+func testIPv6(t testing.TB, next layers.IPProtocol, n byte) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	ip := &layers.IPv6{
+		Version:    6,
+		FlowLabel:  0x12345,
+		NextHeader: next,
+		HopLimit:   64,
+		SrcIP:      net.IP{0xdb, 0x01, 15: n},
+		DstIP:      net.IP{0xdb, 0x02, 15: n},
+	}
+	if err := ip.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testPacket returns an Ethernet frame, with a VLAN tag if vlan is not 0,
+// holding an IPv6 packet with the Hop-by-Hop header, whose Next Header is
+// set to next, followed by the given headers.
+func testPacket(t testing.TB, vlan uint16, hbh []byte, next layers.IPProtocol, headers ...[]byte) []byte {
+	t.Helper()
+	data := []byte{0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 1}
+	if vlan != 0 {
+		data = append(data, 0x81, 0x00, byte(vlan>>8), byte(vlan))
+	}
+	data = append(data, 0x86, 0xdd)
+	ip := len(data)
+	data = append(data, testIPv6(t, layers.IPProtocolIPv6HopByHop, 1)...)
+
+	hbh = append([]byte(nil), hbh...)
+	hbh[0] = byte(next)
+	data = append(data, hbh...)
+	for _, h := range headers {
+		data = append(data, h...)
+	}
+	binary.BigEndian.PutUint16(data[ip+4:], uint16(len(data)-ip-40))
+	return data
+}
+
+// decodePackets returns copies of the traces reported by the Decoder.
+func decodePackets(packets [][]byte, lenient bool) []*ioamAPI.IOAMTrace {
+	var traces []*ioamAPI.IOAMTrace
+	d := NewDecoder(lenient)
+	for _, data := range packets {
+		d.Decode(data, func(trace *report.Trace) {
+			traces = append(traces, proto.Clone(trace.IOAMTrace).(*ioamAPI.IOAMTrace))
+		})
+	}
+	return traces
+}
+
+// TestDecoder checks that the Decoder reports the same traces as
+// ParsePacket, and does not change them once they are retained.
+func TestDecoder(t *testing.T) {
+	packets := testPackets(t)
+
+	for _, lenient := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lenient=%v", lenient), func(t *testing.T) {
+			var want []*ioamAPI.IOAMTrace
+			for _, data := range packets {
+				packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+				ParsePacket(packet, lenient, func(trace *report.Trace) {
+					want = append(want, trace.IOAMTrace)
+				})
+			}
+
+			got := decodePackets(packets, lenient)
+			if len(got) != len(want) {
+				t.Fatalf("%d traces, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if !proto.Equal(got[i], want[i]) {
+					t.Errorf("trace %d:\n got %v\nwant %v", i, got[i], want[i])
+				}
+			}
+
+			// Retained traces are never reused, even with the packet data
+			var retained []*report.Trace
+			d := NewDecoder(lenient)
+			for _, data := range packets {
+				buf := append([]byte(nil), data...)
+				d.Decode(buf, func(trace *report.Trace) {
+					trace.Retain()
+					retained = append(retained, trace)
+				})
+				for i := range buf {
+					buf[i] = 0xFF
+				}
+			}
+			for i := range retained {
+				if !proto.Equal(retained[i].IOAMTrace, want[i]) {
+					t.Errorf("retained trace %d:\n got %v\nwant %v", i, retained[i].IOAMTrace, want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestDecoderFlow checks the ports found after the extension headers that
+// the gopacket layers do not decode.
+func TestDecoderFlow(t *testing.T) {
+	hbh := hopByHop(t, encodeTrace(t, ioam.TraceTypeHopLimitNodeID, nil, 1))
+	udp := []byte{0x12, 0x34, 0x56, 0x78, 0, 8, 0, 0}
+	srh := []byte{byte(layers.IPProtocolUDP), 2, 4, 0, 0, 0, 0, 0, 0xdb, 0x03, 23: 1}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		port   uint32
+	}{
+		{"segment routing", testPacket(t, 0, hbh, layers.IPProtocolIPv6Routing, srh, udp), 0x1234},
+		{"first fragment", testPacket(t, 0, hbh, layers.IPProtocolIPv6Fragment, []byte{byte(layers.IPProtocolUDP), 0, 0, 1, 0, 0, 0, 1}, udp), 0x1234},
+		{"fragment", testPacket(t, 0, hbh, layers.IPProtocolIPv6Fragment, []byte{byte(layers.IPProtocolUDP), 0, 0, 8, 0, 0, 0, 1}, udp), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traces := decodePackets([][]byte{tt.packet}, false)
+			if len(traces) != 1 {
+				t.Fatalf("%d traces, want 1", len(traces))
+			}
+			flow := traces[0].GetFlow()
+			if flow.GetNextHeader() != uint32(layers.IPProtocolUDP) || flow.GetSrcPort() != tt.port {
+				t.Errorf("next header %d, source port %#x, want %d, %#x", flow.GetNextHeader(), flow.GetSrcPort(), layers.IPProtocolUDP, tt.port)
+			}
+		})
+	}
+}
+
+// BenchmarkParsePacket measures the decoding of the packets with all the
+// gopacket layers, as done for the link types other than Ethernet.
+func BenchmarkParsePacket(b *testing.B) {
+	packets := benchPackets(b)
+	process := func(*report.Trace) {}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := packets[i%len(packets)]
+		ParsePacket(gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default), false, process)
+	}
+}
+
+// BenchmarkDecoder measures the decoding of the same packets by the fast
+// path, which should not allocate.
+func BenchmarkDecoder(b *testing.B) {
+	packets := benchPackets(b)
+	process := func(*report.Trace) {}
+	d := NewDecoder(false)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Decode(packets[i%len(packets)], process)
+	}
+}
+
+// benchPackets returns IOAM packets of the golden corpus and a generated
+// one with every defined data field.
+func benchPackets(b *testing.B) [][]byte {
+	var packets [][]byte
+	for _, name := range []string{"test_agent_transit", "ioam_gen_incremental"} {
+		for _, packet := range readPcap(b, filepath.Join("testdata", name+".pcap")) {
+			packets = append(packets, packet.Data())
+		}
+	}
+	udp := []byte{0x12, 0x34, 0x56, 0x78, 0, 8, 0, 0}
+	return append(packets, testPacket(b, 0, hopByHop(b, encodeTrace(b, ioam.TraceTypeDefined&^ioam.TraceTypeOSS, nil, 4)), layers.IPProtocolUDP, udp))
+}
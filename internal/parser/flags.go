@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+var (
+	overflowCount atomic.Uint64 // Traces a node could not add its data to
+	loopbackCount atomic.Uint64
+	activeCount   atomic.Uint64
+)
+
+func countFlags(trace *ioamAPI.IOAMTrace) {
+	if trace.GetOverflow() {
+		overflowCount.Add(1)
+	}
+	if trace.GetLoopback() {
+		loopbackCount.Add(1)
+	}
+	if trace.GetActive() {
+		activeCount.Add(1)
+	}
+}
+
+// WriteFlagStats writes the number of decoded traces per trace option flag.
+func WriteFlagStats(w io.Writer) {
+	fmt.Fprintf(w, "flags overflow=%d loopback=%d active=%d\n", overflowCount.Load(), loopbackCount.Load(), activeCount.Load())
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	fnvOffset = 2166136261
+	fnvPrime  = 16777619
+)
+
+func fnv(h uint32, b ...byte) uint32 {
+	for _, c := range b {
+		h = (h ^ uint32(c)) * fnvPrime
+	}
+	return h
+}
+
+// networkOffset returns the offset of the network header of a frame of the
+// link type and its EtherType, or -1 if unknown.
+func networkOffset(data []byte, linkType layers.LinkType) (int, layers.EthernetType) {
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		offset := 14
+		for offset <= len(data) {
+			etherType := layers.EthernetType(binary.BigEndian.Uint16(data[offset-2 : offset]))
+			if etherType != layers.EthernetTypeDot1Q && etherType != layers.EthernetTypeQinQ {
+				return offset, etherType
+			}
+			offset += 4
+		}
+	case layers.LinkTypeLinuxSLL:
+		if len(data) >= 16 {
+			return 16, layers.EthernetType(binary.BigEndian.Uint16(data[14:16]))
+		}
+	case layers.LinkTypeRaw, layers.LinkTypeIPv6:
+		return 0, layers.EthernetTypeIPv6
+	}
+	return -1, 0
+}
+
+// FlowHash returns a hash of the flow of a packet, as reported in the
+// traces: the addresses, upper-layer protocol, ports and flow label of the
+// innermost IPv6 header. It is computed without decoding the packet, for
+// the packets of a flow to be handled by the same worker. The hash is 0 for
+// the packets that are not IPv6.
+//
+// Only the first fragment of a packet holds its upper-layer header, so all
+// the fragments are hashed with the addresses and flow label of the
+// fragmented IPv6 header only, for them to be handled by the same worker.
+func FlowHash(data []byte, linkType layers.LinkType) uint32 {
+	offset, etherType := networkOffset(data, linkType)
+	if offset < 0 || etherType != layers.EthernetTypeIPv6 {
+		return 0
+	}
+
+	var hash uint32
+	for depth := 0; depth < maxHeaders && offset+40 <= len(data); depth++ {
+		ip := data[offset:]
+		hash = fnv(fnvOffset, ip[8:40]...)
+		if fragmented(ip) {
+			hash = fnv(hash, ip[1]&0x0F, ip[2], ip[3])
+			break
+		}
+		next, upper, _ := skipExtensions(ip, 40, layers.IPProtocol(ip[6]))
+		hash = fnv(hash, byte(next), ip[1]&0x0F, ip[2], ip[3])
+		if upper < 0 {
+			break
+		}
+		switch next {
+		case layers.IPProtocolIPv6:
+			offset += upper
+			continue
+		case layers.IPProtocolTCP, layers.IPProtocolUDP:
+			if upper+4 <= len(ip) {
+				hash = fnv(hash, ip[upper:upper+4]...)
+			}
+		}
+		break
+	}
+	return hash
+}
+
+// fragmented reports whether an IPv6 packet has a Fragment header, after
+// the same extension headers as skipExtensions.
+func fragmented(ip []byte) bool {
+	offset, next := 40, layers.IPProtocol(ip[6])
+	for offset+8 <= len(ip) {
+		switch next {
+		case layers.IPProtocolIPv6Fragment:
+			return true
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Destination, layers.IPProtocolIPv6Routing:
+			next = layers.IPProtocol(ip[offset])
+			offset += (int(ip[offset+1]) + 1) * 8
+		default:
+			return false
+		}
+	}
+	return next == layers.IPProtocolIPv6Fragment
+}
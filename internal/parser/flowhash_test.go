@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+)
+
+func TestFlowHash(t *testing.T) {
+	small := hopByHop(t, encodeTrace(t, ioam.TraceTypeHopLimitNodeID, nil, 1))
+	large := hopByHop(t, encodeTrace(t, ioam.TraceTypeHopLimitNodeID, nil, 5))
+	udp := func(sport uint16) []byte {
+		return []byte{byte(sport >> 8), byte(sport), 0x56, 0x78, 0, 8, 0, 0}
+	}
+	inner := func(n byte, sport uint16) []byte {
+		ip := append(testIPv6(t, layers.IPProtocolUDP, n), udp(sport)...)
+		binary.BigEndian.PutUint16(ip[4:], 8)
+		return ip
+	}
+
+	fragment := func(offset uint16, next layers.IPProtocol, payload []byte) []byte {
+		return append([]byte{byte(next), 0, byte(offset >> 5), byte(offset << 3), 0, 0, 0, 1}, payload...)
+	}
+
+	flow := FlowHash(testPacket(t, 0, small, layers.IPProtocolUDP, udp(1)), layers.LinkTypeEthernet)
+	frag := FlowHash(testPacket(t, 0, small, layers.IPProtocolIPv6Fragment, fragment(0, layers.IPProtocolUDP, udp(1))), layers.LinkTypeEthernet)
+	encap := FlowHash(testPacket(t, 0, small, layers.IPProtocolIPv6, inner(2, 1)), layers.LinkTypeEthernet)
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   uint32
+		same   bool
+	}{
+		{"other trace", testPacket(t, 0, large, layers.IPProtocolUDP, udp(1)), flow, true},
+		{"VLAN", testPacket(t, 100, small, layers.IPProtocolUDP, udp(1)), flow, true},
+		{"other port", testPacket(t, 0, small, layers.IPProtocolUDP, udp(2)), flow, false},
+		{"encapsulated", testPacket(t, 0, large, layers.IPProtocolIPv6, inner(2, 1)), encap, true},
+		{"other inner flow", testPacket(t, 0, small, layers.IPProtocolIPv6, inner(3, 1)), encap, false},
+		{"other inner port", testPacket(t, 0, small, layers.IPProtocolIPv6, inner(2, 2)), encap, false},
+		// Without the ports of the first fragment
+		{"next fragment", testPacket(t, 0, small, layers.IPProtocolIPv6Fragment, fragment(185, layers.IPProtocolUDP, make([]byte, 8))), frag, true},
+		{"fragment of other port", testPacket(t, 0, small, layers.IPProtocolIPv6Fragment, fragment(0, layers.IPProtocolUDP, udp(2))), frag, true},
+		{"fragmented encapsulation", testPacket(t, 0, small, layers.IPProtocolIPv6Fragment, fragment(0, layers.IPProtocolIPv6, inner(2, 1))), frag, true},
+		{"next fragment of encapsulation", testPacket(t, 0, small, layers.IPProtocolIPv6Fragment, fragment(185, layers.IPProtocolIPv6, make([]byte, 8))), frag, true},
+	}
+	for _, tt := range tests {
+		got := FlowHash(tt.packet, layers.LinkTypeEthernet)
+		if (got == tt.want) != tt.same {
+			t.Errorf("%s: hash %#x, flow hash %#x, want same=%v", tt.name, got, tt.want, tt.same)
+		}
+	}
+
+	if got := FlowHash(make([]byte, 60), layers.LinkTypeEthernet); got != 0 {
+		t.Errorf("non-IPv6 frame: hash %#x, want 0", got)
+	}
+}
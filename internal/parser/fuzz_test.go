@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+)
+
+// seedHeaders returns the Hop-by-Hop Options headers of the golden corpus
+// and of a few generated traces.
+func seedHeaders(f *testing.F) [][]byte {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.pcap"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	var headers [][]byte
+	for _, file := range files {
+		for _, packet := range readPcap(f, file) {
+			if hbh := packet.Layer(layers.LayerTypeIPv6HopByHop); hbh != nil {
+				headers = append(headers, hbh.LayerContents())
+			}
+		}
+	}
+	for _, typ := range []ioam.TraceType{0xf6e002, ioam.TraceTypeDefined, ioam.TraceTypeUndefined | ioam.TraceTypeHopLimitNodeID} {
+		headers = append(headers, hopByHop(f, encodeTrace(f, typ, &ioam.OSS{SchemaID: 1, Data: []byte{1, 2, 3, 4}}, 2)))
+	}
+	return headers
+}
+
+// FuzzParseHopByHop checks that no header makes the parser panic and that
+// the lenient mode keeps at least the traces of the strict mode.
+func FuzzParseHopByHop(f *testing.F) {
+	for _, header := range seedHeaders(f) {
+		f.Add(header)
+	}
+
+	f.Fuzz(func(t *testing.T, header []byte) {
+		strict, serr := parseHopByHop(header, false)
+		lenient, lerr := parseHopByHop(header, true)
+		if len(lenient) < len(strict) {
+			t.Errorf("%d traces in lenient mode, %d in strict mode", len(lenient), len(strict))
+		}
+		if (serr == nil) != (lerr == nil) {
+			t.Errorf("strict error %v, lenient error %v", serr, lerr)
+		}
+	})
+}
+
+// FuzzParseIOAMTrace checks that no trace option makes the parser panic and
+// that both modes agree on valid options.
+func FuzzParseIOAMTrace(f *testing.F) {
+	for _, header := range seedHeaders(f) {
+		options, _ := ioam.Options(header)
+		for _, opt := range options {
+			f.Add(byte(opt.Type), opt.Data)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, optType byte, data []byte) {
+		opt := ioam.Option{Type: ioam.OptionType(optType), Data: data}
+		strict, serr := parseIOAMTrace(opt, false)
+		lenient, lerr := parseIOAMTrace(opt, true)
+		if serr != nil {
+			if strict != nil {
+				t.Errorf("trace returned with error %v in strict mode", serr)
+			}
+			return
+		}
+		if lerr != nil || !proto.Equal(strict, lenient) {
+			t.Fatalf("lenient mode differs on a valid option: %v, error %v", lenient, lerr)
+		}
+	})
+}
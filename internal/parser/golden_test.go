@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+var update = flag.Bool("update", false, "Rewrite the expected JSON of the golden corpus")
+
+// readPcap returns the packets of a pcap file of the corpus.
+func readPcap(t testing.TB, path string) []gopacket.Packet {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	var packets []gopacket.Packet
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+		packet.Metadata().CaptureInfo = ci
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// parsePcap returns the traces of all the packets of a pcap file.
+func parsePcap(t testing.TB, path string, lenient bool) []*ioamAPI.IOAMTrace {
+	t.Helper()
+	var traces []*ioamAPI.IOAMTrace
+	for _, packet := range readPcap(t, path) {
+		ParsePacket(packet, lenient, func(trace *report.Trace) {
+			traces = append(traces, trace.IOAMTrace)
+		})
+	}
+	return traces
+}
+
+// TestGolden parses the pcap files of testdata and compares the traces with
+// the expected ones, stored in JSON next to every file (go test -update
+// rewrites them). See testdata/README.md for the origin of the files.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No pcap file in testdata")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".pcap")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			got := parsePcap(t, file, false)
+			golden := name + ".json"
+
+			if *update {
+				if err := os.WriteFile(golden, marshalTraces(t, got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want := unmarshalTraces(t, golden)
+			if len(got) != len(want) {
+				t.Fatalf("%d traces, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if !proto.Equal(got[i], want[i]) {
+					t.Errorf("trace %d:\n got %v\nwant %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func marshalTraces(t *testing.T, traces []*ioamAPI.IOAMTrace) []byte {
+	t.Helper()
+	msgs := make([]json.RawMessage, len(traces))
+	for i, trace := range traces {
+		data, err := protojson.Marshal(trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i] = data
+	}
+
+	// protojson output is not stable, indent it to keep readable diffs
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func unmarshalTraces(t *testing.T, path string) []*ioamAPI.IOAMTrace {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	traces := make([]*ioamAPI.IOAMTrace, len(msgs))
+	for i, msg := range msgs {
+		traces[i] = &ioamAPI.IOAMTrace{}
+		if err := protojson.Unmarshal(msg, traces[i]); err != nil {
+			t.Fatalf("%s: trace %d: %v", path, i, err)
+		}
+	}
+	return traces
+}
@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+)
+
+// malformed counts the malformed IOAM data per decoding error.
+var malformed = []struct {
+	err   error
+	name  string
+	count atomic.Uint64
+}{
+	{err: ioam.ErrHeaderLength, name: "header_length"},
+	{err: ioam.ErrOptionLength, name: "option_length"},
+	{err: ioam.ErrRemainingLength, name: "remaining_length"},
+	{err: ioam.ErrNodeLength, name: "node_length"},
+	{err: ioam.ErrNodeData, name: "node_data"},
+	{err: ioam.ErrOSSLength, name: "oss_length"},
+}
+
+var (
+	salvagedCount atomic.Uint64 // Traces kept with part of their nodes (lenient mode)
+	panicCount    atomic.Uint64 // Packets dropped after a recovered panic
+)
+
+func countMalformed(err error) {
+	for i := range malformed {
+		if errors.Is(err, malformed[i].err) {
+			malformed[i].count.Add(1)
+			return
+		}
+	}
+}
+
+// WriteStats writes the number of malformed options per error, of salvaged
+// traces and of recovered panics.
+func WriteStats(w io.Writer) {
+	fmt.Fprint(w, "malformed")
+	for i := range malformed {
+		fmt.Fprintf(w, " %s=%d", malformed[i].name, malformed[i].count.Load())
+	}
+	fmt.Fprintf(w, " salvaged=%d panics=%d\n", salvagedCount.Load(), panicCount.Load())
+}
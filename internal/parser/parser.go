@@ -1,197 +1,235 @@
 package parser
 
 import (
-	"encoding/binary"
-	"errors"
 	"log"
 	"sync/atomic"
 
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
 	"github.com/Advanced-Observability/ioam-agent/internal/stats"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
 	ioamAPI "github.com/Advanced-Observability/ioam-api"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 )
 
-const (
-	ipv6TLVIOAM       = 49
-	ioamPreallocTrace = 0
-
-	traceTypeBit0Mask  = 1 << 23
-	traceTypeBit1Mask  = 1 << 22
-	traceTypeBit2Mask  = 1 << 21
-	traceTypeBit3Mask  = 1 << 20
-	traceTypeBit4Mask  = 1 << 19
-	traceTypeBit5Mask  = 1 << 18
-	traceTypeBit6Mask  = 1 << 17
-	traceTypeBit7Mask  = 1 << 16
-	traceTypeBit8Mask  = 1 << 15
-	traceTypeBit9Mask  = 1 << 14
-	traceTypeBit10Mask = 1 << 13
-	traceTypeBit11Mask = 1 << 12
-	traceTypeBit22Mask = 1 << 1
-)
-
-func parseNodeData(data []byte, traceType uint32) (ioamAPI.IOAMNode, error) {
-	node := ioamAPI.IOAMNode{}
-	offset := 0
-
-	if traceType&traceTypeBit0Mask != 0 {
-		node.HopLimit = uint32(data[offset])
-		node.Id = binary.BigEndian.Uint32(data[offset:offset+4]) & 0xFFFFFF
-		offset += 4
-	}
-	if traceType&traceTypeBit1Mask != 0 {
-		node.IngressId = uint32(binary.BigEndian.Uint16(data[offset : offset+2]))
-		node.EgressId = uint32(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
-		offset += 4
-	}
-	if traceType&traceTypeBit2Mask != 0 {
-		node.TimestampSecs = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-	if traceType&traceTypeBit3Mask != 0 {
-		node.TimestampFrac = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-	if traceType&traceTypeBit4Mask != 0 {
-		node.TransitDelay = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-	if traceType&traceTypeBit5Mask != 0 {
-		node.NamespaceData = data[offset : offset+4]
-		offset += 4
+// parseIOAMTrace decodes a trace option. In lenient mode, the trace holding
+// the nodes salvaged from a malformed option is returned with the error.
+func parseIOAMTrace(opt ioam.Option, lenient bool) (*ioamAPI.IOAMTrace, error) {
+	decode := ioam.DecodeTrace
+	if lenient {
+		decode = ioam.DecodeTraceLenient
 	}
-	if traceType&traceTypeBit6Mask != 0 {
-		node.QueueDepth = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-	if traceType&traceTypeBit7Mask != 0 {
-		node.CsumComp = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-	if traceType&traceTypeBit8Mask != 0 {
-		node.HopLimit = uint32(data[offset])
-		node.IdWide = binary.BigEndian.Uint64(data[offset:offset+8]) & 0xFFFFFFFFFFFFFF
-		offset += 8
-	}
-	if traceType&traceTypeBit9Mask != 0 {
-		node.IngressIdWide = binary.BigEndian.Uint32(data[offset : offset+4])
-		node.EgressIdWide = binary.BigEndian.Uint32(data[offset+4 : offset+8])
-		offset += 8
-	}
-	if traceType&traceTypeBit10Mask != 0 {
-		node.NamespaceDataWide = data[offset : offset+8]
-		offset += 8
-	}
-	if traceType&traceTypeBit11Mask != 0 {
-		node.BufferOccupancy = binary.BigEndian.Uint32(data[offset : offset+4])
-		offset += 4
-	}
-
-	return node, nil
-}
-
-func parseIOAMTrace(data []byte) (*ioamAPI.IOAMTrace, bool, error) {
-	if len(data) < 8 {
-		return nil, false, errors.New("IOAM trace data too short")
+	t, err := decode(opt.Data)
+	if t == nil {
+		return nil, err
 	}
 
-	ns := uint32(binary.BigEndian.Uint16(data[:2]))
-	nodeLen := uint32(data[2] >> 3)
-	remLen := uint32(data[3] & 0x7F)
-	traceType := binary.BigEndian.Uint32(data[4:8]) >> 8
-	loopback := (data[2] & 0b00000010) != 0
-
-	var nodes []*ioamAPI.IOAMNode
-	offset := 8 + int(remLen)*4
-
-	for offset < len(data) {
-		node, err := parseNodeData(data[offset:offset+int(nodeLen)*4], traceType)
-		if err != nil {
-			return nil, false, err
-		}
-		offset += int(nodeLen) * 4
-
-		if traceType&traceTypeBit22Mask != 0 {
-			if len(data[offset:]) < 4 {
-				return nil, false, errors.New("invalid packet length")
-			}
-			opaqueLen := data[offset]
-			if len(data[offset:]) < 4+int(opaqueLen)*4 {
-				return nil, false, errors.New("invalid packet length")
-			}
-			if opaqueLen > 0 {
-				node.OSS = &ioamAPI.Opaque{
-					SchemaId: binary.BigEndian.Uint32(data[offset:offset+4]) & 0xFFF,
-					Data:     data[offset+4 : offset+4+int(opaqueLen)*4],
-				}
-			}
-			offset += 4 + int(opaqueLen)*4
-		}
-
-		nodes = append([]*ioamAPI.IOAMNode{&node}, nodes...)
+	nodes := make([]*ioamAPI.IOAMNode, len(t.Nodes))
+	for i := range t.Nodes {
+		nodes[i] = newNode(&t.Nodes[i])
 	}
 
 	trace := &ioamAPI.IOAMTrace{
-		BitField:    traceType,
-		NamespaceId: ns,
+		BitField:    uint32(t.Type),
+		NamespaceId: uint32(t.Namespace),
 		Nodes:       nodes,
+		Overflow:    t.Flags&ioam.FlagOverflow != 0,
+		Loopback:    t.Flags&ioam.FlagLoopback != 0,
+		Active:      t.Flags&ioam.FlagActive != 0,
 	}
+	trace.Completeness = &ioamAPI.Completeness{}
+	fillCompleteness(trace.Completeness, t, opt.Type, nil)
+	if t.Type&ioam.TraceTypeChecksumComplement != 0 {
+		// The upper-layer checksum is verified with the packet
+		trace.Checksum = &ioamAPI.Checksum{}
+		fillChecksum(trace.Checksum, t, nil, false, false)
+	}
+
+	return trace, err
+}
 
-	return trace, loopback, nil
+func newNode(n *ioam.Node) *ioamAPI.IOAMNode {
+	node := &ioamAPI.IOAMNode{
+		HopLimit:          uint32(n.HopLimit),
+		Id:                n.ID,
+		IngressId:         uint32(n.IngressID),
+		EgressId:          uint32(n.EgressID),
+		TimestampSecs:     n.TimestampSecs,
+		TimestampFrac:     n.TimestampFrac,
+		TransitDelay:      n.TransitDelay,
+		NamespaceData:     n.NamespaceData,
+		QueueDepth:        n.QueueDepth,
+		CsumComp:          n.ChecksumComplement,
+		IdWide:            n.IDWide,
+		IngressIdWide:     n.IngressIDWide,
+		EgressIdWide:      n.EgressIDWide,
+		NamespaceDataWide: n.NamespaceDataWide,
+		BufferOccupancy:   n.BufferOccupancy,
+	}
+	if n.OSS != nil {
+		node.OSS = &ioamAPI.Opaque{SchemaId: n.OSS.SchemaID, Data: n.OSS.Data}
+	}
+	return node
 }
 
-func parseHopByHop(data []byte) ([]*ioamAPI.IOAMTrace, bool, error) {
-	if len(data) < 8 {
-		return nil, false, errors.New("Hop-by-Hop header too short")
+// parseHopByHop returns the traces of the IOAM options of a Hop-by-Hop
+// Options header and the first error met. Malformed options are dropped in
+// strict mode, and their valid nodes kept in lenient mode.
+func parseHopByHop(data []byte, lenient bool) ([]*ioamAPI.IOAMTrace, error) {
+	options, err := ioam.Options(data)
+	if err != nil {
+		countMalformed(err)
+		if !lenient {
+			return nil, err
+		}
 	}
 
-	hbhLen := int(data[1]+1) << 3
-	offset := 2
 	var traces []*ioamAPI.IOAMTrace
-	var loopback bool
 
-	for hbhLen > 0 {
-		if len(data[offset:]) < 4 {
-			return traces, false, nil
+	for _, opt := range options {
+		if opt.Type != ioam.OptionPreallocatedTrace && opt.Type != ioam.OptionIncrementalTrace {
+			continue
 		}
+		atomic.AddUint64(&stats.IoamPacketCount, 1)
 
-		optType := data[offset]
-		optLen := int(data[offset+1] + 2)
-
-		if optType == ipv6TLVIOAM && data[offset+3] == ioamPreallocTrace {
-			atomic.AddUint64(&stats.IoamPacketCount, 1)
-
-			trace, iloopback, err := parseIOAMTrace(data[offset+4 : offset+optLen])
-			loopback = iloopback
-			if err != nil {
-				return nil, false, err
-			}
-			if trace != nil {
-				traces = append(traces, trace)
+		trace, terr := parseIOAMTrace(opt, lenient)
+		if terr != nil {
+			countMalformed(terr)
+			if err == nil {
+				err = terr
 			}
 		}
-
-		offset += optLen
-		hbhLen -= optLen
+		if trace == nil || (terr != nil && len(trace.Nodes) == 0) {
+			continue
+		}
+		if terr != nil {
+			salvagedCount.Add(1)
+		}
+		countFlags(trace)
+		traces = append(traces, trace)
 	}
 
-	return traces, loopback, nil
+	return traces, err
 }
 
-func ParsePacket(packet gopacket.Packet, report func(*ioamAPI.IOAMTrace)) {
+// ParsePacket reports the IOAM traces of the packet to process. A panic
+// while handling the packet is recovered and only drops that packet.
+func ParsePacket(packet gopacket.Packet, lenient bool, process func(*report.Trace)) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicCount.Add(1)
+			log.Printf("[IOAM Agent] Recovered from a panic while handling a packet: %v", r)
+		}
+	}()
+
 	atomic.AddUint64(&stats.Ipv6PacketCount, 1)
 	hbhLayer := packet.Layer(layers.LayerTypeIPv6HopByHop)
 	if hbhLayer == nil {
 		return
 	}
 	hbh, _ := hbhLayer.(*layers.IPv6HopByHop)
-	traces, _, err := parseHopByHop(hbh.LayerContents())
+	traces, err := parseHopByHop(hbh.LayerContents(), lenient)
 	if err != nil {
 		log.Printf("Hop-by-Hop parse error: %v", err)
-		return
 	}
+	flow := parseFlow(packet)
+	hopLimit := hopByHopLimit(packet)
 	for _, trace := range traces {
-		report(trace)
+		trace.Flow = flow
+		setUndersized(trace, hopLimit)
+		if trace.Checksum != nil {
+			trace.Checksum.Verified, trace.Checksum.Valid = upperLayerChecksum(innermostIPv6(packet))
+			countChecksum(trace)
+		}
+		process(&report.Trace{IOAMTrace: trace})
+	}
+}
+
+// hopByHopLimit returns the hop limit of the IPv6 header holding the first
+// Hop-by-Hop Options header of the packet.
+func hopByHopLimit(packet gopacket.Packet) uint8 {
+	var hopLimit uint8
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv6:
+			hopLimit = l.HopLimit
+		case *layers.IPv6HopByHop:
+			return hopLimit
+		}
+	}
+	return 0
+}
+
+// innermostIPv6 returns the data of the packet from its innermost IPv6
+// header, nil if it has none. The layers are slices of the packet data, so
+// that the offset of a layer follows from the capacity of its contents.
+func innermostIPv6(packet gopacket.Packet) []byte {
+	var ip *layers.IPv6
+	for _, layer := range packet.Layers() {
+		if l, ok := layer.(*layers.IPv6); ok {
+			ip = l
+		}
+	}
+	if ip == nil {
+		return nil
+	}
+	data := packet.Data()
+	offset := cap(data) - cap(ip.Contents)
+	if offset < 0 || offset+40 > len(data) {
+		return nil
+	}
+	return data[offset:]
+}
+
+// parseFlow extracts the addresses, upper-layer protocol, ports and flow
+// label of the packet. With IPv6-in-IPv6 encapsulation (ioam6 encap mode),
+// the inner packet is described by the Inner flow of the outer one.
+func parseFlow(packet gopacket.Packet) *ioamAPI.Flow {
+	var outer, flow *ioamAPI.Flow
+
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv6:
+			f := &ioamAPI.Flow{
+				SrcAddr:    l.SrcIP,
+				DstAddr:    l.DstIP,
+				NextHeader: uint32(l.NextHeader),
+				FlowLabel:  l.FlowLabel,
+			}
+			if flow == nil {
+				outer = f
+			} else {
+				flow.Inner = f
+			}
+			flow = f
+		case *layers.IPv6HopByHop:
+			if flow != nil {
+				flow.NextHeader = uint32(l.NextHeader)
+			}
+		case *layers.IPv6Destination:
+			if flow != nil {
+				flow.NextHeader = uint32(l.NextHeader)
+			}
+		case *layers.IPv6Routing:
+			if flow != nil {
+				flow.NextHeader = uint32(l.NextHeader)
+			}
+		case *layers.IPv6Fragment:
+			if flow != nil {
+				flow.NextHeader = uint32(l.NextHeader)
+			}
+		case *layers.TCP:
+			if flow != nil {
+				flow.SrcPort = uint32(l.SrcPort)
+				flow.DstPort = uint32(l.DstPort)
+			}
+		case *layers.UDP:
+			if flow != nil {
+				flow.SrcPort = uint32(l.SrcPort)
+				flow.DstPort = uint32(l.DstPort)
+			}
+		}
 	}
+
+	return outer
 }
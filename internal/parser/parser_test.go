@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// testNode has a distinct value in every field.
+var testNode = ioam.Node{
+	HopLimit:           64,
+	ID:                 0xABCDEF,
+	IngressID:          0x1111,
+	EgressID:           0x2222,
+	TimestampSecs:      0x33333333,
+	TimestampFrac:      0x44444,
+	TransitDelay:       0x5555,
+	NamespaceData:      []byte{1, 2, 3, 4},
+	QueueDepth:         0x6666,
+	ChecksumComplement: 0x7777,
+	IDWide:             0xAABBCCDDEEFF11,
+	IngressIDWide:      0x88888888,
+	EgressIDWide:       0x99999999,
+	NamespaceDataWide:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	BufferOccupancy:    0xBBBB,
+}
+
+// bitFields sets the fields of a node announced by every defined bit.
+var bitFields = []struct {
+	bit ioam.TraceType
+	set func(*ioamAPI.IOAMNode)
+}{
+	{ioam.TraceTypeHopLimitNodeID, func(n *ioamAPI.IOAMNode) { n.HopLimit = 64; n.Id = 0xABCDEF }},
+	{ioam.TraceTypeInterfaceIDs, func(n *ioamAPI.IOAMNode) { n.IngressId = 0x1111; n.EgressId = 0x2222 }},
+	{ioam.TraceTypeTimestampSecs, func(n *ioamAPI.IOAMNode) { n.TimestampSecs = 0x33333333 }},
+	{ioam.TraceTypeTimestampFrac, func(n *ioamAPI.IOAMNode) { n.TimestampFrac = 0x44444 }},
+	{ioam.TraceTypeTransitDelay, func(n *ioamAPI.IOAMNode) { n.TransitDelay = 0x5555 }},
+	{ioam.TraceTypeNamespaceData, func(n *ioamAPI.IOAMNode) { n.NamespaceData = []byte{1, 2, 3, 4} }},
+	{ioam.TraceTypeQueueDepth, func(n *ioamAPI.IOAMNode) { n.QueueDepth = 0x6666 }},
+	{ioam.TraceTypeChecksumComplement, func(n *ioamAPI.IOAMNode) { n.CsumComp = 0x7777 }},
+	{ioam.TraceTypeHopLimitNodeIDWide, func(n *ioamAPI.IOAMNode) { n.HopLimit = 64; n.IdWide = 0xAABBCCDDEEFF11 }},
+	{ioam.TraceTypeInterfaceIDsWide, func(n *ioamAPI.IOAMNode) { n.IngressIdWide = 0x88888888; n.EgressIdWide = 0x99999999 }},
+	{ioam.TraceTypeNamespaceDataWide, func(n *ioamAPI.IOAMNode) { n.NamespaceDataWide = []byte{1, 2, 3, 4, 5, 6, 7, 8} }},
+	{ioam.TraceTypeBufferOccupancy, func(n *ioamAPI.IOAMNode) { n.BufferOccupancy = 0xBBBB }},
+}
+
+// wantNode returns testNode as reported for the trace type.
+func wantNode(traceType ioam.TraceType, oss *ioam.OSS) *ioamAPI.IOAMNode {
+	node := &ioamAPI.IOAMNode{}
+	for _, f := range bitFields {
+		if traceType&f.bit != 0 {
+			f.set(node)
+		}
+	}
+	if oss != nil && len(oss.Data) > 0 {
+		node.OSS = &ioamAPI.Opaque{SchemaId: oss.SchemaID, Data: oss.Data}
+	}
+	return node
+}
+
+// hopByHop returns a Hop-by-Hop Options header with a pre-allocated trace
+// option for every given option data.
+func hopByHop(t testing.TB, options ...[]byte) []byte {
+	t.Helper()
+	var opts [][]byte
+	for _, data := range options {
+		opt, err := ioam.AppendOption(nil, ioam.IPv6OptionHopByHop, ioam.OptionPreallocatedTrace, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, opt)
+	}
+	header, err := ioam.AppendOptionsHeader(nil, 17, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// encodeTrace returns the option data of a trace of nodes copies of
+// testNode.
+func encodeTrace(t testing.TB, traceType ioam.TraceType, oss *ioam.OSS, nodes int) []byte {
+	t.Helper()
+	trace := &ioam.Trace{Namespace: 123, RemLen: 1, Type: traceType, Nodes: make([]ioam.Node, nodes)}
+	for i := range trace.Nodes {
+		trace.Nodes[i] = testNode
+		trace.Nodes[i].OSS = oss
+	}
+	data, err := ioam.AppendTrace(nil, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseTraceTypeBits(t *testing.T) {
+	osses := []struct {
+		name string
+		oss  *ioam.OSS // Trace type without OSS if nil
+	}{
+		{"no OSS", nil},
+		{"empty OSS", &ioam.OSS{SchemaID: 0xFFFFFF}},
+		{"OSS", &ioam.OSS{SchemaID: 7, Data: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		{"long OSS", &ioam.OSS{SchemaID: ioam.MaxSchemaID, Data: make([]byte, 32)}},
+	}
+
+	// Every bit alone (bit 22 is the OSS, added below) and all the defined
+	// data fields together
+	var types []ioam.TraceType
+	for n := 0; n < 24; n++ {
+		if ioam.Bit(n) != ioam.TraceTypeOSS {
+			types = append(types, ioam.Bit(n))
+		}
+	}
+	types = append(types, ioam.TraceTypeDefined&^ioam.TraceTypeOSS, 0xf6e000)
+
+	for _, traceType := range types {
+		for _, o := range osses {
+			typ := traceType
+			if o.oss != nil {
+				typ |= ioam.TraceTypeOSS
+			}
+			t.Run(fmt.Sprintf("%#06x/%s", uint32(traceType), o.name), func(t *testing.T) {
+				traces, err := parseHopByHop(hopByHop(t, encodeTrace(t, typ, o.oss, 2)), false)
+				if err != nil {
+					t.Fatalf("parseHopByHop() error: %v", err)
+				}
+				if len(traces) != 1 {
+					t.Fatalf("%d traces, want 1", len(traces))
+				}
+				trace := traces[0]
+				if trace.GetNamespaceId() != 123 || trace.GetBitField() != uint32(typ) {
+					t.Errorf("namespace %d, bit field %#x, want 123, %#x", trace.GetNamespaceId(), trace.GetBitField(), uint32(typ))
+				}
+
+				// Without data, the nodes cannot be told apart
+				wantNodes := 2
+				if typ.NodeLen() == 0 && o.oss == nil {
+					wantNodes = 0
+				}
+				if len(trace.GetNodes()) != wantNodes {
+					t.Fatalf("%d nodes, want %d", len(trace.GetNodes()), wantNodes)
+				}
+				want := wantNode(typ, o.oss)
+				for i, node := range trace.GetNodes() {
+					if !proto.Equal(node, want) {
+						t.Errorf("node %d:\n got %v\nwant %v", i, node, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	typ := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeInterfaceIDs
+	valid := encodeTrace(t, typ, nil, 2)
+	withOSS := encodeTrace(t, typ|ioam.TraceTypeOSS, &ioam.OSS{SchemaID: 1, Data: make([]byte, 8)}, 2)
+
+	// Node length of 2 units for a trace type requiring 1
+	largeNodeLen := append([]byte(nil), valid...)
+	largeNodeLen[4] = 0x80
+	truncated := valid[:len(valid)-4]
+
+	tests := []struct {
+		name    string
+		header  []byte
+		err     error
+		strict  int // Number of nodes reported per mode (-1 if no trace)
+		lenient int
+	}{
+		{"valid", hopByHop(t, valid), nil, 2, 2},
+		{"short header", hopByHop(t, valid)[:6], ioam.ErrHeaderLength, -1, -1},
+		{"header length", hopByHop(t, valid)[:16], ioam.ErrHeaderLength, -1, -1},
+		{"option length", mustHeader(t, []byte{ioam.IPv6OptionHopByHop, 0xF0, 0, 0}), ioam.ErrOptionLength, -1, -1},
+		{"short IOAM option", mustHeader(t, []byte{ioam.IPv6OptionHopByHop, 1, 0}), ioam.ErrOptionLength, -1, -1},
+		{"short trace option", hopByHop(t, valid[:4]), ioam.ErrOptionLength, -1, -1},
+		{"remaining length", hopByHop(t, append([]byte{0, 123, 1 << 3, 100}, valid[4:]...)), ioam.ErrRemainingLength, -1, -1},
+		{"small node length", hopByHop(t, append([]byte{0, 123, 1 << 3, 1}, valid[4:]...)), ioam.ErrNodeLength, -1, -1},
+		{"large node length", hopByHop(t, largeNodeLen), ioam.ErrNodeLength, -1, 2},
+		{"truncated node", hopByHop(t, truncated), ioam.ErrNodeData, -1, 1},
+		{"truncated OSS", hopByHop(t, withOSS[:len(withOSS)-4]), ioam.ErrOSSLength, -1, 1},
+	}
+
+	for _, tt := range tests {
+		for _, lenient := range []bool{false, true} {
+			want := tt.strict
+			if lenient {
+				want = tt.lenient
+			}
+			t.Run(fmt.Sprintf("%s/lenient=%v", tt.name, lenient), func(t *testing.T) {
+				traces, err := parseHopByHop(tt.header, lenient)
+				if !errors.Is(err, tt.err) {
+					t.Errorf("parseHopByHop() error = %v, want %v", err, tt.err)
+				}
+				if want < 0 {
+					if len(traces) != 0 {
+						t.Errorf("%d traces, want none", len(traces))
+					}
+					return
+				}
+				if len(traces) != 1 {
+					t.Fatalf("%d traces, want 1", len(traces))
+				}
+				if got := len(traces[0].GetNodes()); got != want {
+					t.Errorf("%d nodes, want %d", got, want)
+				}
+				for i, node := range traces[0].GetNodes() {
+					if node.GetId() != testNode.ID {
+						t.Errorf("node %d: ID %#x, want %#x", i, node.GetId(), testNode.ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestParseMalformedHeader checks that the options before a malformed one
+// are kept in lenient mode only.
+func TestParseMalformedHeader(t *testing.T) {
+	opt, err := ioam.AppendOption(nil, ioam.IPv6OptionHopByHop, ioam.OptionPreallocatedTrace, encodeTrace(t, ioam.TraceTypeHopLimitNodeID, nil, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := mustHeader(t, opt, []byte{ioam.IPv6OptionHopByHop, 0xF0, 0, 0})
+
+	for lenient, want := range map[bool]int{false: 0, true: 1} {
+		traces, err := parseHopByHop(header, lenient)
+		if !errors.Is(err, ioam.ErrOptionLength) {
+			t.Errorf("lenient=%v: parseHopByHop() error = %v, want %v", lenient, err, ioam.ErrOptionLength)
+		}
+		if len(traces) != want {
+			t.Errorf("lenient=%v: %d traces, want %d", lenient, len(traces), want)
+		}
+	}
+}
+
+// mustHeader returns a Hop-by-Hop Options header holding raw options.
+func mustHeader(t testing.TB, options ...[]byte) []byte {
+	t.Helper()
+	header, err := ioam.AppendOptionsHeader(nil, 17, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
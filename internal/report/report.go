@@ -0,0 +1,95 @@
+package report
+
+import (
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+// Trace is an IOAM trace as handed to the reporters, together with the
+// information derived from it by the agent.
+type Trace struct {
+	*ioamAPI.IOAMTrace
+
+	Delays *Delays // nil if the trace carries no usable timestamps
+
+	retained bool
+}
+
+// Retain must be called by the consumers keeping a reference to the trace,
+// or to any of its fields, after they return: the traces that are not
+// retained are reused for the next packets.
+func (t *Trace) Retain() {
+	t.retained = true
+}
+
+// Retained reports whether Retain was called.
+func (t *Trace) Retained() bool {
+	return t.retained
+}
+
+// Delays holds the one-way delays computed from the node timestamps.
+// Hops[i] is the delay between Nodes[i] and Nodes[i+1].
+type Delays struct {
+	Hops  []time.Duration
+	Total time.Duration
+}
+
+// InnerFlow returns the flow of the innermost packet carrying the trace,
+// i.e. the encapsulated packet when the ioam6 encap mode is used.
+func (t *Trace) InnerFlow() *ioamAPI.Flow {
+	flow := t.GetFlow()
+	for flow.GetInner() != nil {
+		flow = flow.GetInner()
+	}
+	return flow
+}
+
+// NodeID returns the short node ID of a node of the trace, or the wide one
+// if the trace type only includes the latter.
+func (t *Trace) NodeID(node *ioamAPI.IOAMNode) uint64 {
+	traceType := ioam.TraceType(t.GetBitField())
+	if !traceType.Has(ioam.TraceTypeHopLimitNodeID) && traceType.Has(ioam.TraceTypeHopLimitNodeIDWide) {
+		return node.GetIdWide()
+	}
+	return uint64(node.GetId())
+}
+
+// Interfaces returns the short ingress and egress interface IDs of a node
+// of the trace, or the wide ones if the trace type only includes the latter.
+func (t *Trace) Interfaces(node *ioamAPI.IOAMNode) (uint32, uint32) {
+	traceType := ioam.TraceType(t.GetBitField())
+	if !traceType.Has(ioam.TraceTypeInterfaceIDs) && traceType.Has(ioam.TraceTypeInterfaceIDsWide) {
+		return node.GetIngressIdWide(), node.GetEgressIdWide()
+	}
+	return node.GetIngressId(), node.GetEgressId()
+}
+
+// Corrupted reports whether the Checksum Complement verification of the
+// trace suggests that a node corrupted the packet: invalid upper-layer
+// checksum, or node data that are not checksum-neutral despite their
+// Checksum Complement.
+func (t *Trace) Corrupted() bool {
+	c := t.GetChecksum()
+	return c.GetVerified() && !c.GetValid() || len(c.GetMismatches()) > 0
+}
+
+// Label sets the Labels of the nodes of the trace found in the inventory.
+func (t *Trace) Label(inv *inventory.Inventory) {
+	for _, node := range t.GetNodes() {
+		n := inv.Node(t.GetNamespaceId(), t.NodeID(node))
+		if n == nil {
+			continue
+		}
+		ingress, egress := t.Interfaces(node)
+		node.Labels = &ioamAPI.NodeLabels{
+			Hostname:    n.Hostname,
+			Site:        n.Site,
+			Role:        n.Role,
+			IngressName: n.Interface(ingress),
+			EgressName:  n.Interface(egress),
+		}
+	}
+}
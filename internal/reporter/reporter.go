@@ -3,65 +3,116 @@ package reporter
 import (
 	"context"
 	"fmt"
-	"sync"
 	"log"
+	"net"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
 	ioamAPI "github.com/Advanced-Observability/ioam-api"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
 )
 
-type Reporter func(trace *ioamAPI.IOAMTrace)
+type Reporter func(trace *report.Trace)
 
-var (
+// gRPC metadata identifying the agent, sent when the stream is opened
+const (
+	MetadataHostname   = "ioam-agent-hostname"
+	MetadataInterface  = "ioam-agent-interface"
+	MetadataVersion    = "ioam-agent-version"
+	MetadataConfigHash = "ioam-agent-config-hash"
+)
+
+// collectorStream streams the traces to a collector, and reconnects when
+// sending fails.
+type collectorStream struct {
+	collector    string
 	clientStream grpc.ClientStreamingClient[ioamAPI.IOAMTrace, emptypb.Empty]
-	mu sync.Mutex
-	lastRun   time.Time
-	interval  = 5 * time.Second // Interval between attempts to reconnect to the collector
+	mu           sync.Mutex
+	lastRun      time.Time
+}
+
+var (
+	interval = 5 * time.Second // Interval between attempts to reconnect to the collector
+	streamMD metadata.MD
 )
 
 func SetupReporting(cfg *config.Config) Reporter {
+	collector := os.Getenv("IOAM_COLLECTOR")
+	if collector == "" {
+		collector = cfg.Collector
+	}
+	r := setupReporters(cfg, cfg.Console, cfg.Dumpfile, collector)
+	if r == nil {
+		log.Fatal("[IOAM Agent] No IOAM reporting method configured")
+	}
+	return r
+}
+
+// SetupSeparateReporting returns the reporter of the separate sink of the
+// loopback and active measurement traces, nil if none is configured.
+func SetupSeparateReporting(cfg *config.Config) Reporter {
+	sink := cfg.Flags.Sink
+	if sink.File == "" && sink.Collector == "" {
+		return nil
+	}
+	log.Println("[IOAM Agent] Reporting loopback and active measurement traces separately...")
+	return setupReporters(cfg, false, sink.File, sink.Collector)
+}
+
+// setupReporters returns a reporter to the given destinations, nil if none.
+func setupReporters(cfg *config.Config, console bool, dumpfile, collector string) Reporter {
 	var reporters []Reporter
 
-	if cfg.Console {
+	if console {
 		log.Println("[IOAM Agent] Printing IOAM traces...")
-		reporters = append(reporters, func(trace *ioamAPI.IOAMTrace) {
-			fmt.Println(trace)
-		})
+		reporters = append(reporters, filter(cfg.Reporters.Console, printTrace))
 	}
 
-	if cfg.Dumpfile != "" {
-		log.Println("[IOAM Agent] Dumping IOAM traces to file...")
-		f, err := os.OpenFile(cfg.Dumpfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if dumpfile != "" {
+		log.Printf("[IOAM Agent] Dumping IOAM traces to %s...", dumpfile)
+		f, err := os.OpenFile(dumpfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			log.Printf("Error opening file: %v", err)
 		} else {
-			fmt.Fprintf(f, "timestamp,namespace_id,tracetype,hop_limit,node_id,ingress_id,egress_id,timestamp_secs,timestamp_frac,transit_delay,queue_depth,csum_comp,buffer_occupancy,ingress_id_wide,egress_id_wide,id_wide,namespace_data,namespace_data_wide,oss_schema_id,oss_data\n")
-			reporters = append(reporters, func(trace *ioamAPI.IOAMTrace) {
+			fmt.Fprintf(f, "timestamp,namespace_id,tracetype,hop_limit,node_id,ingress_id,egress_id,timestamp_secs,timestamp_frac,transit_delay,queue_depth,csum_comp,buffer_occupancy,ingress_id_wide,egress_id_wide,id_wide,namespace_data,namespace_data_wide,oss_schema_id,oss_data,hop_delay_ns,path_delay_ns,src_addr,dst_addr,next_header,src_port,dst_port,flow_label,packets,summary,flags,filled,allocated,missing_hops,gap,namespace_name,namespace_status,hostname,site,role,ingress_name,egress_name,checksum_status\n")
+			reporters = append(reporters, filter(cfg.Reporters.File, func(trace *report.Trace) {
 				dumpToFile(trace, f)
-			})
+			}))
 		}
 	}
 
-	collector := os.Getenv("IOAM_COLLECTOR")
-	if collector == "" {
-		collector = cfg.Collector
-	}
 	if collector != "" {
-		reporters = append(reporters, func(trace *ioamAPI.IOAMTrace) {
-			sendToCollector(trace, collector)
-		})
+		if streamMD == nil {
+			hostname, err := os.Hostname()
+			if err != nil {
+				log.Printf("Cannot get hostname: %v", err)
+			}
+			streamMD = metadata.Pairs(
+				MetadataHostname, hostname,
+				MetadataInterface, cfg.Interface,
+				MetadataVersion, config.Version,
+				MetadataConfigHash, cfg.Hash,
+			)
+		}
+		s := &collectorStream{collector: collector}
+		reporters = append(reporters, filter(cfg.Reporters.Collector, func(trace *report.Trace) {
+			s.send(trace.IOAMTrace)
+		}))
 	}
 
 	if len(reporters) == 0 {
-		log.Fatal("[IOAM Agent] No IOAM reporting method configured")
+		return nil
 	}
 
-	return func(trace *ioamAPI.IOAMTrace) {
+	return func(trace *report.Trace) {
 		for _, r := range reporters {
 			// Could modify implementation to have one worker pool per reporter
 			r(trace)
@@ -69,37 +120,49 @@ func SetupReporting(cfg *config.Config) Reporter {
 	}
 }
 
-func sendToCollector(trace *ioamAPI.IOAMTrace, collector string) error {
-	if clientStream != nil {
-		if err := clientStream.Send(trace); err == nil {
+// filter returns a reporter of the traces of the namespaces allowed by f.
+func filter(f config.NamespaceFilter, r Reporter) Reporter {
+	if len(f.Allow) == 0 && len(f.Deny) == 0 {
+		return r
+	}
+	return func(trace *report.Trace) {
+		if f.Allows(trace.GetNamespaceId()) {
+			r(trace)
+		}
+	}
+}
+
+func (s *collectorStream) send(trace *ioamAPI.IOAMTrace) error {
+	if s.clientStream != nil {
+		if err := s.clientStream.Send(trace); err == nil {
 			return nil
 		} else {
 			log.Printf("Failed to send IOAM trace to collector: %v", err)
 		}
 	}
-	err := reconnectStream(collector)
+	err := s.reconnect()
 	return err
 }
 
-func reconnectStream(collector string) error {
-	mu.Lock()
-	defer mu.Unlock()
+func (s *collectorStream) reconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	now := time.Now()
-	wait := lastRun.Add(interval).Sub(now)
+	wait := s.lastRun.Add(interval).Sub(now)
 	if wait > 0 {
 		return nil
 	}
-	lastRun = time.Now()
+	s.lastRun = time.Now()
 
-	log.Printf("Trying to connect to collector")
-	conn, err := grpc.Dial(collector, grpc.WithInsecure())
+	log.Printf("Trying to connect to collector %s", s.collector)
+	conn, err := grpc.Dial(s.collector, grpc.WithInsecure())
 	if err != nil {
 		return err
 	}
 
 	client := ioamAPI.NewIOAMServiceClient(conn)
-	clientStream, err = client.Report(context.Background())
+	s.clientStream, err = client.Report(metadata.NewOutgoingContext(context.Background(), streamMD))
 	if err != nil {
 		return err
 	}
@@ -108,19 +171,73 @@ func reconnectStream(collector string) error {
 	return nil
 }
 
-func dumpToFile(trace *ioamAPI.IOAMTrace, f *os.File) {
-	for _, node := range trace.GetNodes() {
-		toPrint := fmt.Sprintf("%s,%d,%06x,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%04x,%08x,",
+func printTrace(trace *report.Trace) {
+	if trace.Delays == nil {
+		fmt.Println(trace.IOAMTrace)
+		return
+	}
+	fmt.Printf("%v HopDelays:%v PathDelay:%s\n", trace.IOAMTrace, trace.Delays.Hops, trace.Delays.Total)
+}
+
+func dumpToFile(trace *report.Trace, f *os.File) {
+	for i, node := range trace.GetNodes() {
+		toPrint := fmt.Sprintf("%s,%d,%06x,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%s,%s,",
 			time.Now().Format(time.RFC3339), trace.GetNamespaceId(), trace.GetBitField(),
 			node.GetHopLimit(), node.GetId(), node.GetIngressId(), node.GetEgressId(),
 			node.GetTimestampSecs(), node.GetTimestampFrac(), node.GetTransitDelay(), node.GetQueueDepth(),
 			node.GetCsumComp(), node.GetBufferOccupancy(), node.GetIngressIdWide(), node.GetEgressIdWide(),
-			node.GetIdWide(), node.GetNamespaceData(), node.GetNamespaceDataWide())
+			node.GetIdWide(), namespaceData(node.GetNamespaceData(), node.GetNamespaceDataText()),
+			namespaceData(node.GetNamespaceDataWide(), node.GetNamespaceDataWideText()))
 
 		oss := node.GetOSS()
 		if oss != nil {
-			toPrint += fmt.Sprintf("%d,%x", oss.SchemaId, oss.Data)
+			toPrint += fmt.Sprintf("%d,%s", oss.SchemaId, ossData(oss))
+		} else {
+			toPrint += ","
 		}
+		if trace.Delays != nil {
+			if i > 0 {
+				toPrint += fmt.Sprintf(",%d,%d", trace.Delays.Hops[i-1].Nanoseconds(), trace.Delays.Total.Nanoseconds())
+			} else {
+				toPrint += fmt.Sprintf(",,%d", trace.Delays.Total.Nanoseconds())
+			}
+		} else {
+			toPrint += ",,"
+		}
+		if flow := trace.InnerFlow(); flow != nil {
+			toPrint += fmt.Sprintf(",%s,%s,%d,%d,%d,%d", net.IP(flow.GetSrcAddr()), net.IP(flow.GetDstAddr()),
+				flow.GetNextHeader(), flow.GetSrcPort(), flow.GetDstPort(), flow.GetFlowLabel())
+		} else {
+			toPrint += ",,,,,,"
+		}
+		if summary := trace.GetSummary(); summary != nil {
+			toPrint += fmt.Sprintf(",%d,", summary.GetPackets())
+			if i < len(summary.GetNodes()) {
+				for j, field := range summary.GetNodes()[i].GetFields() {
+					if j > 0 {
+						toPrint += " "
+					}
+					toPrint += fmt.Sprintf("%s=%d/%.1f/%d/%d/%d/%d", field.GetName(), field.GetMin(), field.GetAvg(),
+						field.GetMax(), field.GetP50(), field.GetP90(), field.GetP99())
+				}
+			}
+		} else {
+			toPrint += ",1,"
+		}
+		toPrint += "," + flagsString(trace)
+		if c := trace.GetCompleteness(); c != nil {
+			toPrint += fmt.Sprintf(",%d,%d,%d,", c.GetFilled(), c.GetAllocated(), c.GetMissing())
+			if i > 0 && i <= len(c.GetGaps()) {
+				toPrint += fmt.Sprint(c.GetGaps()[i-1])
+			}
+		} else {
+			toPrint += ",,,,"
+		}
+		toPrint += "," + namespaceName(trace) + "," + namespaceStatus(trace, uint32(i))
+		labels := node.GetLabels()
+		toPrint += "," + strings.Join([]string{csvField(labels.GetHostname()), csvField(labels.GetSite()), csvField(labels.GetRole()),
+			csvField(labels.GetIngressName()), csvField(labels.GetEgressName())}, ",")
+		toPrint += "," + checksumStatus(trace, uint32(i))
 		toPrint += "\n"
 
 		if _, err := f.WriteString(toPrint); err != nil {
@@ -128,3 +245,95 @@ func dumpToFile(trace *ioamAPI.IOAMTrace, f *os.File) {
 		}
 	}
 }
+
+// namespaceData returns a namespace data field as decoded by the registry,
+// in hexadecimal if it is not.
+func namespaceData(data []byte, text string) string {
+	if text != "" {
+		return text
+	}
+	return fmt.Sprintf("%x", data)
+}
+
+// ossData returns the fields of a snapshot decoded by the agent as
+// "name=value" separated by spaces, or its data in hexadecimal if it is not.
+func ossData(oss *ioamAPI.Opaque) string {
+	if len(oss.GetFields()) == 0 {
+		return fmt.Sprintf("%x", oss.GetData())
+	}
+	fields := make([]string, len(oss.GetFields()))
+	for i, field := range oss.GetFields() {
+		fields[i] = field.GetName() + "=" + field.GetValue()
+	}
+	return strings.Join(fields, " ")
+}
+
+// namespaceName returns the name of the namespace of the trace, without the
+// CSV separators.
+func namespaceName(trace *report.Trace) string {
+	return csvField(trace.GetNamespace().GetName())
+}
+
+// csvField returns s without the CSV separators.
+func csvField(s string) string {
+	return csvReplacer.Replace(s)
+}
+
+var csvReplacer = strings.NewReplacer(",", " ", "\"", " ", "\n", " ")
+
+// namespaceStatus returns what the registry flagged for node i of the
+// trace: unknown namespace, or unexpected node ID and/or OSS schema
+// separated by "|".
+func namespaceStatus(trace *report.Trace, i uint32) string {
+	ns := trace.GetNamespace()
+	if ns.GetUnknown() {
+		return "unknown"
+	}
+	var status []string
+	if slices.Contains(ns.GetUnexpectedNodes(), i) {
+		status = append(status, "unexpected-node")
+	}
+	if slices.Contains(ns.GetUnexpectedSchemas(), i) {
+		status = append(status, "unexpected-schema")
+	}
+	return strings.Join(status, "|")
+}
+
+// checksumStatus returns the result of the Checksum Complement verification
+// for node i of the trace: mismatching node data, invalid upper-layer
+// checksum and flagged trace, separated by "|", or "ok".
+func checksumStatus(trace *report.Trace, i uint32) string {
+	c := trace.GetChecksum()
+	if c == nil {
+		return ""
+	}
+	var status []string
+	if slices.Contains(c.GetMismatches(), i) {
+		status = append(status, "mismatch")
+	}
+	if c.GetVerified() && !c.GetValid() {
+		status = append(status, "invalid")
+	}
+	if c.GetCorrupted() {
+		status = append(status, "corrupted")
+	}
+	if status == nil {
+		return "ok"
+	}
+	return strings.Join(status, "|")
+}
+
+// flagsString returns the flags of the trace separated by "|".
+func flagsString(trace *report.Trace) string {
+	var flags []string
+	if trace.GetOverflow() {
+		flags = append(flags, "overflow")
+	}
+	if trace.GetLoopback() {
+		flags = append(flags, "loopback")
+	}
+	if trace.GetActive() {
+		flags = append(flags, "active")
+	}
+	return strings.Join(flags, "|")
+}
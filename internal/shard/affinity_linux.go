@@ -0,0 +1,33 @@
+//go:build linux
+
+package shard
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// allowedCPUs returns the CPUs the agent may run on.
+func allowedCPUs() ([]int, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	var cpus []int
+	for cpu := 0; len(cpus) < set.Count(); cpu++ {
+		if set.IsSet(cpu) {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// pinThread locks the calling goroutine to its thread and the thread to the
+// CPU.
+func pinThread(cpu int) error {
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
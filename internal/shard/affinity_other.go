@@ -0,0 +1,15 @@
+//go:build !linux
+
+package shard
+
+import "errors"
+
+var errAffinity = errors.New("CPU affinity is only supported on Linux")
+
+func allowedCPUs() ([]int, error) {
+	return nil, errAffinity
+}
+
+func pinThread(cpu int) error {
+	return errAffinity
+}
@@ -0,0 +1,96 @@
+package shard
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// worker is a goroutine handling the packets of its queue, in order.
+type worker struct {
+	queue    chan []byte
+	cpu      atomic.Int32 // -1 if not pinned
+	packets  atomic.Uint64
+	maxDepth atomic.Int64
+}
+
+// Pool dispatches the packets to workers by flow hash, so the packets of a
+// flow are always handled by the same worker and in capture order.
+type Pool struct {
+	workers []*worker
+	wg      sync.WaitGroup
+}
+
+// New starts n workers with a queue of queueSize packets each, pinned to
+// the CPUs the agent may run on if pin is set. handle is called by the
+// worker of index w (from 0) for every packet dispatched to it.
+func New(n, queueSize uint, pin bool, handle func(w int, data []byte)) *Pool {
+	var cpus []int
+	if pin {
+		var err error
+		if cpus, err = allowedCPUs(); err != nil {
+			log.Printf("[IOAM Agent] Cannot pin the workers to CPUs: %v", err)
+		}
+	}
+
+	p := &Pool{workers: make([]*worker, n)}
+	for i := range p.workers {
+		w := &worker{queue: make(chan []byte, queueSize)}
+		w.cpu.Store(-1)
+		if len(cpus) > 0 {
+			w.cpu.Store(int32(cpus[i%len(cpus)]))
+		}
+		p.workers[i] = w
+
+		p.wg.Add(1)
+		go func(i int) {
+			defer p.wg.Done()
+			if cpu := int(w.cpu.Load()); cpu >= 0 {
+				if err := pinThread(cpu); err != nil {
+					log.Printf("[IOAM Agent] Cannot pin worker %d to CPU %d: %v", i+1, cpu, err)
+					w.cpu.Store(-1)
+				}
+			}
+			for data := range w.queue {
+				handle(i, data)
+			}
+		}(i)
+	}
+	return p
+}
+
+// Dispatch queues a packet to the worker of its flow hash, blocking while
+// the queue of that worker is full.
+func (p *Pool) Dispatch(hash uint32, data []byte) {
+	w := p.workers[hash%uint32(len(p.workers))]
+	w.queue <- data
+	w.packets.Add(1)
+	if depth := int64(len(w.queue)); depth > w.maxDepth.Load() {
+		w.maxDepth.Store(depth)
+	}
+}
+
+// Close waits for the workers to handle the packets of their queue and
+// stops them. Dispatch must not be called afterwards.
+func (p *Pool) Close() {
+	for _, w := range p.workers {
+		close(w.queue)
+	}
+	p.wg.Wait()
+}
+
+// WriteStats writes one line per worker: the CPU it is pinned to, the
+// number of packets dispatched to it, and the current and maximum depth of
+// its queue.
+func (p *Pool) WriteStats(out io.Writer) {
+	for i, w := range p.workers {
+		cpu := "any"
+		if c := w.cpu.Load(); c >= 0 {
+			cpu = fmt.Sprint(c)
+		}
+		fmt.Fprintf(out, "worker %d cpu=%s packets=%d queue=%d/%d max-queue=%d\n",
+			i+1, cpu, w.packets.Load(), len(w.queue), cap(w.queue), w.maxDepth.Load())
+	}
+}
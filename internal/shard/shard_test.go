@@ -0,0 +1,85 @@
+package shard
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	const flows, packets = 5, 20
+
+	var mu sync.Mutex
+	handled := make(map[byte][]byte) // Sequence numbers by flow
+	workers := make(map[byte]int)    // Worker by flow
+	started, release := make(chan struct{}), make(chan struct{})
+	p := New(2, 8, false, func(w int, data []byte) {
+		if data[0] == 0 && data[1] == 0 {
+			// Hold the first packet of worker 0 for its queue to fill
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		flow := data[0]
+		if prev, ok := workers[flow]; ok && prev != w {
+			t.Errorf("flow %d handled by workers %d and %d", flow, prev, w)
+		}
+		workers[flow] = w
+		handled[flow] = append(handled[flow], data[1])
+	})
+
+	// Worker 0 gets the flows 0, 2 and 4, worker 1 the flows 1 and 3
+	p.Dispatch(0, []byte{0, 0})
+	<-started
+	for seq := range byte(packets) {
+		for flow := range byte(flows) {
+			if flow == 0 && seq == 0 {
+				continue
+			}
+			if flow%2 == 0 && len(p.workers[0].queue) == cap(p.workers[0].queue) {
+				continue
+			}
+			p.Dispatch(uint32(flow), []byte{flow, seq})
+		}
+	}
+	depth := p.workers[0].maxDepth.Load()
+	if depth != 8 {
+		t.Errorf("max queue depth of worker 0 = %d, want 8", depth)
+	}
+	close(release)
+	p.Close()
+
+	// Close returns once all the queued packets are handled
+	var total uint64
+	for _, w := range p.workers {
+		total += w.packets.Load()
+	}
+	var n int
+	for flow, seqs := range handled {
+		n += len(seqs)
+		if want := int(flow % 2); workers[flow] != want {
+			t.Errorf("flow %d handled by worker %d, want %d", flow, workers[flow], want)
+		}
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] <= seqs[i-1] {
+				t.Errorf("flow %d handled out of order: %v", flow, seqs)
+				break
+			}
+		}
+	}
+	if uint64(n) != total {
+		t.Errorf("%d packets handled, %d dispatched", n, total)
+	}
+	if len(handled[1]) != packets || len(handled[3]) != packets {
+		t.Errorf("%d and %d packets of the flows of worker 1, want %d", len(handled[1]), len(handled[3]), packets)
+	}
+
+	var out bytes.Buffer
+	p.WriteStats(&out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "worker 1 cpu=any ") || !strings.HasSuffix(lines[0], " queue=0/8 max-queue=8") {
+		t.Errorf("WriteStats() = %q", out.String())
+	}
+}
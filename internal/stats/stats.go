@@ -10,10 +10,20 @@ import (
 )
 
 var (
-	Ipv6PacketCount uint64 = 0
-	IoamPacketCount uint64 = 0
+	Ipv6PacketCount  uint64 = 0
+	IoamPacketCount  uint64 = 0
+	RouteChangeCount uint64 = 0
+
+	sections []func(io.Writer)
 )
 
+// AddSection registers a function writing additional lines after the
+// counters on every update of the statistics file. Must be called before
+// WriteStats is started.
+func AddSection(write func(io.Writer)) {
+	sections = append(sections, write)
+}
+
 func WriteStats(filename, iface string, interval time.Duration) {
 	if interval == 0 {
 		log.Println("[IOAM Agent] Disabling statistics file")
@@ -51,8 +61,15 @@ func WriteStats(filename, iface string, interval time.Duration) {
 		tx, tx_err := readInt(txf)
 		if rx_err == nil && tx_err == nil {
 			file.Seek(0, io.SeekStart)
-			fmt.Fprintf(file, "%s parsed-ipv6=%d parsed-ioam=%d %s-rx=%d %s-tx=%d\n",
-				time.Now().Format(time.RFC3339), Ipv6PacketCount, IoamPacketCount, iface, rx-init_rx, iface, tx-init_tx)
+			fmt.Fprintf(file, "%s parsed-ipv6=%d parsed-ioam=%d route-changes=%d %s-rx=%d %s-tx=%d\n",
+				time.Now().Format(time.RFC3339), Ipv6PacketCount, IoamPacketCount, RouteChangeCount,
+				iface, rx-init_rx, iface, tx-init_tx)
+			for _, write := range sections {
+				write(file)
+			}
+			if offset, err := file.Seek(0, io.SeekCurrent); err == nil {
+				file.Truncate(offset)
+			}
 		}
 	}
 }
@@ -0,0 +1,326 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
+)
+
+const (
+	ttl           = 10 * time.Minute // Routes, paths and links not seen for that long are forgotten
+	activeTTL     = time.Minute      // Paths of a route not seen for that long are no longer active
+	pruneInterval = time.Minute
+)
+
+// Hop is a node of a path, with the interfaces the packet went through.
+type Hop struct {
+	Node    uint64 `json:"node"`
+	Ingress uint32 `json:"ingress"`
+	Egress  uint32 `json:"egress"`
+}
+
+// Path is a sequence of hops observed in the traces of a namespace.
+type Path struct {
+	Hops      []Hop     `json:"hops"`
+	Packets   uint64    `json:"packets"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Link is a directed adjacency between two nodes of a namespace.
+type Link struct {
+	From     uint64    `json:"from"`
+	Egress   uint32    `json:"egress"`
+	To       uint64    `json:"to"`
+	Ingress  uint32    `json:"ingress"`
+	Packets  uint64    `json:"packets"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Event reports that the path taken by the traffic of a route changed.
+type Event struct {
+	Namespace uint32
+	Route     string
+	Old       string
+	New       string
+}
+
+// route keeps the paths recently taken by the traffic of a route, several
+// with ECMP, with the time each was last seen.
+type route struct {
+	active   map[string]time.Time
+	last     string // Path of the last trace
+	lastSeen time.Time
+}
+
+type namespace struct {
+	paths  map[string]*Path
+	links  map[Link]*Link // keyed by Link with zero counters
+	routes map[string]*route
+}
+
+// Table keeps the paths observed in every namespace and detects, per
+// source/destination prefix pair, when the traffic takes a path that none of
+// its recent traces took.
+type Table struct {
+	prefixLen int
+	onChange  func(Event)
+
+	inventory func() *inventory.Inventory // Names the nodes and interfaces in DOT, if set
+
+	mu         sync.Mutex
+	namespaces map[uint32]*namespace
+	lastPrune  time.Time
+}
+
+// NewTable creates a topology table. Routes are identified by the source
+// and destination addresses truncated to prefixLen bits; onChange is called
+// (with the table locked) whenever a known route takes a path that is not
+// one of its active paths.
+func NewTable(prefixLen int, onChange func(Event)) *Table {
+	return &Table{
+		prefixLen:  prefixLen,
+		onChange:   onChange,
+		namespaces: make(map[uint32]*namespace),
+		lastPrune:  time.Now(),
+	}
+}
+
+// SetInventory names the nodes and interfaces of the DOT export with the
+// inventory returned by inv. It must be called before the table is used.
+func (t *Table) SetInventory(inv func() *inventory.Inventory) {
+	t.inventory = inv
+}
+
+// Observe records the path of the trace.
+func (t *Table) Observe(trace *report.Trace) {
+	if len(trace.GetNodes()) == 0 {
+		return
+	}
+
+	hops := make([]Hop, len(trace.GetNodes()))
+	for i, node := range trace.GetNodes() {
+		ingress, egress := trace.Interfaces(node)
+		hops[i] = Hop{Node: trace.NodeID(node), Ingress: ingress, Egress: egress}
+	}
+	key := pathKey(hops)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ns, ok := t.namespaces[trace.GetNamespaceId()]
+	if !ok {
+		ns = &namespace{
+			paths:  make(map[string]*Path),
+			links:  make(map[Link]*Link),
+			routes: make(map[string]*route),
+		}
+		t.namespaces[trace.GetNamespaceId()] = ns
+	}
+
+	path, ok := ns.paths[key]
+	if !ok {
+		path = &Path{Hops: hops, FirstSeen: now}
+		ns.paths[key] = path
+	}
+	path.Packets++
+	path.LastSeen = now
+
+	for i := 1; i < len(hops); i++ {
+		id := Link{From: hops[i-1].Node, Egress: hops[i-1].Egress, To: hops[i].Node, Ingress: hops[i].Ingress}
+		link, ok := ns.links[id]
+		if !ok {
+			link = &id
+			ns.links[id] = link
+		}
+		link.Packets++
+		link.LastSeen = now
+	}
+
+	if flow := trace.InnerFlow(); flow != nil {
+		rkey := t.routeKey(net.IP(flow.GetSrcAddr()), net.IP(flow.GetDstAddr()))
+		r, ok := ns.routes[rkey]
+		if !ok {
+			r = &route{active: make(map[string]time.Time)}
+			ns.routes[rkey] = r
+		} else {
+			for p, seen := range r.active {
+				if now.Sub(seen) > activeTTL {
+					delete(r.active, p)
+				}
+			}
+			if _, active := r.active[key]; !active && t.onChange != nil {
+				t.onChange(Event{Namespace: trace.GetNamespaceId(), Route: rkey, Old: r.last, New: key})
+			}
+		}
+		r.active[key] = now
+		r.last = key
+		r.lastSeen = now
+	}
+
+	if now.Sub(t.lastPrune) > pruneInterval {
+		t.prune(now)
+	}
+}
+
+// prune forgets the routes, paths and links that were not seen recently,
+// and the namespaces left empty. Must be called with t.mu held.
+func (t *Table) prune(now time.Time) {
+	for id, ns := range t.namespaces {
+		for key, r := range ns.routes {
+			if now.Sub(r.lastSeen) > ttl {
+				delete(ns.routes, key)
+			}
+		}
+		for key, path := range ns.paths {
+			if now.Sub(path.LastSeen) > ttl {
+				delete(ns.paths, key)
+			}
+		}
+		for key, link := range ns.links {
+			if now.Sub(link.LastSeen) > ttl {
+				delete(ns.links, key)
+			}
+		}
+		if len(ns.paths) == 0 && len(ns.routes) == 0 {
+			delete(t.namespaces, id)
+		}
+	}
+	t.lastPrune = now
+}
+
+func (t *Table) routeKey(src, dst net.IP) string {
+	mask := net.CIDRMask(t.prefixLen, 128)
+	return fmt.Sprintf("%s/%d -> %s/%d", src.Mask(mask), t.prefixLen, dst.Mask(mask), t.prefixLen)
+}
+
+func pathKey(hops []Hop) string {
+	var b strings.Builder
+	for i, hop := range hops {
+		if i > 0 {
+			b.WriteString(" -> ")
+		}
+		fmt.Fprintf(&b, "%d(%d/%d)", hop.Node, hop.Ingress, hop.Egress)
+	}
+	return b.String()
+}
+
+// NamespaceTopology is the exported view of a namespace.
+type NamespaceTopology struct {
+	Namespace uint32   `json:"namespace"`
+	Nodes     []uint64 `json:"nodes"`
+	Links     []Link   `json:"links"`
+	Paths     []Path   `json:"paths"`
+}
+
+// Snapshot returns a copy of the current topology, sorted by namespace.
+func (t *Table) Snapshot() []NamespaceTopology {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	topo := make([]NamespaceTopology, 0, len(t.namespaces))
+	for id, ns := range t.namespaces {
+		nt := NamespaceTopology{Namespace: id}
+		nodes := make(map[uint64]bool)
+		for _, path := range ns.paths {
+			p := *path
+			p.Hops = append([]Hop(nil), path.Hops...)
+			nt.Paths = append(nt.Paths, p)
+			for _, hop := range path.Hops {
+				nodes[hop.Node] = true
+			}
+		}
+		for node := range nodes {
+			nt.Nodes = append(nt.Nodes, node)
+		}
+		for _, link := range ns.links {
+			nt.Links = append(nt.Links, *link)
+		}
+
+		sort.Slice(nt.Nodes, func(i, j int) bool { return nt.Nodes[i] < nt.Nodes[j] })
+		sort.Slice(nt.Links, func(i, j int) bool {
+			if nt.Links[i].From != nt.Links[j].From {
+				return nt.Links[i].From < nt.Links[j].From
+			}
+			return nt.Links[i].To < nt.Links[j].To
+		})
+		sort.Slice(nt.Paths, func(i, j int) bool { return nt.Paths[i].Packets > nt.Paths[j].Packets })
+		topo = append(topo, nt)
+	}
+	sort.Slice(topo, func(i, j int) bool { return topo[i].Namespace < topo[j].Namespace })
+
+	return topo
+}
+
+// WriteJSON exports the topology in JSON.
+func (t *Table) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t.Snapshot())
+}
+
+// WriteDOT exports the topology in Graphviz DOT format, one cluster per
+// namespace.
+func (t *Table) WriteDOT(w io.Writer) error {
+	var inv *inventory.Inventory
+	if t.inventory != nil {
+		inv = t.inventory()
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph ioam {\n")
+	for _, nt := range t.Snapshot() {
+		fmt.Fprintf(&b, "  subgraph cluster_ns%d {\n", nt.Namespace)
+		fmt.Fprintf(&b, "    label=\"namespace %d\";\n", nt.Namespace)
+		for _, node := range nt.Nodes {
+			label := strconv.FormatUint(node, 10)
+			if n := inv.Node(nt.Namespace, node); n != nil && n.Hostname != "" {
+				label = n.Hostname
+			}
+			fmt.Fprintf(&b, "    \"%d/%d\" [label=%q];\n", nt.Namespace, node, label)
+		}
+		for _, link := range nt.Links {
+			fmt.Fprintf(&b, "    \"%d/%d\" -> \"%d/%d\" [label=\"%s -> %s\\n%d pkts\"];\n",
+				nt.Namespace, link.From, nt.Namespace, link.To,
+				interfaceLabel(inv.Node(nt.Namespace, link.From), link.Egress),
+				interfaceLabel(inv.Node(nt.Namespace, link.To), link.Ingress), link.Packets)
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// interfaceLabel returns the name of an interface of the node in the
+// inventory, or its ID.
+func interfaceLabel(node *inventory.Node, id uint32) string {
+	if name := node.Interface(id); name != "" {
+		return strings.NewReplacer("\"", "", "\\", "").Replace(name)
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// ServeJSON is an HTTP handler exporting the topology in JSON.
+func (t *Table) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t.WriteJSON(w)
+}
+
+// ServeDOT is an HTTP handler exporting the topology in DOT format.
+func (t *Table) ServeDOT(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/vnd.graphviz")
+	t.WriteDOT(w)
+}
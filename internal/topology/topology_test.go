@@ -0,0 +1,97 @@
+package topology
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "github.com/Advanced-Observability/ioam-api"
+)
+
+func pathTrace(src, dst string, nodes ...uint32) *report.Trace {
+	trace := &ioamAPI.IOAMTrace{
+		NamespaceId: 1,
+		BitField:    uint32(ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeInterfaceIDs),
+		Flow:        &ioamAPI.Flow{SrcAddr: net.ParseIP(src), DstAddr: net.ParseIP(dst)},
+	}
+	for _, id := range nodes {
+		trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: id, IngressId: 1, EgressId: 2})
+	}
+	return &report.Trace{IOAMTrace: trace}
+}
+
+func TestRouteChanges(t *testing.T) {
+	var events []Event
+	table := NewTable(64, func(ev Event) { events = append(events, ev) })
+
+	table.Observe(pathTrace("2001:db8:1::1", "2001:db8:2::1", 1, 2, 4))
+	table.Observe(pathTrace("2001:db8:1::2", "2001:db8:2::2", 1, 2, 4))
+	if len(events) != 0 {
+		t.Fatalf("%d events for a single path", len(events))
+	}
+
+	// ECMP: the first trace on the second path is a change, not the next ones
+	for range 3 {
+		table.Observe(pathTrace("2001:db8:1::1", "2001:db8:2::1", 1, 3, 4))
+		table.Observe(pathTrace("2001:db8:1::2", "2001:db8:2::2", 1, 2, 4))
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events for alternating paths, want 1", len(events))
+	}
+	want := Event{Namespace: 1, Route: "2001:db8:1::/64 -> 2001:db8:2::/64", Old: "1(1/2) -> 2(1/2) -> 4(1/2)", New: "1(1/2) -> 3(1/2) -> 4(1/2)"}
+	if events[0] != want {
+		t.Errorf("event %+v, want %+v", events[0], want)
+	}
+
+	// Another route
+	table.Observe(pathTrace("2001:db8:3::1", "2001:db8:2::1", 1, 3, 4))
+	if len(events) != 1 {
+		t.Fatalf("%d events, a new route is not a change", len(events))
+	}
+
+	// The first path is no longer active
+	r := table.namespaces[1].routes[want.Route]
+	r.active[want.Old] = time.Now().Add(-activeTTL - time.Second)
+	table.Observe(pathTrace("2001:db8:1::1", "2001:db8:2::1", 1, 3, 4))
+	table.Observe(pathTrace("2001:db8:1::1", "2001:db8:2::1", 1, 2, 4))
+	if len(events) != 2 || events[1].Old != want.New || events[1].New != want.Old {
+		t.Errorf("events %+v, want a change back to the first path", events)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	table := NewTable(128, nil)
+	table.Observe(pathTrace("2001:db8::1", "2001:db8::2", 1, 2, 3))
+	table.Observe(pathTrace("2001:db8::1", "2001:db8::3", 1, 2, 4))
+
+	old := time.Now().Add(-ttl - time.Second)
+	ns := table.namespaces[1]
+	ns.paths["1(1/2) -> 2(1/2) -> 4(1/2)"].LastSeen = old
+	ns.routes["2001:db8::1/128 -> 2001:db8::3/128"].lastSeen = old
+	ns.links[Link{From: 2, Egress: 2, To: 4, Ingress: 1}].LastSeen = old
+
+	table.prune(time.Now())
+	topo := table.Snapshot()
+	if len(topo) != 1 || len(topo[0].Paths) != 1 || len(topo[0].Links) != 2 || len(topo[0].Nodes) != 3 {
+		t.Fatalf("Snapshot() = %+v, want the path through 3 only", topo)
+	}
+	if len(ns.routes) != 1 {
+		t.Errorf("%d routes, want 1", len(ns.routes))
+	}
+
+	for _, path := range ns.paths {
+		path.LastSeen = old
+	}
+	for _, link := range ns.links {
+		link.LastSeen = old
+	}
+	for _, r := range ns.routes {
+		r.lastSeen = old
+	}
+	table.prune(time.Now())
+	if topo := table.Snapshot(); len(topo) != 0 {
+		t.Errorf("Snapshot() = %+v, want an empty topology", topo)
+	}
+}
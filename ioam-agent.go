@@ -4,40 +4,181 @@
 package main
 
 import (
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	ioamAPI "github.com/Advanced-Observability/ioam-api"
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 
+	"github.com/Advanced-Observability/ioam-agent/internal/aggregate"
+	"github.com/Advanced-Observability/ioam-agent/internal/alert"
 	"github.com/Advanced-Observability/ioam-agent/internal/capture"
+	"github.com/Advanced-Observability/ioam-agent/internal/completeness"
 	"github.com/Advanced-Observability/ioam-agent/internal/config"
+	"github.com/Advanced-Observability/ioam-agent/internal/delay"
+	"github.com/Advanced-Observability/ioam-agent/internal/namespace"
+	"github.com/Advanced-Observability/ioam-agent/internal/oss"
 	"github.com/Advanced-Observability/ioam-agent/internal/parser"
+	"github.com/Advanced-Observability/ioam-agent/internal/report"
 	"github.com/Advanced-Observability/ioam-agent/internal/reporter"
+	"github.com/Advanced-Observability/ioam-agent/internal/shard"
 	"github.com/Advanced-Observability/ioam-agent/internal/stats"
+	"github.com/Advanced-Observability/ioam-agent/internal/topology"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
 )
 
 func main() {
 	cfg := config.ParseFlags()
-	source, err := capture.InitializeCapture(cfg.Interface)
+	source, linkType, err := capture.InitializeCapture(cfg.Interface)
 	if err != nil {
 		log.Fatalf("Failed to initialize capture: %v", err)
 	}
 
 	reportFunc := reporter.SetupReporting(cfg)
-	go stats.WriteStats(cfg.Statfile, cfg.Interface, cfg.Interval)
+	delays := delay.NewAnalyzer(cfg)
+	stats.AddSection(delays.WriteStats)
+	stats.AddSection(parser.WriteStats)
+	stats.AddSection(parser.WriteFlagStats)
+	stats.AddSection(parser.WriteChecksumStats)
+	paths := completeness.NewAnalyzer()
+	stats.AddSection(paths.WriteStats)
+	registry := namespace.NewRegistry(cfg.Namespaces)
+	if registry != nil {
+		stats.AddSection(registry.WriteStats)
+	}
+	schemas, err := oss.NewRegistry(cfg.OSSSchemas)
+	if err != nil {
+		log.Fatalf("Failed to initialize OSS decoders: %v", err)
+	}
+	if schemas != nil {
+		stats.AddSection(schemas.WriteStats)
+	}
+
+	topo := topology.NewTable(cfg.PrefixLen, func(ev topology.Event) {
+		atomic.AddUint64(&stats.RouteChangeCount, 1)
+		log.Printf("[IOAM Agent] Path change in namespace %d for %s: %s => %s", ev.Namespace, ev.Route, ev.Old, ev.New)
+	})
 
-	packets := make(chan gopacket.Packet, cfg.Workers)
-	for w := uint(1); w <= cfg.Workers; w++ {
-		go worker(w, packets, reportFunc)
+	var nodes *inventory.Watcher
+	if cfg.Inventory.File != "" {
+		logf := func(format string, v ...any) { log.Printf("[IOAM Agent] "+format, v...) }
+		if nodes, err = inventory.Watch(cfg.Inventory.File, time.Duration(cfg.Inventory.Reload), logf); err != nil {
+			log.Fatalf("Failed to load inventory: %v", err)
+		}
+		topo.SetInventory(nodes.Inventory)
+		delays.SetInventory(nodes.Inventory)
 	}
 
-	for packet := range source.Packets() {
-		packets <- packet
+	if cfg.Listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/topology.json", topo.ServeJSON)
+		mux.HandleFunc("/topology.dot", topo.ServeDOT)
+		go func() {
+			log.Fatal(http.ListenAndServe(cfg.Listen, mux))
+		}()
 	}
-}
 
-func worker(id uint, packets <-chan gopacket.Packet, report func(*ioamAPI.IOAMTrace)) {
-	for packet := range packets {
-		parser.ParsePacket(packet, report)
+	alerts, err := alert.NewEvaluator(cfg.Alerts)
+	if err != nil {
+		log.Fatalf("Failed to initialize alerts: %v", err)
+	}
+
+	var aggregator *aggregate.Aggregator
+	if cfg.Aggregate > 0 {
+		log.Printf("[IOAM Agent] Aggregating IOAM traces every %s...", cfg.Aggregate)
+		aggregator = aggregate.New(cfg.Aggregate, cfg.Sample, reportFunc)
+		reportFunc = aggregator.Add
+
+		// The summaries of the last window are reported on exit
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			aggregator.Close()
+			os.Exit(0)
+		}()
+	}
+
+	// Loopback and active measurement traces may be dropped or only sent to
+	// the separate sink, without updating the link delays, topology, alerts
+	// and summaries
+	separate := reporter.SetupSeparateReporting(cfg)
+	process := func(trace *report.Trace) {
+		handling := cfg.Flags.Handling(trace.GetLoopback(), trace.GetActive())
+		if handling == config.FlagDrop {
+			return
+		}
+		if registry != nil {
+			registry.Annotate(trace)
+		}
+		if schemas != nil {
+			schemas.Decode(trace)
+		}
+		if nodes != nil {
+			trace.Label(nodes.Inventory())
+		}
+		if cfg.Checksum.Flag && trace.Corrupted() {
+			trace.Checksum.Corrupted = true
+		}
+		if handling == config.FlagSeparate {
+			trace.Delays = delay.Compute(trace.IOAMTrace, cfg.TimestampFormat(trace.GetNamespaceId()))
+			separate(trace)
+			return
+		}
+
+		delays.Analyze(trace)
+		topo.Observe(trace)
+		paths.Observe(trace)
+		if alerts != nil {
+			alerts.Evaluate(trace)
+		}
+		reportFunc(trace)
+	}
+
+	// The capture reuses its buffer, so every packet is copied into one of
+	// these buffers, handed back by the workers once the packet is decoded.
+	// There are enough for all the queues to be full while every worker
+	// decodes a packet and the next one is read.
+	buffers := make(chan []byte, cfg.Workers*(cfg.QueueSize+1)+1)
+	for i := 0; i < cap(buffers); i++ {
+		buffers <- make([]byte, 0, 2048)
+	}
+
+	lenient := cfg.ParseMode == config.ParseLenient
+	decoders := make([]*parser.Decoder, cfg.Workers)
+	for i := range decoders {
+		decoders[i] = parser.NewDecoder(lenient)
+	}
+	workers := shard.New(cfg.Workers, cfg.QueueSize, cfg.PinWorkers, func(w int, data []byte) {
+		if linkType == layers.LinkTypeEthernet {
+			decoders[w].Decode(data, process)
+		} else {
+			parser.ParsePacket(gopacket.NewPacket(data, linkType, gopacket.Default), lenient, process)
+		}
+		buffers <- data[:0]
+	})
+	stats.AddSection(workers.WriteStats)
+	go stats.WriteStats(cfg.Statfile, cfg.Interface, cfg.Interval)
+
+	for {
+		data, _, err := source.ZeroCopyReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			workers.Close()
+			if aggregator != nil {
+				aggregator.Close()
+			}
+			return
+		}
+		if err != nil {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		workers.Dispatch(parser.FlowHash(data, linkType), append(<-buffers, data...))
 	}
 }
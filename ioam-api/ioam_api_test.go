@@ -0,0 +1,77 @@
+package ioam_api
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "update the wire format test file")
+
+// wireFile holds the encoding of wireTrace. The collector, which has its
+// own copy of ioam_api.proto, checks that it decodes it to the same trace.
+const wireFile = "testdata/trace.pb"
+
+// wireTrace sets every field of the trace, with distinct values.
+func wireTrace() *IOAMTrace {
+	return &IOAMTrace{
+		NamespaceId: 123,
+		BitField:    0xFFF002,
+		Nodes: []*IOAMNode{{
+			HopLimit: 64, Id: 1, IngressId: 2, EgressId: 3, TimestampSecs: 4, TimestampFrac: 5,
+			TransitDelay: 6, QueueDepth: 7, CsumComp: 8, BufferOccupancy: 9, IngressIdWide: 10,
+			EgressIdWide: 11, IdWide: 12, NamespaceData: []byte{13, 13, 13, 13},
+			NamespaceDataWide: []byte{14, 14, 14, 14, 14, 14, 14, 14},
+			OSS:               &Opaque{SchemaId: 15, Data: []byte{16, 16, 16, 16}, Fields: []*OSSField{{Name: "a", Value: "1"}}},
+			NamespaceDataText: "17", NamespaceDataWideText: "18",
+			Labels: &NodeLabels{Hostname: "r1", Site: "s", Role: "core", IngressName: "eth0", EgressName: "eth1"},
+		}},
+		Flow: &Flow{
+			SrcAddr: bytes.Repeat([]byte{1}, 16), DstAddr: bytes.Repeat([]byte{2}, 16),
+			NextHeader: 41, SrcPort: 3, DstPort: 4, FlowLabel: 5,
+			Inner: &Flow{NextHeader: 17, SrcPort: 6, DstPort: 7},
+		},
+		Summary: &Summary{Packets: 20, Start: 21, End: 22, Nodes: []*NodeSummary{{Fields: []*FieldSummary{
+			{Name: "queue_depth", Min: 1, Max: 2, Avg: 1.5, P50: 1, P90: 2, P99: 2},
+		}}}},
+		Overflow:     true,
+		Loopback:     true,
+		Active:       true,
+		Completeness: &Completeness{Preallocated: true, Allocated: 4, Filled: 1, Gaps: []uint32{2}, Missing: 2, Undersized: true},
+		Namespace:    &Namespace{Name: "dc", Unknown: true, UnexpectedNodes: []uint32{0}, UnexpectedSchemas: []uint32{0}},
+		Checksum:     &Checksum{Verified: true, Valid: true, Mismatches: []uint32{0}, Corrupted: true},
+		TraceId_High: 30,
+		TraceId_Low:  31,
+		SpanId:       32,
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(wireTrace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(wireFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(wireFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("encoding differs from %s, run with -update if the change is compatible", wireFile)
+	}
+	var trace IOAMTrace
+	if err := proto.Unmarshal(want, &trace); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&trace, wireTrace()) {
+		t.Errorf("decoded %v, want %v", &trace, wireTrace())
+	}
+}
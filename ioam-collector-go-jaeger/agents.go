@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// gRPC metadata sent by the agents when they open a stream
+const (
+	MetadataHostname   = "ioam-agent-hostname"
+	MetadataInterface  = "ioam-agent-interface"
+	MetadataVersion    = "ioam-agent-version"
+	MetadataConfigHash = "ioam-agent-config-hash"
+)
+
+// Agent attributes
+const (
+	AttrAgentAddress    = attribute.Key("ioam.agent.address")
+	AttrAgentHostname   = attribute.Key("ioam.agent.hostname")
+	AttrAgentInterface  = attribute.Key("ioam.agent.interface")
+	AttrAgentVersion    = attribute.Key("ioam.agent.version")
+	AttrAgentConfigHash = attribute.Key("ioam.agent.config_hash")
+)
+
+// AgentInfo describes an agent connected to the collector, identified by the
+// metadata of its stream.
+type AgentInfo struct {
+	Address    string    `json:"address"`
+	Hostname   string    `json:"hostname,omitempty"`
+	Interface  string    `json:"interface,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	Connected  time.Time `json:"connected"`
+	LastSeen   time.Time `json:"last_seen"`
+	Traces     uint64    `json:"traces"`
+}
+
+// Agent is the state of a stream opened by an agent.
+type Agent struct {
+	AgentInfo
+
+	lastSeen atomic.Int64 // Unix time in ns, updated without the registry lock
+	traces   atomic.Uint64
+}
+
+// NewAgent identifies the agent at the other end of a stream.
+func NewAgent(ctx context.Context) *Agent {
+	a := &Agent{AgentInfo: AgentInfo{Address: "unknown", Connected: time.Now()}}
+	if p, ok := peer.FromContext(ctx); ok {
+		a.Address = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		a.Hostname = first(md.Get(MetadataHostname))
+		a.Interface = first(md.Get(MetadataInterface))
+		a.Version = first(md.Get(MetadataVersion))
+		a.ConfigHash = first(md.Get(MetadataConfigHash))
+	}
+	a.lastSeen.Store(a.Connected.UnixNano())
+	return a
+}
+
+// Name identifies the agent in logs and metrics: hostname/interface if the
+// agent sent them, its address otherwise.
+func (a *Agent) Name() string {
+	switch {
+	case a.Hostname != "" && a.Interface != "":
+		return a.Hostname + "/" + a.Interface
+	case a.Hostname != "":
+		return a.Hostname
+	}
+	return a.Address
+}
+
+// Attributes describes the agent on the trace spans.
+func (a *Agent) Attributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{AttrAgentAddress.String(a.Address)}
+	if a.Hostname != "" {
+		attrs = append(attrs, AttrAgentHostname.String(a.Hostname))
+	}
+	if a.Interface != "" {
+		attrs = append(attrs, AttrAgentInterface.String(a.Interface))
+	}
+	if a.Version != "" {
+		attrs = append(attrs, AttrAgentVersion.String(a.Version))
+	}
+	if a.ConfigHash != "" {
+		attrs = append(attrs, AttrAgentConfigHash.String(a.ConfigHash))
+	}
+	return attrs
+}
+
+// Seen accounts a trace received from the agent.
+func (a *Agent) Seen(now time.Time) {
+	a.lastSeen.Store(now.UnixNano())
+	a.traces.Add(1)
+}
+
+// Agents is the registry of the connected agents, one entry per stream.
+type Agents struct {
+	mu     sync.Mutex
+	agents map[*Agent]struct{}
+}
+
+func NewAgents() *Agents {
+	return &Agents{agents: make(map[*Agent]struct{})}
+}
+
+func (r *Agents) Add(a *Agent) {
+	r.mu.Lock()
+	r.agents[a] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *Agents) Remove(a *Agent) {
+	r.mu.Lock()
+	delete(r.agents, a)
+	r.mu.Unlock()
+}
+
+// List returns the connected agents, by connection time.
+func (r *Agents) List() []AgentInfo {
+	r.mu.Lock()
+	list := make([]AgentInfo, 0, len(r.agents))
+	for a := range r.agents {
+		info := a.AgentInfo
+		info.LastSeen = time.Unix(0, a.lastSeen.Load())
+		info.Traces = a.traces.Load()
+		list = append(list, info)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Connected.Before(list[j].Connected) })
+	return list
+}
+
+// ServeHTTP lists the connected agents in JSON.
+func (r *Agents) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.List())
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
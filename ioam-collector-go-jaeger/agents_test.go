@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestAgent(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv6loopback, Port: 4000}})
+	anonymous := NewAgent(ctx)
+	if name := anonymous.Name(); name != "[::1]:4000" {
+		t.Errorf("Name() = %q, want the address", name)
+	}
+	if attrs := anonymous.Attributes(); len(attrs) != 1 {
+		t.Errorf("Attributes() = %v, want the address only", attrs)
+	}
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(
+		MetadataHostname, "h1", MetadataInterface, "eth0", MetadataVersion, "v1.2", MetadataConfigHash, "abc"))
+	a := NewAgent(ctx)
+	if name := a.Name(); name != "h1/eth0" {
+		t.Errorf("Name() = %q, want h1/eth0", name)
+	}
+	if attrs := a.Attributes(); len(attrs) != 5 {
+		t.Errorf("Attributes() = %v, want 5", attrs)
+	}
+}
+
+func TestAgentsHandler(t *testing.T) {
+	r := NewAgents()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataHostname, "h1", MetadataVersion, "v1.2"))
+	a := NewAgent(ctx)
+	time.Sleep(time.Millisecond)
+	b, c := NewAgent(context.Background()), NewAgent(context.Background())
+	for _, agent := range []*Agent{b, a, c} {
+		r.Add(agent)
+	}
+	r.Remove(c)
+
+	seen := a.Connected.Add(time.Minute)
+	a.Seen(a.Connected.Add(time.Second))
+	a.Seen(seen)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/agents", nil))
+	var agents []AgentInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+
+	// By connection time
+	if len(agents) != 2 {
+		t.Fatalf("%d agents, want 2", len(agents))
+	}
+	got := agents[0]
+	if got.Hostname != "h1" || got.Version != "v1.2" || got.Address != "unknown" || got.Traces != 2 || !got.LastSeen.Equal(seen) {
+		t.Errorf("agent %+v, want h1 seen twice, last at %v", got, seen)
+	}
+	if got := agents[1]; got.Traces != 0 || !got.LastSeen.Equal(got.Connected) {
+		t.Errorf("agent %+v, want no trace, last seen when connected", got)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// wireTrace is the trace encoded in the wire format test file of the agent
+// API, built with the copy of ioam_api.proto of the collector.
+func wireTrace() *ioamAPI.IOAMTrace {
+	return &ioamAPI.IOAMTrace{
+		NamespaceId: 123,
+		BitField:    0xFFF002,
+		Nodes: []*ioamAPI.IOAMNode{{
+			HopLimit: 64, Id: 1, IngressId: 2, EgressId: 3, TimestampSecs: 4, TimestampFrac: 5,
+			TransitDelay: 6, QueueDepth: 7, CsumComp: 8, BufferOccupancy: 9, IngressIdWide: 10,
+			EgressIdWide: 11, IdWide: 12, NamespaceData: []byte{13, 13, 13, 13},
+			NamespaceDataWide: []byte{14, 14, 14, 14, 14, 14, 14, 14},
+			OSS:               &ioamAPI.Opaque{SchemaId: 15, Data: []byte{16, 16, 16, 16}, Fields: []*ioamAPI.OSSField{{Name: "a", Value: "1"}}},
+			NamespaceDataText: "17", NamespaceDataWideText: "18",
+			Labels: &ioamAPI.NodeLabels{Hostname: "r1", Site: "s", Role: "core", IngressName: "eth0", EgressName: "eth1"},
+		}},
+		Flow: &ioamAPI.Flow{
+			SrcAddr: bytes.Repeat([]byte{1}, 16), DstAddr: bytes.Repeat([]byte{2}, 16),
+			NextHeader: 41, SrcPort: 3, DstPort: 4, FlowLabel: 5,
+			Inner: &ioamAPI.Flow{NextHeader: 17, SrcPort: 6, DstPort: 7},
+		},
+		Summary: &ioamAPI.Summary{Packets: 20, Start: 21, End: 22, Nodes: []*ioamAPI.NodeSummary{{Fields: []*ioamAPI.FieldSummary{
+			{Name: "queue_depth", Min: 1, Max: 2, Avg: 1.5, P50: 1, P90: 2, P99: 2},
+		}}}},
+		Overflow:     true,
+		Loopback:     true,
+		Active:       true,
+		Completeness: &ioamAPI.Completeness{Preallocated: true, Allocated: 4, Filled: 1, Gaps: []uint32{2}, Missing: 2, Undersized: true},
+		Namespace:    &ioamAPI.Namespace{Name: "dc", Unknown: true, UnexpectedNodes: []uint32{0}, UnexpectedSchemas: []uint32{0}},
+		Checksum:     &ioamAPI.Checksum{Verified: true, Valid: true, Mismatches: []uint32{0}, Corrupted: true},
+		TraceId_High: 30,
+		TraceId_Low:  31,
+		SpanId:       32,
+	}
+}
+
+// TestWireFormat checks that the traces sent by the agent are decoded as
+// such, the collector having its own copy of ioam_api.proto.
+func TestWireFormat(t *testing.T) {
+	agent, err := os.ReadFile("../ioam-api/testdata/trace.pb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trace ioamAPI.IOAMTrace
+	if err := proto.Unmarshal(agent, &trace); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&trace, wireTrace()) {
+		t.Errorf("decoded %v, want %v", &trace, wireTrace())
+	}
+	if len(trace.ProtoReflect().GetUnknown()) != 0 {
+		t.Error("unknown fields in the trace of the agent")
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(wireTrace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, agent) {
+		t.Error("encoding differs from the one of the agent")
+	}
+}
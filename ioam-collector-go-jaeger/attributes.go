@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/hex"
+	"net"
+	"slices"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// Span attributes. Numeric IOAM fields are int64, namespace data and opaque
+// state snapshots are hex strings.
+const (
+	AttrNamespaceID = attribute.Key("ioam.namespace_id")
+	AttrTraceType   = attribute.Key("ioam.trace_type")
+	AttrNodeCount   = attribute.Key("ioam.node_count")
+	AttrHop         = attribute.Key("ioam.hop")
+
+	AttrOverflow = attribute.Key("ioam.flags.overflow")
+	AttrLoopback = attribute.Key("ioam.flags.loopback")
+	AttrActive   = attribute.Key("ioam.flags.active")
+
+	AttrNamespaceName    = attribute.Key("ioam.namespace.name")
+	AttrNamespaceUnknown = attribute.Key("ioam.namespace.unknown")
+
+	AttrPreallocated = attribute.Key("ioam.completeness.preallocated")
+	AttrAllocated    = attribute.Key("ioam.completeness.allocated")
+	AttrFilled       = attribute.Key("ioam.completeness.filled")
+	AttrGaps         = attribute.Key("ioam.completeness.gaps")
+	AttrMissingHops  = attribute.Key("ioam.completeness.missing_hops")
+	AttrUndersized   = attribute.Key("ioam.completeness.undersized")
+
+	AttrHopLimit          = attribute.Key("ioam.node.hop_limit")
+	AttrNodeID            = attribute.Key("ioam.node.id")
+	AttrIngressID         = attribute.Key("ioam.node.ingress_id")
+	AttrEgressID          = attribute.Key("ioam.node.egress_id")
+	AttrTimestampSecs     = attribute.Key("ioam.node.timestamp_secs")
+	AttrTimestampFrac     = attribute.Key("ioam.node.timestamp_frac")
+	AttrTransitDelay      = attribute.Key("ioam.node.transit_delay")
+	AttrNamespaceData     = attribute.Key("ioam.node.namespace_data")
+	AttrQueueDepth        = attribute.Key("ioam.node.queue_depth")
+	AttrCsumComp          = attribute.Key("ioam.node.csum_comp")
+	AttrNodeIDWide        = attribute.Key("ioam.node.id_wide")
+	AttrIngressIDWide     = attribute.Key("ioam.node.ingress_id_wide")
+	AttrEgressIDWide      = attribute.Key("ioam.node.egress_id_wide")
+	AttrNamespaceDataWide = attribute.Key("ioam.node.namespace_data_wide")
+	AttrBufferOccupancy   = attribute.Key("ioam.node.buffer_occupancy")
+	AttrOSSSchemaID       = attribute.Key("ioam.node.oss.schema_id")
+	AttrOSSData           = attribute.Key("ioam.node.oss.data")
+
+	AttrHostname    = attribute.Key("ioam.node.hostname")
+	AttrSite        = attribute.Key("ioam.node.site")
+	AttrRole        = attribute.Key("ioam.node.role")
+	AttrIngressName = attribute.Key("ioam.node.ingress_name")
+	AttrEgressName  = attribute.Key("ioam.node.egress_name")
+
+	AttrNamespaceDataText     = attribute.Key("ioam.node.namespace_data_text")
+	AttrNamespaceDataWideText = attribute.Key("ioam.node.namespace_data_wide_text")
+	AttrUnexpectedNode        = attribute.Key("ioam.node.unexpected")
+	AttrUnexpectedSchema      = attribute.Key("ioam.node.oss.unexpected_schema")
+
+	AttrChecksumVerified   = attribute.Key("ioam.checksum.verified")
+	AttrChecksumValid      = attribute.Key("ioam.checksum.valid")
+	AttrChecksumMismatches = attribute.Key("ioam.checksum.mismatches")
+	AttrChecksumCorrupted  = attribute.Key("ioam.checksum.corrupted")
+	AttrChecksumMismatch   = attribute.Key("ioam.node.checksum_mismatch")
+
+	AttrFlowSrcAddr    = attribute.Key("ioam.flow.src_addr")
+	AttrFlowDstAddr    = attribute.Key("ioam.flow.dst_addr")
+	AttrFlowNextHeader = attribute.Key("ioam.flow.next_header")
+	AttrFlowSrcPort    = attribute.Key("ioam.flow.src_port")
+	AttrFlowDstPort    = attribute.Key("ioam.flow.dst_port")
+	AttrFlowLabel      = attribute.Key("ioam.flow.label")
+
+	AttrSummaryPackets = attribute.Key("ioam.summary.packets")
+)
+
+// NodeAttributes returns one attribute per field of the node included in
+// the trace type.
+func NodeAttributes(node *ioamAPI.IOAMNode, fields ioam.TraceType) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	if fields&ioam.TraceTypeHopLimitNodeID != 0 {
+		attrs = append(attrs,
+			AttrHopLimit.Int64(int64(node.GetHopLimit())),
+			AttrNodeID.Int64(int64(node.GetId())))
+	}
+	if fields&ioam.TraceTypeInterfaceIDs != 0 {
+		attrs = append(attrs,
+			AttrIngressID.Int64(int64(node.GetIngressId())),
+			AttrEgressID.Int64(int64(node.GetEgressId())))
+	}
+	if fields&ioam.TraceTypeTimestampSecs != 0 {
+		attrs = append(attrs, AttrTimestampSecs.Int64(int64(node.GetTimestampSecs())))
+	}
+	if fields&ioam.TraceTypeTimestampFrac != 0 {
+		attrs = append(attrs, AttrTimestampFrac.Int64(int64(node.GetTimestampFrac())))
+	}
+	if fields&ioam.TraceTypeTransitDelay != 0 {
+		attrs = append(attrs, AttrTransitDelay.Int64(int64(node.GetTransitDelay())))
+	}
+	if fields&ioam.TraceTypeNamespaceData != 0 {
+		attrs = append(attrs, AttrNamespaceData.String(hex.EncodeToString(node.GetNamespaceData())))
+	}
+	if fields&ioam.TraceTypeQueueDepth != 0 {
+		attrs = append(attrs, AttrQueueDepth.Int64(int64(node.GetQueueDepth())))
+	}
+	if fields&ioam.TraceTypeChecksumComplement != 0 {
+		attrs = append(attrs, AttrCsumComp.Int64(int64(node.GetCsumComp())))
+	}
+	if fields&ioam.TraceTypeHopLimitNodeIDWide != 0 {
+		attrs = append(attrs,
+			AttrHopLimit.Int64(int64(node.GetHopLimit())),
+			AttrNodeIDWide.Int64(int64(node.GetIdWide())))
+	}
+	if fields&ioam.TraceTypeInterfaceIDsWide != 0 {
+		attrs = append(attrs,
+			AttrIngressIDWide.Int64(int64(node.GetIngressIdWide())),
+			AttrEgressIDWide.Int64(int64(node.GetEgressIdWide())))
+	}
+	if fields&ioam.TraceTypeNamespaceDataWide != 0 {
+		attrs = append(attrs, AttrNamespaceDataWide.String(hex.EncodeToString(node.GetNamespaceDataWide())))
+	}
+	if fields&ioam.TraceTypeBufferOccupancy != 0 {
+		attrs = append(attrs, AttrBufferOccupancy.Int64(int64(node.GetBufferOccupancy())))
+	}
+	if fields&ioam.TraceTypeOSS != 0 {
+		attrs = append(attrs, AttrOSSSchemaID.Int64(int64(node.GetOSS().GetSchemaId())))
+		if len(node.GetOSS().GetFields()) > 0 {
+			attrs = append(attrs, OSSFieldAttributes(node.GetOSS())...)
+		} else {
+			attrs = append(attrs, AttrOSSData.String(hex.EncodeToString(node.GetOSS().GetData())))
+		}
+	}
+
+	return attrs
+}
+
+// OSSFieldAttributes describes the fields of an opaque state snapshot
+// decoded by the agent, as ioam.node.oss.fields.<name>: integers if the
+// value is one, strings otherwise.
+func OSSFieldAttributes(oss *ioamAPI.Opaque) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(oss.GetFields()))
+	for _, field := range oss.GetFields() {
+		key := attribute.Key("ioam.node.oss.fields." + field.GetName())
+		if v, err := strconv.ParseInt(field.GetValue(), 10, 64); err == nil {
+			attrs = append(attrs, key.Int64(v))
+		} else {
+			attrs = append(attrs, key.String(field.GetValue()))
+		}
+	}
+	return attrs
+}
+
+// FlowAttributes describes the innermost flow of an IOAM trace, i.e. the
+// encapsulated packet when IPv6-in-IPv6 encapsulation is used.
+func FlowAttributes(flow *ioamAPI.Flow) []attribute.KeyValue {
+	for flow.GetInner() != nil {
+		flow = flow.GetInner()
+	}
+
+	return []attribute.KeyValue{
+		AttrFlowSrcAddr.String(net.IP(flow.GetSrcAddr()).String()),
+		AttrFlowDstAddr.String(net.IP(flow.GetDstAddr()).String()),
+		AttrFlowNextHeader.Int64(int64(flow.GetNextHeader())),
+		AttrFlowSrcPort.Int64(int64(flow.GetSrcPort())),
+		AttrFlowDstPort.Int64(int64(flow.GetDstPort())),
+		AttrFlowLabel.Int64(int64(flow.GetFlowLabel())),
+	}
+}
+
+// NamespaceAttributes describes the namespace of an IOAM trace, as found in
+// the registry of the agent.
+func NamespaceAttributes(ns *ioamAPI.Namespace) []attribute.KeyValue {
+	if ns.GetUnknown() {
+		return []attribute.KeyValue{AttrNamespaceUnknown.Bool(true)}
+	}
+	return []attribute.KeyValue{AttrNamespaceName.String(ns.GetName())}
+}
+
+// NodeLabelAttributes describes a node and its interfaces as named in the
+// inventory, the names that are unknown being left out.
+func NodeLabelAttributes(node *ioamAPI.IOAMNode) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	labels := node.GetLabels()
+	for _, l := range []struct {
+		key   attribute.Key
+		value string
+	}{
+		{AttrHostname, labels.GetHostname()},
+		{AttrSite, labels.GetSite()},
+		{AttrRole, labels.GetRole()},
+		{AttrIngressName, labels.GetIngressName()},
+		{AttrEgressName, labels.GetEgressName()},
+	} {
+		if l.value != "" {
+			attrs = append(attrs, l.key.String(l.value))
+		}
+	}
+
+	return attrs
+}
+
+// NodeNamespaceAttributes describes hop i of an IOAM trace as seen by the
+// namespace registry of the agent: the decoded namespace data, and whether
+// the node ID or OSS schema is not expected in the namespace.
+func NodeNamespaceAttributes(request *ioamAPI.IOAMTrace, i int) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	node := request.GetNodes()[i]
+	if text := node.GetNamespaceDataText(); text != "" {
+		attrs = append(attrs, AttrNamespaceDataText.String(text))
+	}
+	if text := node.GetNamespaceDataWideText(); text != "" {
+		attrs = append(attrs, AttrNamespaceDataWideText.String(text))
+	}
+	if slices.Contains(request.GetNamespace().GetUnexpectedNodes(), uint32(i)) {
+		attrs = append(attrs, AttrUnexpectedNode.Bool(true))
+	}
+	if slices.Contains(request.GetNamespace().GetUnexpectedSchemas(), uint32(i)) {
+		attrs = append(attrs, AttrUnexpectedSchema.Bool(true))
+	}
+
+	return attrs
+}
+
+// CompletenessAttributes describes the completeness of the path recorded
+// in an IOAM trace, computed by the agent.
+func CompletenessAttributes(c *ioamAPI.Completeness) []attribute.KeyValue {
+	gaps := make([]int64, len(c.GetGaps()))
+	for i, gap := range c.GetGaps() {
+		gaps[i] = int64(gap)
+	}
+
+	return []attribute.KeyValue{
+		AttrPreallocated.Bool(c.GetPreallocated()),
+		AttrAllocated.Int64(int64(c.GetAllocated())),
+		AttrFilled.Int64(int64(c.GetFilled())),
+		AttrGaps.Int64Slice(gaps),
+		AttrMissingHops.Int64(int64(c.GetMissing())),
+		AttrUndersized.Bool(c.GetUndersized()),
+	}
+}
+
+// ChecksumAttributes describes the Checksum Complement verification of an
+// IOAM trace by the agent, the mismatches being hop numbers (from 1).
+func ChecksumAttributes(c *ioamAPI.Checksum) []attribute.KeyValue {
+	hops := make([]int64, len(c.GetMismatches()))
+	for i, node := range c.GetMismatches() {
+		hops[i] = int64(node) + 1
+	}
+
+	return []attribute.KeyValue{
+		AttrChecksumVerified.Bool(c.GetVerified()),
+		AttrChecksumValid.Bool(c.GetValid()),
+		AttrChecksumMismatches.Int64Slice(hops),
+		AttrChecksumCorrupted.Bool(c.GetCorrupted()),
+	}
+}
+
+// NodeSummaryAttributes describes the statistics of a node aggregated by the
+// agent, as ioam.summary.<field>.<statistic>.
+func NodeSummaryAttributes(node *ioamAPI.NodeSummary) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	for _, field := range node.GetFields() {
+		prefix := "ioam.summary." + field.GetName() + "."
+		attrs = append(attrs,
+			attribute.Int64(prefix+"min", field.GetMin()),
+			attribute.Float64(prefix+"avg", field.GetAvg()),
+			attribute.Int64(prefix+"max", field.GetMax()),
+			attribute.Int64(prefix+"p50", field.GetP50()),
+			attribute.Int64(prefix+"p90", field.GetP90()),
+			attribute.Int64(prefix+"p99", field.GetP99()))
+	}
+
+	return attrs
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// Timestamp formats of the IOAM timestamp fields (RFC 9197, section 5)
+const (
+	TimestampPOSIX = "posix" // seconds + microseconds since 1970 (Linux default)
+	TimestampPTP   = "ptp"   // truncated PTP: seconds + nanoseconds
+	TimestampNTP   = "ntp"   // NTP 64-bit: seconds since 1900 + 2^-32 fractions
+)
+
+type Config struct {
+	Listen          []string
+	Endpoint        string // OTLP endpoint, host:port or URL (SDK default if empty)
+	Protocol        string // "grpc" or "http"
+	Headers         map[string]string
+	Insecure        bool
+	ServiceName     string
+	Resource        map[string]string
+	TracerName      string
+	BatchSize       int
+	QueueSize       int
+	BatchTimeout    time.Duration
+	TimestampFormat string
+	Legacy          bool
+	Metrics         bool
+	MetricsInterval time.Duration
+	Store           string // Database path, store disabled if empty
+	StoreRetention  time.Duration
+	StoreMaxTraces  int
+	HTTPListen      string // HTTP API listen address, disabled if empty
+	TraceID         string // Trace ID strategy
+	TraceIDBucket   time.Duration
+	MaxNodes        int
+	Namespaces      []uint32 // Allowed namespaces, all if empty
+	Invalid         string   // Handling of the invalid traces
+	Inventory       string   // Inventory file naming the nodes and interfaces, none if empty
+	InventoryReload time.Duration
+}
+
+// option is a setting that can be given, by increasing precedence, in the
+// configuration file, in an environment variable or as a flag.
+type option struct {
+	name   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(cfg *Config, value string) error
+}
+
+var options = []option{
+	{name: "listen", env: "IOAM_COLLECTOR_LISTEN", usage: "Comma-separated gRPC listen addresses (default \":7123\")",
+		set: func(cfg *Config, v string) error {
+			cfg.Listen = splitList(v)
+			if len(cfg.Listen) == 0 {
+				return fmt.Errorf("no listen address")
+			}
+			return nil
+		}},
+	{name: "otlp-endpoint", env: "IOAM_COLLECTOR_OTLP_ENDPOINT", usage: "OTLP endpoint, host:port or URL (default: OTEL_EXPORTER_OTLP_ENDPOINT or SDK default)",
+		set: func(cfg *Config, v string) error { cfg.Endpoint = v; return nil }},
+	{name: "otlp-protocol", env: "IOAM_COLLECTOR_OTLP_PROTOCOL", usage: "OTLP protocol, grpc or http (default \"grpc\")",
+		set: func(cfg *Config, v string) error {
+			switch v {
+			case "grpc", "http":
+				cfg.Protocol = v
+				return nil
+			}
+			return fmt.Errorf("unknown protocol %q", v)
+		}},
+	{name: "otlp-headers", env: "IOAM_COLLECTOR_OTLP_HEADERS", usage: "Comma-separated key=value headers sent to the OTLP endpoint",
+		set: func(cfg *Config, v string) (err error) { cfg.Headers, err = parseKeyValues(v); return }},
+	{name: "otlp-insecure", env: "IOAM_COLLECTOR_OTLP_INSECURE", usage: "Disable TLS towards the OTLP endpoint (default true)", isBool: true,
+		set: func(cfg *Config, v string) (err error) { cfg.Insecure, err = strconv.ParseBool(v); return }},
+	{name: "service-name", env: "IOAM_COLLECTOR_SERVICE_NAME", usage: "Service name of the trace-level spans (default \"CLT\")",
+		set: func(cfg *Config, v string) error { cfg.ServiceName = v; return nil }},
+	{name: "resource-attributes", env: "IOAM_COLLECTOR_RESOURCE_ATTRIBUTES", usage: "Comma-separated key=value resource attributes",
+		set: func(cfg *Config, v string) (err error) { cfg.Resource, err = parseKeyValues(v); return }},
+	{name: "tracer-name", env: "IOAM_COLLECTOR_TRACER_NAME", usage: "Name of the tracer (default \"ioam-tracer\")",
+		set: func(cfg *Config, v string) error { cfg.TracerName = v; return nil }},
+	{name: "batch-size", env: "IOAM_COLLECTOR_BATCH_SIZE", usage: "Maximum number of spans per OTLP export (default 512)",
+		set: func(cfg *Config, v string) error { return parsePositive(v, &cfg.BatchSize) }},
+	{name: "queue-size", env: "IOAM_COLLECTOR_QUEUE_SIZE", usage: "Maximum number of spans waiting to be exported (default 2048)",
+		set: func(cfg *Config, v string) error { return parsePositive(v, &cfg.QueueSize) }},
+	{name: "batch-timeout", env: "IOAM_COLLECTOR_BATCH_TIMEOUT", usage: "Maximum delay before exporting a batch (default 5s)",
+		set: func(cfg *Config, v string) (err error) { cfg.BatchTimeout, err = time.ParseDuration(v); return }},
+	{name: "timestamp-format", env: "IOAM_COLLECTOR_TIMESTAMP_FORMAT", usage: "Format of the node timestamps: posix, ptp or ntp (default \"posix\")",
+		set: func(cfg *Config, v string) error {
+			switch v {
+			case TimestampPOSIX, TimestampPTP, TimestampNTP:
+				cfg.TimestampFormat = v
+				return nil
+			}
+			return fmt.Errorf("unknown timestamp format %q", v)
+		}},
+	{name: "legacy-attributes", env: "IOAM_COLLECTOR_LEGACY_ATTRIBUTES", usage: "Also export the IOAM nodes as semicolon-separated strings (legacy format)", isBool: true,
+		set: func(cfg *Config, v string) (err error) { cfg.Legacy, err = strconv.ParseBool(v); return }},
+	{name: "metrics", env: "IOAM_COLLECTOR_METRICS", usage: "Export OTLP metrics derived from the IOAM data", isBool: true,
+		set: func(cfg *Config, v string) (err error) { cfg.Metrics, err = strconv.ParseBool(v); return }},
+	{name: "metrics-interval", env: "IOAM_COLLECTOR_METRICS_INTERVAL", usage: "Interval between two exports of the metrics (default 30s)",
+		set: func(cfg *Config, v string) (err error) { cfg.MetricsInterval, err = time.ParseDuration(v); return }},
+	{name: "trace-id", env: "IOAM_COLLECTOR_TRACE_ID", usage: "Trace ID strategy: agent, random or flow (default \"agent\")",
+		set: func(cfg *Config, v string) error {
+			switch v {
+			case TraceIDAgent, TraceIDRandom, TraceIDFlow:
+				cfg.TraceID = v
+				return nil
+			}
+			return fmt.Errorf("unknown trace ID strategy %q", v)
+		}},
+	{name: "trace-id-bucket", env: "IOAM_COLLECTOR_TRACE_ID_BUCKET", usage: "Time bucket of the flow trace ID strategy (default 1m)",
+		set: func(cfg *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			if d <= 0 {
+				return fmt.Errorf("must be positive")
+			}
+			cfg.TraceIDBucket = d
+			return nil
+		}},
+	{name: "max-nodes", env: "IOAM_COLLECTOR_MAX_NODES", usage: "Maximum number of nodes of a valid trace (default 64)",
+		set: func(cfg *Config, v string) error { return parsePositive(v, &cfg.MaxNodes) }},
+	{name: "namespaces", env: "IOAM_COLLECTOR_NAMESPACES", usage: "Comma-separated namespace IDs of the valid traces (default all)",
+		set: func(cfg *Config, v string) error {
+			cfg.Namespaces = nil
+			for _, item := range splitList(v) {
+				ns, err := strconv.ParseUint(item, 10, 16)
+				if err != nil {
+					return fmt.Errorf("invalid namespace %q", item)
+				}
+				cfg.Namespaces = append(cfg.Namespaces, uint32(ns))
+			}
+			return nil
+		}},
+	{name: "invalid-traces", env: "IOAM_COLLECTOR_INVALID_TRACES", usage: "Handling of the invalid traces: annotate or drop (default \"annotate\")",
+		set: func(cfg *Config, v string) error {
+			switch v {
+			case InvalidAnnotate, InvalidDrop:
+				cfg.Invalid = v
+				return nil
+			}
+			return fmt.Errorf("unknown handling %q", v)
+		}},
+	{name: "store", env: "IOAM_COLLECTOR_STORE", usage: "Database file storing the received traces, disabled if empty",
+		set: func(cfg *Config, v string) error { cfg.Store = v; return nil }},
+	{name: "store-retention", env: "IOAM_COLLECTOR_STORE_RETENTION", usage: "Maximum age of the stored traces (default 24h)",
+		set: func(cfg *Config, v string) (err error) { cfg.StoreRetention, err = time.ParseDuration(v); return }},
+	{name: "store-max-traces", env: "IOAM_COLLECTOR_STORE_MAX_TRACES", usage: "Maximum number of stored traces (default 1000000)",
+		set: func(cfg *Config, v string) error { return parsePositive(v, &cfg.StoreMaxTraces) }},
+	{name: "http-listen", env: "IOAM_COLLECTOR_HTTP_LISTEN", usage: "Listen address of the HTTP API (agents, invalid traces, and the stored traces with -store), disabled if empty",
+		set: func(cfg *Config, v string) error { cfg.HTTPListen = v; return nil }},
+	{name: "inventory", env: "IOAM_COLLECTOR_INVENTORY", usage: "Inventory file (JSON) naming the nodes and interfaces, for the nodes not named by the agent",
+		set: func(cfg *Config, v string) error { cfg.Inventory = v; return nil }},
+	{name: "inventory-reload", env: "IOAM_COLLECTOR_INVENTORY_RELOAD", usage: "Interval between two checks of the inventory file for changes, 0 disables (default 10s)",
+		set: func(cfg *Config, v string) (err error) { cfg.InventoryReload, err = time.ParseDuration(v); return }},
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Listen:          []string{":7123"},
+		Protocol:        "grpc",
+		Insecure:        true,
+		ServiceName:     "CLT",
+		TracerName:      "ioam-tracer",
+		BatchSize:       512,
+		QueueSize:       2048,
+		BatchTimeout:    5 * time.Second,
+		TimestampFormat: TimestampPOSIX,
+		MetricsInterval: 30 * time.Second,
+		StoreRetention:  24 * time.Hour,
+		StoreMaxTraces:  1000000,
+		TraceID:         TraceIDAgent,
+		TraceIDBucket:   time.Minute,
+		MaxNodes:        64,
+		Invalid:         InvalidAnnotate,
+		InventoryReload: 10 * time.Second,
+	}
+}
+
+// ParseConfig reads the configuration from the defaults, the JSON file
+// given with -config (or IOAM_COLLECTOR_CONFIG), the environment and the
+// flags, each one overriding the previous ones.
+func ParseConfig() (*Config, error) {
+	configFile := flag.String("config", os.Getenv("IOAM_COLLECTOR_CONFIG"), "JSON configuration file, with the flag names as keys")
+
+	flags := make(map[string]string)
+	for _, opt := range options {
+		usage := opt.usage + " [" + opt.env + "]"
+		if opt.isBool {
+			flag.BoolFunc(opt.name, usage, func(v string) error {
+				flags[opt.name] = v
+				return nil
+			})
+		} else {
+			flag.Func(opt.name, usage, func(v string) error {
+				flags[opt.name] = v
+				return nil
+			})
+		}
+	}
+	flag.Parse()
+
+	cfg := defaultConfig()
+
+	if *configFile != "" {
+		values, err := readConfigFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, opt := range options {
+			if v, ok := values[opt.name]; ok {
+				if err := opt.set(cfg, v); err != nil {
+					return nil, fmt.Errorf("%s: %s: %v", *configFile, opt.name, err)
+				}
+				delete(values, opt.name)
+			}
+		}
+		for name := range values {
+			return nil, fmt.Errorf("%s: unknown setting %q", *configFile, name)
+		}
+	}
+
+	for _, opt := range options {
+		if v, ok := os.LookupEnv(opt.env); ok {
+			if err := opt.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("%s: %v", opt.env, err)
+			}
+		}
+		if v, ok := flags[opt.name]; ok {
+			if err := opt.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("-%s: %v", opt.name, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// ResourceAttributes returns the resource attributes of the spans of the
+// given service.
+func (cfg *Config) ResourceAttributes(service string) []attribute.KeyValue {
+	keys := make([]string, 0, len(cfg.Resource))
+	for k := range cfg.Resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]attribute.KeyValue, 0, len(keys)+1)
+	for _, k := range keys {
+		attrs = append(attrs, attribute.String(k, cfg.Resource[k]))
+	}
+	return append(attrs, semconv.ServiceNameKey.String(service))
+}
+
+// readConfigFile returns the settings of a JSON configuration file as
+// strings, as if they were given as flags. Lists are joined with commas and
+// objects are turned into key=value lists.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as written: decoded as float64, 1000000 would be
+	// formatted as 1e+06
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		switch v := v.(type) {
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			items := make([]string, len(keys))
+			for i, k := range keys {
+				items[i] = k + "=" + fmt.Sprint(v[k])
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+
+	return values, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseKeyValues(v string) (map[string]string, error) {
+	kv := make(map[string]string)
+	for _, item := range splitList(v) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", item)
+		}
+		kv[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return kv, nil
+}
+
+func parsePositive(v string, dst *int) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return fmt.Errorf("must be positive")
+	}
+	*dst = n
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.json")
+	data := `{
+		"store-max-traces": 1000000,
+		"batch-timeout": "2s",
+		"metrics": true,
+		"namespaces": [123, 65535],
+		"otlp-headers": {"b": 2.5, "a": "x"}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"store-max-traces": "1000000",
+		"batch-timeout":    "2s",
+		"metrics":          "true",
+		"namespaces":       "123,65535",
+		"otlp-headers":     "a=x,b=2.5",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("readConfigFile() = %v, want %v", values, want)
+	}
+
+	cfg := defaultConfig()
+	for _, opt := range options {
+		if v, ok := values[opt.name]; ok {
+			if err := opt.set(cfg, v); err != nil {
+				t.Fatalf("%s: %v", opt.name, err)
+			}
+		}
+	}
+	if cfg.StoreMaxTraces != 1000000 || !reflect.DeepEqual(cfg.Namespaces, []uint32{123, 65535}) {
+		t.Errorf("store-max-traces %d, namespaces %v", cfg.StoreMaxTraces, cfg.Namespaces)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"metrics": }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfigFile(path); err == nil {
+		t.Error("readConfigFile() accepted invalid JSON")
+	}
+}
@@ -1,17 +1,18 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
-// 	protoc        v3.12.3
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.33.1
 // source: ioam_api.proto
 
 package ioam_api
 
 import (
-	empty "github.com/golang/protobuf/ptypes/empty"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -23,25 +24,30 @@ const (
 
 // IOAM Trace
 type IOAMTrace struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NamespaceId   uint32                 `protobuf:"varint,1,opt,name=NamespaceId,proto3" json:"NamespaceId,omitempty"`
+	BitField      uint32                 `protobuf:"fixed32,2,opt,name=BitField,proto3" json:"BitField,omitempty"` // IOAM-Trace-Type, 24 bits (bit 0 is 1 << 23)
+	Nodes         []*IOAMNode            `protobuf:"bytes,3,rep,name=Nodes,proto3" json:"Nodes,omitempty"`
+	Flow          *Flow                  `protobuf:"bytes,4,opt,name=Flow,proto3" json:"Flow,omitempty"`
+	Summary       *Summary               `protobuf:"bytes,5,opt,name=Summary,proto3" json:"Summary,omitempty"`
+	Overflow      bool                   `protobuf:"varint,6,opt,name=Overflow,proto3" json:"Overflow,omitempty"` // O flag: a node could not add its data (RFC 9197)
+	Loopback      bool                   `protobuf:"varint,7,opt,name=Loopback,proto3" json:"Loopback,omitempty"` // L flag: loopback trace (RFC 9322)
+	Active        bool                   `protobuf:"varint,8,opt,name=Active,proto3" json:"Active,omitempty"`     // A flag: active measurement packet (RFC 9322)
+	Completeness  *Completeness          `protobuf:"bytes,9,opt,name=Completeness,proto3" json:"Completeness,omitempty"`
+	Namespace     *Namespace             `protobuf:"bytes,10,opt,name=Namespace,proto3" json:"Namespace,omitempty"`
+	Checksum      *Checksum              `protobuf:"bytes,11,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
+	TraceId_High  uint64                 `protobuf:"fixed64,12,opt,name=TraceId_High,json=TraceIdHigh,proto3" json:"TraceId_High,omitempty"` // optional, set by the sender
+	TraceId_Low   uint64                 `protobuf:"fixed64,13,opt,name=TraceId_Low,json=TraceIdLow,proto3" json:"TraceId_Low,omitempty"`
+	SpanId        uint64                 `protobuf:"fixed64,14,opt,name=SpanId,proto3" json:"SpanId,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	TraceId_High uint64      `protobuf:"fixed64,1,opt,name=TraceId_High,json=TraceIdHigh,proto3" json:"TraceId_High,omitempty"`
-	TraceId_Low  uint64      `protobuf:"fixed64,2,opt,name=TraceId_Low,json=TraceIdLow,proto3" json:"TraceId_Low,omitempty"`
-	SpanId       uint64      `protobuf:"fixed64,3,opt,name=SpanId,proto3" json:"SpanId,omitempty"`
-	NamespaceId  uint32      `protobuf:"varint,4,opt,name=NamespaceId,proto3" json:"NamespaceId,omitempty"`
-	BitField     uint32      `protobuf:"fixed32,5,opt,name=BitField,proto3" json:"BitField,omitempty"`
-	Nodes        []*IOAMNode `protobuf:"bytes,6,rep,name=Nodes,proto3" json:"Nodes,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *IOAMTrace) Reset() {
 	*x = IOAMTrace{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_ioam_api_proto_msgTypes[0]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_ioam_api_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *IOAMTrace) String() string {
@@ -52,7 +58,7 @@ func (*IOAMTrace) ProtoMessage() {}
 
 func (x *IOAMTrace) ProtoReflect() protoreflect.Message {
 	mi := &file_ioam_api_proto_msgTypes[0]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -67,6 +73,83 @@ func (*IOAMTrace) Descriptor() ([]byte, []int) {
 	return file_ioam_api_proto_rawDescGZIP(), []int{0}
 }
 
+func (x *IOAMTrace) GetNamespaceId() uint32 {
+	if x != nil {
+		return x.NamespaceId
+	}
+	return 0
+}
+
+func (x *IOAMTrace) GetBitField() uint32 {
+	if x != nil {
+		return x.BitField
+	}
+	return 0
+}
+
+func (x *IOAMTrace) GetNodes() []*IOAMNode {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *IOAMTrace) GetFlow() *Flow {
+	if x != nil {
+		return x.Flow
+	}
+	return nil
+}
+
+func (x *IOAMTrace) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *IOAMTrace) GetOverflow() bool {
+	if x != nil {
+		return x.Overflow
+	}
+	return false
+}
+
+func (x *IOAMTrace) GetLoopback() bool {
+	if x != nil {
+		return x.Loopback
+	}
+	return false
+}
+
+func (x *IOAMTrace) GetActive() bool {
+	if x != nil {
+		return x.Active
+	}
+	return false
+}
+
+func (x *IOAMTrace) GetCompleteness() *Completeness {
+	if x != nil {
+		return x.Completeness
+	}
+	return nil
+}
+
+func (x *IOAMTrace) GetNamespace() *Namespace {
+	if x != nil {
+		return x.Namespace
+	}
+	return nil
+}
+
+func (x *IOAMTrace) GetChecksum() *Checksum {
+	if x != nil {
+		return x.Checksum
+	}
+	return nil
+}
+
 func (x *IOAMTrace) GetTraceId_High() uint64 {
 	if x != nil {
 		return x.TraceId_High
@@ -88,44 +171,621 @@ func (x *IOAMTrace) GetSpanId() uint64 {
 	return 0
 }
 
-func (x *IOAMTrace) GetNamespaceId() uint32 {
+// Completeness of the path recorded in the trace, computed by the agent
+type Completeness struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Preallocated  bool                   `protobuf:"varint,1,opt,name=Preallocated,proto3" json:"Preallocated,omitempty"`
+	Allocated     uint32                 `protobuf:"varint,2,opt,name=Allocated,proto3" json:"Allocated,omitempty"`   // node slots: filled + free
+	Filled        uint32                 `protobuf:"varint,3,opt,name=Filled,proto3" json:"Filled,omitempty"`         // nodes that added their data
+	Gaps          []uint32               `protobuf:"varint,4,rep,packed,name=Gaps,proto3" json:"Gaps,omitempty"`      // hops without IOAM data before Nodes[i+1], from the hop limits
+	Missing       uint32                 `protobuf:"varint,5,opt,name=Missing,proto3" json:"Missing,omitempty"`       // sum of the gaps
+	Undersized    bool                   `protobuf:"varint,6,opt,name=Undersized,proto3" json:"Undersized,omitempty"` // overflow flag, or full with more hops than allocated
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Completeness) Reset() {
+	*x = Completeness{}
+	mi := &file_ioam_api_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Completeness) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Completeness) ProtoMessage() {}
+
+func (x *Completeness) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[1]
 	if x != nil {
-		return x.NamespaceId
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Completeness.ProtoReflect.Descriptor instead.
+func (*Completeness) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Completeness) GetPreallocated() bool {
+	if x != nil {
+		return x.Preallocated
+	}
+	return false
+}
+
+func (x *Completeness) GetAllocated() uint32 {
+	if x != nil {
+		return x.Allocated
 	}
 	return 0
 }
 
-func (x *IOAMTrace) GetBitField() uint32 {
+func (x *Completeness) GetFilled() uint32 {
 	if x != nil {
-		return x.BitField
+		return x.Filled
 	}
 	return 0
 }
 
-func (x *IOAMTrace) GetNodes() []*IOAMNode {
+func (x *Completeness) GetGaps() []uint32 {
+	if x != nil {
+		return x.Gaps
+	}
+	return nil
+}
+
+func (x *Completeness) GetMissing() uint32 {
+	if x != nil {
+		return x.Missing
+	}
+	return 0
+}
+
+func (x *Completeness) GetUndersized() bool {
+	if x != nil {
+		return x.Undersized
+	}
+	return false
+}
+
+// Namespace of the trace, as found in the registry of the agent (set only
+// if the agent has one)
+type Namespace struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Name              string                 `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Unknown           bool                   `protobuf:"varint,2,opt,name=Unknown,proto3" json:"Unknown,omitempty"`                            // not in the registry
+	UnexpectedNodes   []uint32               `protobuf:"varint,3,rep,packed,name=UnexpectedNodes,proto3" json:"UnexpectedNodes,omitempty"`     // indexes in Nodes of the node IDs not expected in the namespace
+	UnexpectedSchemas []uint32               `protobuf:"varint,4,rep,packed,name=UnexpectedSchemas,proto3" json:"UnexpectedSchemas,omitempty"` // indexes in Nodes of the OSS with another schema than expected
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Namespace) Reset() {
+	*x = Namespace{}
+	mi := &file_ioam_api_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Namespace) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Namespace) ProtoMessage() {}
+
+func (x *Namespace) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Namespace.ProtoReflect.Descriptor instead.
+func (*Namespace) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Namespace) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Namespace) GetUnknown() bool {
+	if x != nil {
+		return x.Unknown
+	}
+	return false
+}
+
+func (x *Namespace) GetUnexpectedNodes() []uint32 {
+	if x != nil {
+		return x.UnexpectedNodes
+	}
+	return nil
+}
+
+func (x *Namespace) GetUnexpectedSchemas() []uint32 {
+	if x != nil {
+		return x.UnexpectedSchemas
+	}
+	return nil
+}
+
+// Checksum Complement verification (trace type bit 7), by the agent
+type Checksum struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Verified      bool                   `protobuf:"varint,1,opt,name=Verified,proto3" json:"Verified,omitempty"`            // upper-layer (TCP/UDP) checksum of the packet checked
+	Valid         bool                   `protobuf:"varint,2,opt,name=Valid,proto3" json:"Valid,omitempty"`                  // upper-layer checksum correct, if verified
+	Mismatches    []uint32               `protobuf:"varint,3,rep,packed,name=Mismatches,proto3" json:"Mismatches,omitempty"` // indexes in Nodes whose data are not checksum-neutral despite their Checksum Complement
+	Corrupted     bool                   `protobuf:"varint,4,opt,name=Corrupted,proto3" json:"Corrupted,omitempty"`          // flagged: a node appears to have corrupted the packet
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Checksum) Reset() {
+	*x = Checksum{}
+	mi := &file_ioam_api_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Checksum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Checksum) ProtoMessage() {}
+
+func (x *Checksum) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Checksum.ProtoReflect.Descriptor instead.
+func (*Checksum) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Checksum) GetVerified() bool {
+	if x != nil {
+		return x.Verified
+	}
+	return false
+}
+
+func (x *Checksum) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+func (x *Checksum) GetMismatches() []uint32 {
+	if x != nil {
+		return x.Mismatches
+	}
+	return nil
+}
+
+func (x *Checksum) GetCorrupted() bool {
+	if x != nil {
+		return x.Corrupted
+	}
+	return false
+}
+
+// Flow of the packet carrying the IOAM data
+type Flow struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SrcAddr       []byte                 `protobuf:"bytes,1,opt,name=SrcAddr,proto3" json:"SrcAddr,omitempty"`        // 16-octet IPv6 address
+	DstAddr       []byte                 `protobuf:"bytes,2,opt,name=DstAddr,proto3" json:"DstAddr,omitempty"`        // 16-octet IPv6 address
+	NextHeader    uint32                 `protobuf:"varint,3,opt,name=NextHeader,proto3" json:"NextHeader,omitempty"` // upper-layer protocol
+	SrcPort       uint32                 `protobuf:"varint,4,opt,name=SrcPort,proto3" json:"SrcPort,omitempty"`       // TCP/UDP only
+	DstPort       uint32                 `protobuf:"varint,5,opt,name=DstPort,proto3" json:"DstPort,omitempty"`       // TCP/UDP only
+	FlowLabel     uint32                 `protobuf:"varint,6,opt,name=FlowLabel,proto3" json:"FlowLabel,omitempty"`
+	Inner         *Flow                  `protobuf:"bytes,7,opt,name=Inner,proto3" json:"Inner,omitempty"` // encapsulated packet (IPv6-in-IPv6)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Flow) Reset() {
+	*x = Flow{}
+	mi := &file_ioam_api_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Flow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Flow) ProtoMessage() {}
+
+func (x *Flow) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Flow.ProtoReflect.Descriptor instead.
+func (*Flow) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Flow) GetSrcAddr() []byte {
+	if x != nil {
+		return x.SrcAddr
+	}
+	return nil
+}
+
+func (x *Flow) GetDstAddr() []byte {
+	if x != nil {
+		return x.DstAddr
+	}
+	return nil
+}
+
+func (x *Flow) GetNextHeader() uint32 {
+	if x != nil {
+		return x.NextHeader
+	}
+	return 0
+}
+
+func (x *Flow) GetSrcPort() uint32 {
+	if x != nil {
+		return x.SrcPort
+	}
+	return 0
+}
+
+func (x *Flow) GetDstPort() uint32 {
+	if x != nil {
+		return x.DstPort
+	}
+	return 0
+}
+
+func (x *Flow) GetFlowLabel() uint32 {
+	if x != nil {
+		return x.FlowLabel
+	}
+	return 0
+}
+
+func (x *Flow) GetInner() *Flow {
+	if x != nil {
+		return x.Inner
+	}
+	return nil
+}
+
+// Summary of the traces aggregated by the agent over a window, sent along
+// with the first trace of the group
+type Summary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Packets       uint64                 `protobuf:"varint,1,opt,name=Packets,proto3" json:"Packets,omitempty"`
+	Start         uint64                 `protobuf:"fixed64,2,opt,name=Start,proto3" json:"Start,omitempty"` // start of the window (Unix time, ns)
+	End           uint64                 `protobuf:"fixed64,3,opt,name=End,proto3" json:"End,omitempty"`     // end of the window (Unix time, ns)
+	Nodes         []*NodeSummary         `protobuf:"bytes,4,rep,name=Nodes,proto3" json:"Nodes,omitempty"`   // same order as IOAMTrace.Nodes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_ioam_api_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Summary) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *Summary) GetStart() uint64 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *Summary) GetEnd() uint64 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *Summary) GetNodes() []*NodeSummary {
 	if x != nil {
 		return x.Nodes
 	}
 	return nil
 }
 
-// Opaque State Snapshot
-type Opaque struct {
-	state         protoimpl.MessageState
+type NodeSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Fields        []*FieldSummary        `protobuf:"bytes,1,rep,name=Fields,proto3" json:"Fields,omitempty"`
+	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeSummary) Reset() {
+	*x = NodeSummary{}
+	mi := &file_ioam_api_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeSummary) ProtoMessage() {}
+
+func (x *NodeSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeSummary.ProtoReflect.Descriptor instead.
+func (*NodeSummary) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *NodeSummary) GetFields() []*FieldSummary {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type FieldSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Min           int64                  `protobuf:"varint,2,opt,name=Min,proto3" json:"Min,omitempty"`
+	Max           int64                  `protobuf:"varint,3,opt,name=Max,proto3" json:"Max,omitempty"`
+	Avg           float64                `protobuf:"fixed64,4,opt,name=Avg,proto3" json:"Avg,omitempty"`
+	P50           int64                  `protobuf:"varint,5,opt,name=P50,proto3" json:"P50,omitempty"`
+	P90           int64                  `protobuf:"varint,6,opt,name=P90,proto3" json:"P90,omitempty"`
+	P99           int64                  `protobuf:"varint,7,opt,name=P99,proto3" json:"P99,omitempty"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-	SchemaId uint32 `protobuf:"varint,1,opt,name=SchemaId,proto3" json:"SchemaId,omitempty"`
-	Data     []byte `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"` // variable length field
+func (x *FieldSummary) Reset() {
+	*x = FieldSummary{}
+	mi := &file_ioam_api_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func (x *Opaque) Reset() {
-	*x = Opaque{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_ioam_api_proto_msgTypes[1]
+func (x *FieldSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldSummary) ProtoMessage() {}
+
+func (x *FieldSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldSummary.ProtoReflect.Descriptor instead.
+func (*FieldSummary) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FieldSummary) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FieldSummary) GetMin() int64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *FieldSummary) GetMax() int64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *FieldSummary) GetAvg() float64 {
+	if x != nil {
+		return x.Avg
+	}
+	return 0
+}
+
+func (x *FieldSummary) GetP50() int64 {
+	if x != nil {
+		return x.P50
+	}
+	return 0
+}
+
+func (x *FieldSummary) GetP90() int64 {
+	if x != nil {
+		return x.P90
+	}
+	return 0
+}
+
+func (x *FieldSummary) GetP99() int64 {
+	if x != nil {
+		return x.P99
+	}
+	return 0
+}
+
+// Names of a node and of its interfaces, from the inventory
+type NodeLabels struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hostname      string                 `protobuf:"bytes,1,opt,name=Hostname,proto3" json:"Hostname,omitempty"`
+	Site          string                 `protobuf:"bytes,2,opt,name=Site,proto3" json:"Site,omitempty"`
+	Role          string                 `protobuf:"bytes,3,opt,name=Role,proto3" json:"Role,omitempty"`
+	IngressName   string                 `protobuf:"bytes,4,opt,name=IngressName,proto3" json:"IngressName,omitempty"`
+	EgressName    string                 `protobuf:"bytes,5,opt,name=EgressName,proto3" json:"EgressName,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeLabels) Reset() {
+	*x = NodeLabels{}
+	mi := &file_ioam_api_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeLabels) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeLabels) ProtoMessage() {}
+
+func (x *NodeLabels) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[8]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeLabels.ProtoReflect.Descriptor instead.
+func (*NodeLabels) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *NodeLabels) GetHostname() string {
+	if x != nil {
+		return x.Hostname
 	}
+	return ""
+}
+
+func (x *NodeLabels) GetSite() string {
+	if x != nil {
+		return x.Site
+	}
+	return ""
+}
+
+func (x *NodeLabels) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *NodeLabels) GetIngressName() string {
+	if x != nil {
+		return x.IngressName
+	}
+	return ""
+}
+
+func (x *NodeLabels) GetEgressName() string {
+	if x != nil {
+		return x.EgressName
+	}
+	return ""
+}
+
+// Opaque State Snapshot
+type Opaque struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SchemaId      uint32                 `protobuf:"varint,1,opt,name=SchemaId,proto3" json:"SchemaId,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`     // variable length field
+	Fields        []*OSSField            `protobuf:"bytes,3,rep,name=Fields,proto3" json:"Fields,omitempty"` // Data decoded by the agent, if it knows the schema
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Opaque) Reset() {
+	*x = Opaque{}
+	mi := &file_ioam_api_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Opaque) String() string {
@@ -135,8 +795,8 @@ func (x *Opaque) String() string {
 func (*Opaque) ProtoMessage() {}
 
 func (x *Opaque) ProtoReflect() protoreflect.Message {
-	mi := &file_ioam_api_proto_msgTypes[1]
-	if protoimpl.UnsafeEnabled && x != nil {
+	mi := &file_ioam_api_proto_msgTypes[9]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -148,7 +808,7 @@ func (x *Opaque) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Opaque.ProtoReflect.Descriptor instead.
 func (*Opaque) Descriptor() ([]byte, []int) {
-	return file_ioam_api_proto_rawDescGZIP(), []int{1}
+	return file_ioam_api_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *Opaque) GetSchemaId() uint32 {
@@ -165,37 +825,96 @@ func (x *Opaque) GetData() []byte {
 	return nil
 }
 
-// IOAM Node Data
-type IOAMNode struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+func (x *Opaque) GetFields() []*OSSField {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type OSSField struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=Value,proto3" json:"Value,omitempty"` // integers in decimal, bytes in hexadecimal
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-	HopLimit          uint32  `protobuf:"varint,1,opt,name=HopLimit,proto3" json:"HopLimit,omitempty"`
-	Id                uint32  `protobuf:"varint,2,opt,name=Id,proto3" json:"Id,omitempty"`
-	IngressId         uint32  `protobuf:"varint,3,opt,name=IngressId,proto3" json:"IngressId,omitempty"`
-	EgressId          uint32  `protobuf:"varint,4,opt,name=EgressId,proto3" json:"EgressId,omitempty"`
-	TimestampSecs     uint32  `protobuf:"varint,5,opt,name=TimestampSecs,proto3" json:"TimestampSecs,omitempty"`
-	TimestampFrac     uint32  `protobuf:"varint,6,opt,name=TimestampFrac,proto3" json:"TimestampFrac,omitempty"`
-	TransitDelay      uint32  `protobuf:"varint,7,opt,name=TransitDelay,proto3" json:"TransitDelay,omitempty"`
-	QueueDepth        uint32  `protobuf:"varint,8,opt,name=QueueDepth,proto3" json:"QueueDepth,omitempty"`
-	CsumComp          uint32  `protobuf:"varint,9,opt,name=CsumComp,proto3" json:"CsumComp,omitempty"`
-	BufferOccupancy   uint32  `protobuf:"varint,10,opt,name=BufferOccupancy,proto3" json:"BufferOccupancy,omitempty"`
-	IngressIdWide     uint32  `protobuf:"varint,11,opt,name=IngressIdWide,proto3" json:"IngressIdWide,omitempty"`
-	EgressIdWide      uint32  `protobuf:"varint,12,opt,name=EgressIdWide,proto3" json:"EgressIdWide,omitempty"`
-	IdWide            uint64  `protobuf:"varint,13,opt,name=IdWide,proto3" json:"IdWide,omitempty"`
-	NamespaceData     []byte  `protobuf:"bytes,14,opt,name=NamespaceData,proto3" json:"NamespaceData,omitempty"`         // 4-octet field
-	NamespaceDataWide []byte  `protobuf:"bytes,15,opt,name=NamespaceDataWide,proto3" json:"NamespaceDataWide,omitempty"` // 8-octet field
-	OSS               *Opaque `protobuf:"bytes,16,opt,name=OSS,proto3" json:"OSS,omitempty"`
+func (x *OSSField) Reset() {
+	*x = OSSField{}
+	mi := &file_ioam_api_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func (x *IOAMNode) Reset() {
-	*x = IOAMNode{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_ioam_api_proto_msgTypes[2]
+func (x *OSSField) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OSSField) ProtoMessage() {}
+
+func (x *OSSField) ProtoReflect() protoreflect.Message {
+	mi := &file_ioam_api_proto_msgTypes[10]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OSSField.ProtoReflect.Descriptor instead.
+func (*OSSField) Descriptor() ([]byte, []int) {
+	return file_ioam_api_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *OSSField) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *OSSField) GetValue() string {
+	if x != nil {
+		return x.Value
 	}
+	return ""
+}
+
+// IOAM Node Data
+type IOAMNode struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	HopLimit              uint32                 `protobuf:"varint,1,opt,name=HopLimit,proto3" json:"HopLimit,omitempty"`
+	Id                    uint32                 `protobuf:"varint,2,opt,name=Id,proto3" json:"Id,omitempty"`
+	IngressId             uint32                 `protobuf:"varint,3,opt,name=IngressId,proto3" json:"IngressId,omitempty"`
+	EgressId              uint32                 `protobuf:"varint,4,opt,name=EgressId,proto3" json:"EgressId,omitempty"`
+	TimestampSecs         uint32                 `protobuf:"varint,5,opt,name=TimestampSecs,proto3" json:"TimestampSecs,omitempty"`
+	TimestampFrac         uint32                 `protobuf:"varint,6,opt,name=TimestampFrac,proto3" json:"TimestampFrac,omitempty"`
+	TransitDelay          uint32                 `protobuf:"varint,7,opt,name=TransitDelay,proto3" json:"TransitDelay,omitempty"`
+	QueueDepth            uint32                 `protobuf:"varint,8,opt,name=QueueDepth,proto3" json:"QueueDepth,omitempty"`
+	CsumComp              uint32                 `protobuf:"varint,9,opt,name=CsumComp,proto3" json:"CsumComp,omitempty"`
+	BufferOccupancy       uint32                 `protobuf:"varint,10,opt,name=BufferOccupancy,proto3" json:"BufferOccupancy,omitempty"`
+	IngressIdWide         uint32                 `protobuf:"varint,11,opt,name=IngressIdWide,proto3" json:"IngressIdWide,omitempty"`
+	EgressIdWide          uint32                 `protobuf:"varint,12,opt,name=EgressIdWide,proto3" json:"EgressIdWide,omitempty"`
+	IdWide                uint64                 `protobuf:"varint,13,opt,name=IdWide,proto3" json:"IdWide,omitempty"`
+	NamespaceData         []byte                 `protobuf:"bytes,14,opt,name=NamespaceData,proto3" json:"NamespaceData,omitempty"`         // 4-octet field
+	NamespaceDataWide     []byte                 `protobuf:"bytes,15,opt,name=NamespaceDataWide,proto3" json:"NamespaceDataWide,omitempty"` // 8-octet field
+	OSS                   *Opaque                `protobuf:"bytes,16,opt,name=OSS,proto3" json:"OSS,omitempty"`
+	NamespaceDataText     string                 `protobuf:"bytes,17,opt,name=NamespaceDataText,proto3" json:"NamespaceDataText,omitempty"`         // NamespaceData decoded as set in the registry of the agent
+	NamespaceDataWideText string                 `protobuf:"bytes,18,opt,name=NamespaceDataWideText,proto3" json:"NamespaceDataWideText,omitempty"` // NamespaceDataWide decoded as set in the registry of the agent
+	Labels                *NodeLabels            `protobuf:"bytes,19,opt,name=Labels,proto3" json:"Labels,omitempty"`                               // from the inventory
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *IOAMNode) Reset() {
+	*x = IOAMNode{}
+	mi := &file_ioam_api_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *IOAMNode) String() string {
@@ -205,8 +924,8 @@ func (x *IOAMNode) String() string {
 func (*IOAMNode) ProtoMessage() {}
 
 func (x *IOAMNode) ProtoReflect() protoreflect.Message {
-	mi := &file_ioam_api_proto_msgTypes[2]
-	if protoimpl.UnsafeEnabled && x != nil {
+	mi := &file_ioam_api_proto_msgTypes[11]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -218,7 +937,7 @@ func (x *IOAMNode) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IOAMNode.ProtoReflect.Descriptor instead.
 func (*IOAMNode) Descriptor() ([]byte, []int) {
-	return file_ioam_api_proto_rawDescGZIP(), []int{2}
+	return file_ioam_api_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *IOAMNode) GetHopLimit() uint32 {
@@ -333,103 +1052,185 @@ func (x *IOAMNode) GetOSS() *Opaque {
 	return nil
 }
 
-var File_ioam_api_proto protoreflect.FileDescriptor
+func (x *IOAMNode) GetNamespaceDataText() string {
+	if x != nil {
+		return x.NamespaceDataText
+	}
+	return ""
+}
+
+func (x *IOAMNode) GetNamespaceDataWideText() string {
+	if x != nil {
+		return x.NamespaceDataWideText
+	}
+	return ""
+}
 
-var file_ioam_api_proto_rawDesc = []byte{
-	0x0a, 0x0e, 0x69, 0x6f, 0x61, 0x6d, 0x5f, 0x61, 0x70, 0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x12, 0x08, 0x69, 0x6f, 0x61, 0x6d, 0x5f, 0x61, 0x70, 0x69, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67,
-	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74,
-	0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xcf, 0x01, 0x0a, 0x09, 0x49, 0x4f, 0x41, 0x4d,
-	0x54, 0x72, 0x61, 0x63, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x64,
-	0x5f, 0x48, 0x69, 0x67, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x06, 0x52, 0x0b, 0x54, 0x72, 0x61,
-	0x63, 0x65, 0x49, 0x64, 0x48, 0x69, 0x67, 0x68, 0x12, 0x1f, 0x0a, 0x0b, 0x54, 0x72, 0x61, 0x63,
-	0x65, 0x49, 0x64, 0x5f, 0x4c, 0x6f, 0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x06, 0x52, 0x0a, 0x54,
-	0x72, 0x61, 0x63, 0x65, 0x49, 0x64, 0x4c, 0x6f, 0x77, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x70, 0x61,
-	0x6e, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x06, 0x52, 0x06, 0x53, 0x70, 0x61, 0x6e, 0x49,
-	0x64, 0x12, 0x20, 0x0a, 0x0b, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x49, 0x64,
-	0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63,
-	0x65, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x69, 0x74, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x18,
-	0x05, 0x20, 0x01, 0x28, 0x07, 0x52, 0x08, 0x42, 0x69, 0x74, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12,
-	0x28, 0x0a, 0x05, 0x4e, 0x6f, 0x64, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12,
-	0x2e, 0x69, 0x6f, 0x61, 0x6d, 0x5f, 0x61, 0x70, 0x69, 0x2e, 0x49, 0x4f, 0x41, 0x4d, 0x4e, 0x6f,
-	0x64, 0x65, 0x52, 0x05, 0x4e, 0x6f, 0x64, 0x65, 0x73, 0x22, 0x38, 0x0a, 0x06, 0x4f, 0x70, 0x61,
-	0x71, 0x75, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x49, 0x64, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x49, 0x64, 0x12,
-	0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44,
-	0x61, 0x74, 0x61, 0x22, 0xa0, 0x04, 0x0a, 0x08, 0x49, 0x4f, 0x41, 0x4d, 0x4e, 0x6f, 0x64, 0x65,
-	0x12, 0x1a, 0x0a, 0x08, 0x48, 0x6f, 0x70, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x0d, 0x52, 0x08, 0x48, 0x6f, 0x70, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x0e, 0x0a, 0x02,
-	0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09,
-	0x49, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52,
-	0x09, 0x49, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x45, 0x67,
-	0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x45, 0x67,
-	0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x12, 0x24, 0x0a, 0x0d, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
-	0x61, 0x6d, 0x70, 0x53, 0x65, 0x63, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x54,
-	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x53, 0x65, 0x63, 0x73, 0x12, 0x24, 0x0a, 0x0d,
-	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x46, 0x72, 0x61, 0x63, 0x18, 0x06, 0x20,
-	0x01, 0x28, 0x0d, 0x52, 0x0d, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x46, 0x72,
-	0x61, 0x63, 0x12, 0x22, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x44, 0x65, 0x6c,
-	0x61, 0x79, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x69,
-	0x74, 0x44, 0x65, 0x6c, 0x61, 0x79, 0x12, 0x1e, 0x0a, 0x0a, 0x51, 0x75, 0x65, 0x75, 0x65, 0x44,
-	0x65, 0x70, 0x74, 0x68, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x51, 0x75, 0x65, 0x75,
-	0x65, 0x44, 0x65, 0x70, 0x74, 0x68, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x73, 0x75, 0x6d, 0x43, 0x6f,
-	0x6d, 0x70, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x43, 0x73, 0x75, 0x6d, 0x43, 0x6f,
-	0x6d, 0x70, 0x12, 0x28, 0x0a, 0x0f, 0x42, 0x75, 0x66, 0x66, 0x65, 0x72, 0x4f, 0x63, 0x63, 0x75,
-	0x70, 0x61, 0x6e, 0x63, 0x79, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x42, 0x75, 0x66,
-	0x66, 0x65, 0x72, 0x4f, 0x63, 0x63, 0x75, 0x70, 0x61, 0x6e, 0x63, 0x79, 0x12, 0x24, 0x0a, 0x0d,
-	0x49, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x57, 0x69, 0x64, 0x65, 0x18, 0x0b, 0x20,
-	0x01, 0x28, 0x0d, 0x52, 0x0d, 0x49, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x57, 0x69,
-	0x64, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x45, 0x67, 0x72, 0x65, 0x73, 0x73, 0x49, 0x64, 0x57, 0x69,
-	0x64, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x45, 0x67, 0x72, 0x65, 0x73, 0x73,
-	0x49, 0x64, 0x57, 0x69, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x49, 0x64, 0x57, 0x69, 0x64, 0x65,
-	0x18, 0x0d, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x49, 0x64, 0x57, 0x69, 0x64, 0x65, 0x12, 0x24,
-	0x0a, 0x0d, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x44, 0x61, 0x74, 0x61, 0x18,
-	0x0e, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0d, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65,
-	0x44, 0x61, 0x74, 0x61, 0x12, 0x2c, 0x0a, 0x11, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63,
-	0x65, 0x44, 0x61, 0x74, 0x61, 0x57, 0x69, 0x64, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0c, 0x52,
-	0x11, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x44, 0x61, 0x74, 0x61, 0x57, 0x69,
-	0x64, 0x65, 0x12, 0x22, 0x0a, 0x03, 0x4f, 0x53, 0x53, 0x18, 0x10, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x10, 0x2e, 0x69, 0x6f, 0x61, 0x6d, 0x5f, 0x61, 0x70, 0x69, 0x2e, 0x4f, 0x70, 0x61, 0x71, 0x75,
-	0x65, 0x52, 0x03, 0x4f, 0x53, 0x53, 0x32, 0x48, 0x0a, 0x0b, 0x49, 0x4f, 0x41, 0x4d, 0x53, 0x65,
-	0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x39, 0x0a, 0x06, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12,
-	0x13, 0x2e, 0x69, 0x6f, 0x61, 0x6d, 0x5f, 0x61, 0x70, 0x69, 0x2e, 0x49, 0x4f, 0x41, 0x4d, 0x54,
-	0x72, 0x61, 0x63, 0x65, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x28, 0x01,
-	0x42, 0x2c, 0x5a, 0x2a, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x41,
-	0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x2d, 0x4f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x61, 0x62,
-	0x69, 0x6c, 0x69, 0x74, 0x79, 0x2f, 0x69, 0x6f, 0x61, 0x6d, 0x2d, 0x61, 0x70, 0x69, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *IOAMNode) GetLabels() *NodeLabels {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
 }
 
+var File_ioam_api_proto protoreflect.FileDescriptor
+
+const file_ioam_api_proto_rawDesc = "" +
+	"\n" +
+	"\x0eioam_api.proto\x12\bioam_api\x1a\x1bgoogle/protobuf/empty.proto\"\x8f\x04\n" +
+	"\tIOAMTrace\x12 \n" +
+	"\vNamespaceId\x18\x01 \x01(\rR\vNamespaceId\x12\x1a\n" +
+	"\bBitField\x18\x02 \x01(\aR\bBitField\x12(\n" +
+	"\x05Nodes\x18\x03 \x03(\v2\x12.ioam_api.IOAMNodeR\x05Nodes\x12\"\n" +
+	"\x04Flow\x18\x04 \x01(\v2\x0e.ioam_api.FlowR\x04Flow\x12+\n" +
+	"\aSummary\x18\x05 \x01(\v2\x11.ioam_api.SummaryR\aSummary\x12\x1a\n" +
+	"\bOverflow\x18\x06 \x01(\bR\bOverflow\x12\x1a\n" +
+	"\bLoopback\x18\a \x01(\bR\bLoopback\x12\x16\n" +
+	"\x06Active\x18\b \x01(\bR\x06Active\x12:\n" +
+	"\fCompleteness\x18\t \x01(\v2\x16.ioam_api.CompletenessR\fCompleteness\x121\n" +
+	"\tNamespace\x18\n" +
+	" \x01(\v2\x13.ioam_api.NamespaceR\tNamespace\x12.\n" +
+	"\bChecksum\x18\v \x01(\v2\x12.ioam_api.ChecksumR\bChecksum\x12!\n" +
+	"\fTraceId_High\x18\f \x01(\x06R\vTraceIdHigh\x12\x1f\n" +
+	"\vTraceId_Low\x18\r \x01(\x06R\n" +
+	"TraceIdLow\x12\x16\n" +
+	"\x06SpanId\x18\x0e \x01(\x06R\x06SpanId\"\xb6\x01\n" +
+	"\fCompleteness\x12\"\n" +
+	"\fPreallocated\x18\x01 \x01(\bR\fPreallocated\x12\x1c\n" +
+	"\tAllocated\x18\x02 \x01(\rR\tAllocated\x12\x16\n" +
+	"\x06Filled\x18\x03 \x01(\rR\x06Filled\x12\x12\n" +
+	"\x04Gaps\x18\x04 \x03(\rR\x04Gaps\x12\x18\n" +
+	"\aMissing\x18\x05 \x01(\rR\aMissing\x12\x1e\n" +
+	"\n" +
+	"Undersized\x18\x06 \x01(\bR\n" +
+	"Undersized\"\x91\x01\n" +
+	"\tNamespace\x12\x12\n" +
+	"\x04Name\x18\x01 \x01(\tR\x04Name\x12\x18\n" +
+	"\aUnknown\x18\x02 \x01(\bR\aUnknown\x12(\n" +
+	"\x0fUnexpectedNodes\x18\x03 \x03(\rR\x0fUnexpectedNodes\x12,\n" +
+	"\x11UnexpectedSchemas\x18\x04 \x03(\rR\x11UnexpectedSchemas\"z\n" +
+	"\bChecksum\x12\x1a\n" +
+	"\bVerified\x18\x01 \x01(\bR\bVerified\x12\x14\n" +
+	"\x05Valid\x18\x02 \x01(\bR\x05Valid\x12\x1e\n" +
+	"\n" +
+	"Mismatches\x18\x03 \x03(\rR\n" +
+	"Mismatches\x12\x1c\n" +
+	"\tCorrupted\x18\x04 \x01(\bR\tCorrupted\"\xd2\x01\n" +
+	"\x04Flow\x12\x18\n" +
+	"\aSrcAddr\x18\x01 \x01(\fR\aSrcAddr\x12\x18\n" +
+	"\aDstAddr\x18\x02 \x01(\fR\aDstAddr\x12\x1e\n" +
+	"\n" +
+	"NextHeader\x18\x03 \x01(\rR\n" +
+	"NextHeader\x12\x18\n" +
+	"\aSrcPort\x18\x04 \x01(\rR\aSrcPort\x12\x18\n" +
+	"\aDstPort\x18\x05 \x01(\rR\aDstPort\x12\x1c\n" +
+	"\tFlowLabel\x18\x06 \x01(\rR\tFlowLabel\x12$\n" +
+	"\x05Inner\x18\a \x01(\v2\x0e.ioam_api.FlowR\x05Inner\"x\n" +
+	"\aSummary\x12\x18\n" +
+	"\aPackets\x18\x01 \x01(\x04R\aPackets\x12\x14\n" +
+	"\x05Start\x18\x02 \x01(\x06R\x05Start\x12\x10\n" +
+	"\x03End\x18\x03 \x01(\x06R\x03End\x12+\n" +
+	"\x05Nodes\x18\x04 \x03(\v2\x15.ioam_api.NodeSummaryR\x05Nodes\"=\n" +
+	"\vNodeSummary\x12.\n" +
+	"\x06Fields\x18\x01 \x03(\v2\x16.ioam_api.FieldSummaryR\x06Fields\"\x8e\x01\n" +
+	"\fFieldSummary\x12\x12\n" +
+	"\x04Name\x18\x01 \x01(\tR\x04Name\x12\x10\n" +
+	"\x03Min\x18\x02 \x01(\x03R\x03Min\x12\x10\n" +
+	"\x03Max\x18\x03 \x01(\x03R\x03Max\x12\x10\n" +
+	"\x03Avg\x18\x04 \x01(\x01R\x03Avg\x12\x10\n" +
+	"\x03P50\x18\x05 \x01(\x03R\x03P50\x12\x10\n" +
+	"\x03P90\x18\x06 \x01(\x03R\x03P90\x12\x10\n" +
+	"\x03P99\x18\a \x01(\x03R\x03P99\"\x92\x01\n" +
+	"\n" +
+	"NodeLabels\x12\x1a\n" +
+	"\bHostname\x18\x01 \x01(\tR\bHostname\x12\x12\n" +
+	"\x04Site\x18\x02 \x01(\tR\x04Site\x12\x12\n" +
+	"\x04Role\x18\x03 \x01(\tR\x04Role\x12 \n" +
+	"\vIngressName\x18\x04 \x01(\tR\vIngressName\x12\x1e\n" +
+	"\n" +
+	"EgressName\x18\x05 \x01(\tR\n" +
+	"EgressName\"d\n" +
+	"\x06Opaque\x12\x1a\n" +
+	"\bSchemaId\x18\x01 \x01(\rR\bSchemaId\x12\x12\n" +
+	"\x04Data\x18\x02 \x01(\fR\x04Data\x12*\n" +
+	"\x06Fields\x18\x03 \x03(\v2\x12.ioam_api.OSSFieldR\x06Fields\"4\n" +
+	"\bOSSField\x12\x12\n" +
+	"\x04Name\x18\x01 \x01(\tR\x04Name\x12\x14\n" +
+	"\x05Value\x18\x02 \x01(\tR\x05Value\"\xb2\x05\n" +
+	"\bIOAMNode\x12\x1a\n" +
+	"\bHopLimit\x18\x01 \x01(\rR\bHopLimit\x12\x0e\n" +
+	"\x02Id\x18\x02 \x01(\rR\x02Id\x12\x1c\n" +
+	"\tIngressId\x18\x03 \x01(\rR\tIngressId\x12\x1a\n" +
+	"\bEgressId\x18\x04 \x01(\rR\bEgressId\x12$\n" +
+	"\rTimestampSecs\x18\x05 \x01(\rR\rTimestampSecs\x12$\n" +
+	"\rTimestampFrac\x18\x06 \x01(\rR\rTimestampFrac\x12\"\n" +
+	"\fTransitDelay\x18\a \x01(\rR\fTransitDelay\x12\x1e\n" +
+	"\n" +
+	"QueueDepth\x18\b \x01(\rR\n" +
+	"QueueDepth\x12\x1a\n" +
+	"\bCsumComp\x18\t \x01(\rR\bCsumComp\x12(\n" +
+	"\x0fBufferOccupancy\x18\n" +
+	" \x01(\rR\x0fBufferOccupancy\x12$\n" +
+	"\rIngressIdWide\x18\v \x01(\rR\rIngressIdWide\x12\"\n" +
+	"\fEgressIdWide\x18\f \x01(\rR\fEgressIdWide\x12\x16\n" +
+	"\x06IdWide\x18\r \x01(\x04R\x06IdWide\x12$\n" +
+	"\rNamespaceData\x18\x0e \x01(\fR\rNamespaceData\x12,\n" +
+	"\x11NamespaceDataWide\x18\x0f \x01(\fR\x11NamespaceDataWide\x12\"\n" +
+	"\x03OSS\x18\x10 \x01(\v2\x10.ioam_api.OpaqueR\x03OSS\x12,\n" +
+	"\x11NamespaceDataText\x18\x11 \x01(\tR\x11NamespaceDataText\x124\n" +
+	"\x15NamespaceDataWideText\x18\x12 \x01(\tR\x15NamespaceDataWideText\x12,\n" +
+	"\x06Labels\x18\x13 \x01(\v2\x14.ioam_api.NodeLabelsR\x06Labels2H\n" +
+	"\vIOAMService\x129\n" +
+	"\x06Report\x12\x13.ioam_api.IOAMTrace\x1a\x16.google.protobuf.Empty\"\x00(\x01B,Z*github.com/Advanced-Observability/ioam-apib\x06proto3"
+
 var (
 	file_ioam_api_proto_rawDescOnce sync.Once
-	file_ioam_api_proto_rawDescData = file_ioam_api_proto_rawDesc
+	file_ioam_api_proto_rawDescData []byte
 )
 
 func file_ioam_api_proto_rawDescGZIP() []byte {
 	file_ioam_api_proto_rawDescOnce.Do(func() {
-		file_ioam_api_proto_rawDescData = protoimpl.X.CompressGZIP(file_ioam_api_proto_rawDescData)
+		file_ioam_api_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ioam_api_proto_rawDesc), len(file_ioam_api_proto_rawDesc)))
 	})
 	return file_ioam_api_proto_rawDescData
 }
 
-var file_ioam_api_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
-var file_ioam_api_proto_goTypes = []interface{}{
-	(*IOAMTrace)(nil),   // 0: ioam_api.IOAMTrace
-	(*Opaque)(nil),      // 1: ioam_api.Opaque
-	(*IOAMNode)(nil),    // 2: ioam_api.IOAMNode
-	(*empty.Empty)(nil), // 3: google.protobuf.Empty
+var file_ioam_api_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_ioam_api_proto_goTypes = []any{
+	(*IOAMTrace)(nil),     // 0: ioam_api.IOAMTrace
+	(*Completeness)(nil),  // 1: ioam_api.Completeness
+	(*Namespace)(nil),     // 2: ioam_api.Namespace
+	(*Checksum)(nil),      // 3: ioam_api.Checksum
+	(*Flow)(nil),          // 4: ioam_api.Flow
+	(*Summary)(nil),       // 5: ioam_api.Summary
+	(*NodeSummary)(nil),   // 6: ioam_api.NodeSummary
+	(*FieldSummary)(nil),  // 7: ioam_api.FieldSummary
+	(*NodeLabels)(nil),    // 8: ioam_api.NodeLabels
+	(*Opaque)(nil),        // 9: ioam_api.Opaque
+	(*OSSField)(nil),      // 10: ioam_api.OSSField
+	(*IOAMNode)(nil),      // 11: ioam_api.IOAMNode
+	(*emptypb.Empty)(nil), // 12: google.protobuf.Empty
 }
 var file_ioam_api_proto_depIdxs = []int32{
-	2, // 0: ioam_api.IOAMTrace.Nodes:type_name -> ioam_api.IOAMNode
-	1, // 1: ioam_api.IOAMNode.OSS:type_name -> ioam_api.Opaque
-	0, // 2: ioam_api.IOAMService.Report:input_type -> ioam_api.IOAMTrace
-	3, // 3: ioam_api.IOAMService.Report:output_type -> google.protobuf.Empty
-	3, // [3:4] is the sub-list for method output_type
-	2, // [2:3] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	11, // 0: ioam_api.IOAMTrace.Nodes:type_name -> ioam_api.IOAMNode
+	4,  // 1: ioam_api.IOAMTrace.Flow:type_name -> ioam_api.Flow
+	5,  // 2: ioam_api.IOAMTrace.Summary:type_name -> ioam_api.Summary
+	1,  // 3: ioam_api.IOAMTrace.Completeness:type_name -> ioam_api.Completeness
+	2,  // 4: ioam_api.IOAMTrace.Namespace:type_name -> ioam_api.Namespace
+	3,  // 5: ioam_api.IOAMTrace.Checksum:type_name -> ioam_api.Checksum
+	4,  // 6: ioam_api.Flow.Inner:type_name -> ioam_api.Flow
+	6,  // 7: ioam_api.Summary.Nodes:type_name -> ioam_api.NodeSummary
+	7,  // 8: ioam_api.NodeSummary.Fields:type_name -> ioam_api.FieldSummary
+	10, // 9: ioam_api.Opaque.Fields:type_name -> ioam_api.OSSField
+	9,  // 10: ioam_api.IOAMNode.OSS:type_name -> ioam_api.Opaque
+	8,  // 11: ioam_api.IOAMNode.Labels:type_name -> ioam_api.NodeLabels
+	0,  // 12: ioam_api.IOAMService.Report:input_type -> ioam_api.IOAMTrace
+	12, // 13: ioam_api.IOAMService.Report:output_type -> google.protobuf.Empty
+	13, // [13:14] is the sub-list for method output_type
+	12, // [12:13] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_ioam_api_proto_init() }
@@ -437,51 +1238,13 @@ func file_ioam_api_proto_init() {
 	if File_ioam_api_proto != nil {
 		return
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_ioam_api_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*IOAMTrace); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_ioam_api_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Opaque); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_ioam_api_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*IOAMNode); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_ioam_api_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ioam_api_proto_rawDesc), len(file_ioam_api_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -490,7 +1253,6 @@ func file_ioam_api_proto_init() {
 		MessageInfos:      file_ioam_api_proto_msgTypes,
 	}.Build()
 	File_ioam_api_proto = out.File
-	file_ioam_api_proto_rawDesc = nil
 	file_ioam_api_proto_goTypes = nil
 	file_ioam_api_proto_depIdxs = nil
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// maxNodeTracers is the maximum number of tracer providers kept, one per
+// service name.
+const maxNodeTracers = 1024
+
+type Server struct {
+	ioamAPI.UnimplementedIOAMServiceServer
+
+	cfg       *Config
+	processor tracesdk.SpanProcessor
+	metrics   *Metrics // nil if metrics are disabled
+	store     *Store   // nil if the store is disabled
+	agents    *Agents
+	validator *Validator
+	inventory *inventory.Watcher // nil if the collector has no inventory
+
+	mu    sync.Mutex
+	nodes map[string]*tracesdk.TracerProvider // One per service name, up to maxNodeTracers
+}
+
+func NewServer(cfg *Config, processor tracesdk.SpanProcessor, metrics *Metrics, store *Store, inv *inventory.Watcher) *Server {
+	return &Server{
+		cfg:       cfg,
+		processor: processor,
+		metrics:   metrics,
+		store:     store,
+		agents:    NewAgents(),
+		validator: NewValidator(cfg),
+		inventory: inv,
+		nodes:     make(map[string]*tracesdk.TracerProvider),
+	}
+}
+
+// nodeTracer returns the tracer of an IOAM node, whose spans appear under
+// the given service name. Once maxNodeTracers providers are kept, the one of
+// another service is dropped: it is not shut down, which would shut down
+// the shared span processor, and is created again if needed.
+func (s *Server) nodeTracer(service string) trace.Tracer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tp, ok := s.nodes[service]
+	if !ok {
+		if len(s.nodes) >= maxNodeTracers {
+			for name := range s.nodes {
+				delete(s.nodes, name)
+				break
+			}
+		}
+		tp = tracesdk.NewTracerProvider(
+			tracesdk.WithSpanProcessor(s.processor),
+			tracesdk.WithResource(resource.NewWithAttributes(
+				semconv.SchemaURL,
+				s.cfg.ResourceAttributes(service)...,
+			)),
+		)
+		s.nodes[service] = tp
+	}
+	return tp.Tracer(s.cfg.TracerName)
+}
+
+// NodeName is the service name of an IOAM node: its hostname from the
+// inventory, or its ID.
+func NodeName(node *ioamAPI.IOAMNode, id uint64) string {
+	if hostname := node.GetLabels().GetHostname(); hostname != "" {
+		return hostname
+	}
+	return "ioam-node-" + strconv.FormatUint(id, 10)
+}
+
+// HopName is the name of the span of hop i (from 0): the hop number, and
+// the hostname and interfaces of the node from the inventory.
+func HopName(node *ioamAPI.IOAMNode, i int) string {
+	name := "hop " + strconv.Itoa(i+1)
+	labels := node.GetLabels()
+	if labels.GetHostname() != "" {
+		name += " " + labels.GetHostname()
+	}
+	if labels.GetIngressName() != "" || labels.GetEgressName() != "" {
+		name += " (" + labels.GetIngressName() + " -> " + labels.GetEgressName() + ")"
+	}
+	return name
+}
+
+// label sets the labels of the nodes of the trace that the agent did not
+// name, from the inventory of the collector.
+func (s *Server) label(request *ioamAPI.IOAMTrace) {
+	if s.inventory == nil {
+		return
+	}
+	inv := s.inventory.Inventory()
+	fields := ioam.TraceType(request.GetBitField())
+	for _, node := range request.GetNodes() {
+		if node.GetLabels() != nil {
+			continue
+		}
+		n := inv.Node(request.GetNamespaceId(), NodeID(node, fields))
+		if n == nil {
+			continue
+		}
+		ingress, egress := node.GetIngressId(), node.GetEgressId()
+		if fields&ioam.TraceTypeInterfaceIDs == 0 && fields&ioam.TraceTypeInterfaceIDsWide != 0 {
+			ingress, egress = node.GetIngressIdWide(), node.GetEgressIdWide()
+		}
+		node.Labels = &ioamAPI.NodeLabels{
+			Hostname:    n.Hostname,
+			Site:        n.Site,
+			Role:        n.Role,
+			IngressName: n.Interface(ingress),
+			EgressName:  n.Interface(egress),
+		}
+	}
+}
+
+// NodeID returns the short node ID, or the wide one if the trace type only
+// includes the latter.
+func NodeID(node *ioamAPI.IOAMNode, fields ioam.TraceType) uint64 {
+	if fields&ioam.TraceTypeHopLimitNodeID == 0 && fields&ioam.TraceTypeHopLimitNodeIDWide != 0 {
+		return node.GetIdWide()
+	}
+	return uint64(node.GetId())
+}
+
+// ntpEpochOffset is the number of seconds between 1900 and 1970.
+const ntpEpochOffset = 2208988800
+
+// NodeTime converts the timestamp of a node to a time, given the timestamp
+// format in use.
+func NodeTime(node *ioamAPI.IOAMNode, format string) time.Time {
+	secs := int64(node.GetTimestampSecs())
+	frac := int64(node.GetTimestampFrac())
+
+	switch format {
+	case TimestampPTP:
+		return time.Unix(secs, frac)
+	case TimestampNTP:
+		return time.Unix(secs-ntpEpochOffset, (frac*int64(time.Second))>>32)
+	default:
+		return time.Unix(secs, frac*int64(time.Microsecond))
+	}
+}
+
+// hopTimes returns the start of the trace and the end of every hop. A hop
+// starts at the timestamp of its node and lasts for the transit delay, or
+// until the next node if there is no transit delay. Without timestamps,
+// every hop starts and ends when the trace is received.
+func (s *Server) hopTimes(request *ioamAPI.IOAMTrace) (time.Time, []time.Time) {
+	now := time.Now()
+	nodes := request.GetNodes()
+	fields := ioam.TraceType(request.GetBitField())
+	ends := make([]time.Time, len(nodes))
+
+	if fields&ioam.TraceTypeTimestampSecs == 0 || fields&ioam.TraceTypeTimestampFrac == 0 || len(nodes) == 0 {
+		for i := range ends {
+			ends[i] = now
+		}
+		return now, ends
+	}
+
+	for i, node := range nodes {
+		start := NodeTime(node, s.cfg.TimestampFormat)
+		switch {
+		case fields&ioam.TraceTypeTransitDelay != 0:
+			// The most significant bit is the overflow flag
+			ends[i] = start.Add(time.Duration(node.GetTransitDelay() & 0x7FFFFFFF))
+		case i+1 < len(nodes):
+			ends[i] = NodeTime(nodes[i+1], s.cfg.TimestampFormat)
+		default:
+			ends[i] = start
+		}
+	}
+
+	return NodeTime(nodes[0], s.cfg.TimestampFormat), ends
+}
+
+// hopSpans creates one child span per node under the trace span in ctx, and
+// returns the end of the last one.
+func (s *Server) hopSpans(ctx context.Context, request *ioamAPI.IOAMTrace, ends []time.Time) time.Time {
+	fields := ioam.TraceType(request.GetBitField())
+	var end time.Time
+
+	for i, node := range request.GetNodes() {
+		start := ends[i]
+		if fields&ioam.TraceTypeTimestampSecs != 0 && fields&ioam.TraceTypeTimestampFrac != 0 {
+			start = NodeTime(node, s.cfg.TimestampFormat)
+		}
+
+		id := NodeID(node, fields)
+		_, span := s.nodeTracer(NodeName(node, id)).Start(ctx, HopName(node, i), trace.WithTimestamp(start))
+		span.SetAttributes(
+			AttrNamespaceID.Int64(int64(request.GetNamespaceId())),
+			AttrHop.Int(i+1),
+		)
+		span.SetAttributes(NodeAttributes(node, fields)...)
+		span.SetAttributes(NodeNamespaceAttributes(request, i)...)
+		span.SetAttributes(NodeLabelAttributes(node)...)
+		if slices.Contains(request.GetChecksum().GetMismatches(), uint32(i)) {
+			span.SetAttributes(AttrChecksumMismatch.Bool(true))
+		}
+		if summary := request.GetSummary(); summary != nil && i < len(summary.GetNodes()) {
+			span.SetAttributes(NodeSummaryAttributes(summary.GetNodes()[i])...)
+		}
+		if s.cfg.Legacy {
+			span.SetAttributes(attribute.String("ioam_node", ParseNode(node, fields)))
+		}
+		span.End(trace.WithTimestamp(ends[i]))
+
+		if ends[i].After(end) {
+			end = ends[i]
+		}
+	}
+
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end
+}
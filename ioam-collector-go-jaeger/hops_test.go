@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+func TestNodeTime(t *testing.T) {
+	node := &ioamAPI.IOAMNode{TimestampSecs: 1_700_000_000, TimestampFrac: 1 << 30}
+	tests := []struct {
+		format string
+		want   time.Time
+	}{
+		{TimestampPOSIX, time.Unix(1_700_000_000, (1<<30)*1000)},
+		{TimestampPTP, time.Unix(1_700_000_000, 1<<30)},
+		{TimestampNTP, time.Unix(1_700_000_000-ntpEpochOffset, int64(time.Second/4))},
+	}
+	for _, tt := range tests {
+		if got := NodeTime(node, tt.format); !got.Equal(tt.want) {
+			t.Errorf("%s: NodeTime() = %v, want %v", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestHopSpans(t *testing.T) {
+	timestamps := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeTimestampSecs | ioam.TraceTypeTimestampFrac
+	at := func(us int64) time.Time { return time.Unix(100, us*int64(time.Microsecond)) }
+
+	tests := []struct {
+		name      string
+		fields    ioam.TraceType
+		delays    [2]uint32
+		wantStart [2]time.Time // Zero if received now
+		wantEnd   [2]time.Time
+	}{
+		{"until the next node", timestamps, [2]uint32{}, [2]time.Time{at(10), at(50)}, [2]time.Time{at(50), at(50)}},
+		// The most significant bit of the transit delay is its overflow flag
+		{"transit delay", timestamps | ioam.TraceTypeTransitDelay, [2]uint32{5000, 1<<31 | 7000},
+			[2]time.Time{at(10), at(50)}, [2]time.Time{at(15), at(57)}},
+		{"no timestamp", ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeTransitDelay, [2]uint32{5000, 7000}, [2]time.Time{}, [2]time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			s := NewServer(defaultConfig(), recorder, nil, nil, nil)
+			request := &ioamAPI.IOAMTrace{NamespaceId: 123, BitField: uint32(tt.fields)}
+			for i, us := range []uint32{10, 50} {
+				request.Nodes = append(request.Nodes, &ioamAPI.IOAMNode{
+					HopLimit: uint32(64 - i), Id: uint32(i + 1),
+					TimestampSecs: 100, TimestampFrac: us, TransitDelay: tt.delays[i],
+				})
+			}
+
+			before := time.Now()
+			start, ends := s.hopTimes(request)
+			end := s.hopSpans(context.Background(), request, ends)
+			after := time.Now()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("%d spans, want 2", len(spans))
+			}
+			received := func(ts time.Time) bool { return !ts.Before(before) && !ts.After(after) }
+			for i, span := range spans {
+				if name := span.Name(); name != "hop "+strconv.Itoa(i+1) {
+					t.Errorf("span %d named %q", i, name)
+				}
+				service, _ := span.Resource().Set().Value(semconv.ServiceNameKey)
+				if want := "ioam-node-" + strconv.Itoa(i+1); service.AsString() != want {
+					t.Errorf("span %d of service %q, want %q", i, service.AsString(), want)
+				}
+				if tt.wantStart[i].IsZero() {
+					if !received(span.StartTime()) || !received(span.EndTime()) {
+						t.Errorf("span %d from %v to %v, want when received", i, span.StartTime(), span.EndTime())
+					}
+					continue
+				}
+				if !span.StartTime().Equal(tt.wantStart[i]) || !span.EndTime().Equal(tt.wantEnd[i]) {
+					t.Errorf("span %d from %v to %v, want %v to %v", i, span.StartTime(), span.EndTime(), tt.wantStart[i], tt.wantEnd[i])
+				}
+			}
+			if tt.wantStart[0].IsZero() {
+				if !received(start) || !received(end) {
+					t.Errorf("trace from %v to %v, want when received", start, end)
+				}
+			} else if !start.Equal(tt.wantStart[0]) || !end.Equal(tt.wantEnd[1]) {
+				t.Errorf("trace from %v to %v, want %v to %v", start, end, tt.wantStart[0], tt.wantEnd[1])
+			}
+		})
+	}
+}
+
+func TestNodeTracers(t *testing.T) {
+	s := NewServer(defaultConfig(), tracetest.NewSpanRecorder(), nil, nil, nil)
+	for i := range maxNodeTracers + 10 {
+		s.nodeTracer("ioam-node-" + strconv.Itoa(i))
+	}
+	if len(s.nodes) != maxNodeTracers {
+		t.Errorf("%d tracer providers, want %d", len(s.nodes), maxNodeTracers)
+	}
+
+	// A provider dropped from the map keeps the shared processor running
+	recorder := tracetest.NewSpanRecorder()
+	s = NewServer(defaultConfig(), recorder, nil, nil, nil)
+	for i := range maxNodeTracers + 1 {
+		_, span := s.nodeTracer("ioam-node-"+strconv.Itoa(i)).Start(context.Background(), "hop")
+		span.End()
+	}
+	if n := len(recorder.Ended()); n != maxNodeTracers+1 {
+		t.Errorf("%d spans recorded, want %d", n, maxNodeTracers+1)
+	}
+}
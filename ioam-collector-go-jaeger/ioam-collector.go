@@ -3,10 +3,14 @@ package main
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -14,149 +18,311 @@ import (
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam/inventory"
 	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
 )
 
-var MASK_BIT0 = uint32(1 << 31)  // Hop_Lim + Node Id (short format)
-var MASK_BIT1 = uint32(1 << 30)  // Ingress/Egress Ids (short format)
-var MASK_BIT2 = uint32(1 << 29)  // Timestamp seconds
-var MASK_BIT3 = uint32(1 << 28)  // Timestamp fraction
-var MASK_BIT4 = uint32(1 << 27)  // Transit Delay
-var MASK_BIT5 = uint32(1 << 26)  // Namespace Data (short format)
-var MASK_BIT6 = uint32(1 << 25)  // Queue depth
-var MASK_BIT7 = uint32(1 << 24)  // Checksum Complement
-var MASK_BIT8 = uint32(1 << 23)  // Hop_Lim + Node Id (wide format)
-var MASK_BIT9 = uint32(1 << 22)  // Ingress/Egress Ids (wide format)
-var MASK_BIT10 = uint32(1 << 21) // Namespace Data (wide format)
-var MASK_BIT11 = uint32(1 << 20) // Buffer Occupancy
-var MASK_BIT22 = uint32(1 << 9)  // Opaque State Snapshot
-
 func main() {
+	cfg, err := ParseConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	ctx := context.Background()
-	exp, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithInsecure(),
-	)
+	exp, err := NewExporter(ctx, cfg)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Cannot create OTLP %s exporter: %v", cfg.Protocol, err)
 	}
+	processor := tracesdk.NewBatchSpanProcessor(exp,
+		tracesdk.WithMaxExportBatchSize(cfg.BatchSize),
+		tracesdk.WithMaxQueueSize(cfg.QueueSize),
+		tracesdk.WithBatchTimeout(cfg.BatchTimeout),
+	)
 	tp := tracesdk.NewTracerProvider(
-		tracesdk.WithBatcher(exp),
+		tracesdk.WithSpanProcessor(processor),
+		tracesdk.WithIDGenerator(IDGenerator{}),
 		tracesdk.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("CLT"),
+			cfg.ResourceAttributes(cfg.ServiceName)...,
 		)),
 	)
 	otel.SetTracerProvider(tp)
 
+	var metrics *Metrics
+	if cfg.Metrics {
+		mexp, err := NewMetricExporter(ctx, cfg)
+		if err != nil {
+			log.Fatalf("Cannot create OTLP %s metric exporter: %v", cfg.Protocol, err)
+		}
+		mp := sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(mexp, sdkmetric.WithInterval(cfg.MetricsInterval))),
+			sdkmetric.WithResource(resource.NewWithAttributes(
+				semconv.SchemaURL,
+				cfg.ResourceAttributes(cfg.ServiceName)...,
+			)),
+		)
+		otel.SetMeterProvider(mp)
+
+		metrics, err = NewMetrics(mp.Meter(cfg.TracerName), cfg.TimestampFormat)
+		if err != nil {
+			log.Fatalf("Cannot create metrics: %v", err)
+		}
+	}
+
+	var store *Store
+	if cfg.Store != "" {
+		store, err = OpenStore(cfg.Store, cfg.StoreRetention, cfg.StoreMaxTraces)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var inv *inventory.Watcher
+	if cfg.Inventory != "" {
+		if inv, err = inventory.Watch(cfg.Inventory, cfg.InventoryReload, log.Printf); err != nil {
+			log.Fatalf("Cannot load inventory: %v", err)
+		}
+	}
+
 	grpcServer := grpc.NewServer()
-	var server Server
+	server := NewServer(cfg, processor, metrics, store, inv)
 	ioamAPI.RegisterIOAMServiceServer(grpcServer, server)
-	listen, err := net.Listen("tcp", ":7123")
-	if err != nil {
-		log.Fatalf("Could not listen: %v", err)
-	}
 
-	log.Println("IOAM collector listening on 7123...")
-	log.Fatal(grpcServer.Serve(listen))
+	errs := make(chan error, len(cfg.Listen)+1)
+	if cfg.HTTPListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /api/agents", server.agents)
+		mux.Handle("GET /api/invalid", server.validator)
+		if store != nil {
+			mux.Handle("/api/", store.Handler())
+		}
+		log.Printf("IOAM query API listening on %s...", cfg.HTTPListen)
+		go func() {
+			errs <- http.ListenAndServe(cfg.HTTPListen, mux)
+		}()
+	}
+	for _, addr := range cfg.Listen {
+		listen, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Could not listen on %s: %v", addr, err)
+		}
+		log.Printf("IOAM collector listening on %s...", addr)
+		go func() {
+			errs <- grpcServer.Serve(listen)
+		}()
+	}
+	log.Fatal(<-errs)
 }
 
-type Server struct {
-	ioamAPI.UnimplementedIOAMServiceServer
+// NewExporter creates the OTLP span exporter for the configured protocol.
+func NewExporter(ctx context.Context, cfg *Config) (tracesdk.SpanExporter, error) {
+	switch cfg.Protocol {
+	case "http":
+		var opts []otlptracehttp.Option
+		if strings.Contains(cfg.Endpoint, "://") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case "grpc":
+		var opts []otlptracegrpc.Option
+		if strings.Contains(cfg.Endpoint, "://") {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+	return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
 }
 
-func (Server) Report(stream ioamAPI.IOAMService_ReportServer) error {
-	log.Println("New gRPC stream")
+func (s *Server) Report(stream ioamAPI.IOAMService_ReportServer) error {
+	agent := NewAgent(stream.Context())
+	s.agents.Add(agent)
+	defer s.agents.Remove(agent)
+
+	log.Printf("New gRPC stream from %s (address %s, version %q, config %q)",
+		agent.Name(), agent.Address, agent.Version, agent.ConfigHash)
 	for {
 		request, err := stream.Recv()
 		if err == io.EOF {
-			log.Println("Client closed stream")
+			log.Printf("%s closed stream", agent.Name())
 			return stream.SendAndClose(&emptypb.Empty{})
 		}
 		if err != nil {
-			log.Printf("Error receiving trace: %v", err)
+			log.Printf("Error receiving trace from %s: %v", agent.Name(), err)
 			return err
 		}
+		now := time.Now()
+		agent.Seen(now)
+
+		invalid := s.validator.Validate(request)
+		if len(invalid) > 0 {
+			if s.metrics != nil {
+				s.metrics.RecordInvalid(stream.Context(), invalid)
+			}
+			if s.cfg.Invalid == InvalidDrop {
+				continue
+			}
+		}
+
+		s.label(request)
+		start, ends := s.hopTimes(request)
+		ctx := s.traceContext(request, start)
 
-		var traceID trace.TraceID
-		binary.BigEndian.PutUint64(traceID[:8], request.GetTraceId_High())
-		binary.BigEndian.PutUint64(traceID[8:], request.GetTraceId_Low())
+		tracer := otel.Tracer(s.cfg.TracerName)
+		ctx, span := tracer.Start(ctx, "ioam-span", trace.WithTimestamp(start))
 
-		var spanID trace.SpanID
-		binary.BigEndian.PutUint64(spanID[:], request.GetSpanId())
+		span.SetAttributes(
+			AttrNamespaceID.Int64(int64(request.GetNamespaceId())),
+			AttrTraceType.Int64(int64(request.GetBitField())),
+			AttrNodeCount.Int(len(request.GetNodes())),
+			AttrOverflow.Bool(request.GetOverflow()),
+			AttrLoopback.Bool(request.GetLoopback()),
+			AttrActive.Bool(request.GetActive()),
+		)
+		span.SetAttributes(agent.Attributes()...)
+		if len(invalid) > 0 {
+			span.SetAttributes(AttrInvalid.Bool(true), AttrInvalidReasons.StringSlice(invalid))
+			span.SetStatus(codes.Error, "invalid IOAM trace")
+		}
+		if flow := request.GetFlow(); flow != nil {
+			span.SetAttributes(FlowAttributes(flow)...)
+		}
+		if ns := request.GetNamespace(); ns != nil {
+			span.SetAttributes(NamespaceAttributes(ns)...)
+		}
+		if c := request.GetCompleteness(); c != nil {
+			span.SetAttributes(CompletenessAttributes(c)...)
+		}
+		if c := request.GetChecksum(); c != nil {
+			span.SetAttributes(ChecksumAttributes(c)...)
+			if c.GetCorrupted() && len(invalid) == 0 {
+				span.SetStatus(codes.Error, "packet corrupted on the IOAM path")
+			}
+		}
+		if summary := request.GetSummary(); summary != nil {
+			span.SetAttributes(AttrSummaryPackets.Int64(int64(summary.GetPackets())))
+		}
 
-		span_ctx := trace.NewSpanContext(trace.SpanContextConfig{
-			TraceID:    traceID,
-			SpanID:     spanID,
-			TraceFlags: trace.FlagsSampled,
-		})
-		ctx := trace.ContextWithSpanContext(context.Background(), span_ctx)
+		if s.cfg.Legacy {
+			i := 1
+			for _, node := range request.GetNodes() {
+				key := "ioam_namespace" + strconv.FormatUint(uint64(request.GetNamespaceId()), 10) + "_node" + strconv.Itoa(i)
+				str := ParseNode(node, ioam.TraceType(request.GetBitField()))
 
-		tracer := otel.Tracer("ioam-tracer")
-		_, span := tracer.Start(ctx, "ioam-span")
+				span.SetAttributes(attribute.String(key, str))
+				i += 1
+			}
+			if summary := request.GetSummary(); summary != nil {
+				span.SetAttributes(SummaryAttributes(request.GetNamespaceId(), summary)...)
+			}
+		}
 
-		i := 1
-		for _, node := range request.GetNodes() {
-			key := "ioam_namespace" + strconv.FormatUint(uint64(request.GetNamespaceId()), 10) + "_node" + strconv.Itoa(i)
-			str := ParseNode(node, request.GetBitField())
+		end := s.hopSpans(ctx, request, ends)
+		span.End(trace.WithTimestamp(end))
 
-			span.SetAttributes(attribute.String(key, str))
-			i += 1
+		if s.metrics != nil {
+			s.metrics.Record(stream.Context(), agent.Name(), request)
+		}
+		if s.store != nil {
+			// Stored with the trace ID of the span, so that it can be
+			// looked up from the backend
+			id := span.SpanContext().TraceID()
+			request.TraceId_High = binary.BigEndian.Uint64(id[:8])
+			request.TraceId_Low = binary.BigEndian.Uint64(id[8:])
+			s.store.Add(now, request)
 		}
+	}
+}
+
+// SummaryAttributes describes the statistics of the traces aggregated by the
+// agent in the legacy format, one "name=min/avg/max/p50/p90/p99" list per node.
+func SummaryAttributes(namespace uint32, summary *ioamAPI.Summary) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int64("ioam_summary_packets", int64(summary.GetPackets())),
+	}
 
-		span.End()
+	for i, node := range summary.GetNodes() {
+		key := "ioam_namespace" + strconv.FormatUint(uint64(namespace), 10) + "_node" + strconv.Itoa(i+1) + "_summary"
+		str := ""
+		for _, field := range node.GetFields() {
+			str += fmt.Sprintf("%s=%d/%.1f/%d/%d/%d/%d; ", field.GetName(), field.GetMin(), field.GetAvg(),
+				field.GetMax(), field.GetP50(), field.GetP90(), field.GetP99())
+		}
+		attrs = append(attrs, attribute.String(key, str))
 	}
+
+	return attrs
 }
 
-func ParseNode(node *ioamAPI.IOAMNode, fields uint32) string {
+func ParseNode(node *ioamAPI.IOAMNode, fields ioam.TraceType) string {
 	str := ""
 
-	if (fields & MASK_BIT0) != 0 {
+	if fields&ioam.TraceTypeHopLimitNodeID != 0 {
 		str += "HopLimit=" + strconv.FormatUint(uint64(node.GetHopLimit()), 10) + "; "
 		str += "Id=" + strconv.FormatUint(uint64(node.GetId()), 10) + "; "
 	}
-	if (fields & MASK_BIT1) != 0 {
+	if fields&ioam.TraceTypeInterfaceIDs != 0 {
 		str += "IngressId=" + strconv.FormatUint(uint64(node.GetIngressId()), 10) + "; "
 		str += "EgressId=" + strconv.FormatUint(uint64(node.GetEgressId()), 10) + "; "
 	}
-	if (fields & MASK_BIT2) != 0 {
+	if fields&ioam.TraceTypeTimestampSecs != 0 {
 		str += "TimestampSecs=" + strconv.FormatUint(uint64(node.GetTimestampSecs()), 10) + "; "
 	}
-	if (fields & MASK_BIT3) != 0 {
+	if fields&ioam.TraceTypeTimestampFrac != 0 {
 		str += "TimestampFrac=" + strconv.FormatUint(uint64(node.GetTimestampFrac()), 10) + "; "
 	}
-	if (fields & MASK_BIT4) != 0 {
+	if fields&ioam.TraceTypeTransitDelay != 0 {
 		str += "TransitDelay=" + strconv.FormatUint(uint64(node.GetTransitDelay()), 10) + "; "
 	}
-	if (fields & MASK_BIT5) != 0 {
+	if fields&ioam.TraceTypeNamespaceData != 0 {
 		str += "NamespaceData=0x" + hex.EncodeToString(node.GetNamespaceData()) + "; "
 	}
-	if (fields & MASK_BIT6) != 0 {
+	if fields&ioam.TraceTypeQueueDepth != 0 {
 		str += "QueueDepth=" + strconv.FormatUint(uint64(node.GetQueueDepth()), 10) + "; "
 	}
-	if (fields & MASK_BIT7) != 0 {
+	if fields&ioam.TraceTypeChecksumComplement != 0 {
 		str += "CsumComp=" + strconv.FormatUint(uint64(node.GetCsumComp()), 10) + "; "
 	}
-	if (fields & MASK_BIT8) != 0 {
+	if fields&ioam.TraceTypeHopLimitNodeIDWide != 0 {
 		str += "HopLimit=" + strconv.FormatUint(uint64(node.GetHopLimit()), 10) + "; "
 		str += "IdWide=" + strconv.FormatUint(uint64(node.GetIdWide()), 10) + "; "
 	}
-	if (fields & MASK_BIT9) != 0 {
+	if fields&ioam.TraceTypeInterfaceIDsWide != 0 {
 		str += "IngressIdWide=" + strconv.FormatUint(uint64(node.GetIngressIdWide()), 10) + "; "
 		str += "EgressIdWide=" + strconv.FormatUint(uint64(node.GetEgressIdWide()), 10) + "; "
 	}
-	if (fields & MASK_BIT10) != 0 {
+	if fields&ioam.TraceTypeNamespaceDataWide != 0 {
 		str += "NamespaceDataWide=0x" + hex.EncodeToString(node.GetNamespaceDataWide()) + "; "
 	}
-	if (fields & MASK_BIT11) != 0 {
+	if fields&ioam.TraceTypeBufferOccupancy != 0 {
 		str += "BufferOccupancy=" + strconv.FormatUint(uint64(node.GetBufferOccupancy()), 10) + "; "
 	}
-	if (fields & MASK_BIT22) != 0 {
+	if fields&ioam.TraceTypeOSS != 0 {
 		str += "OpaqueStateSchemaId=" + strconv.FormatUint(uint64(node.GetOSS().GetSchemaId()), 10) + "; "
 		str += "OpaqueStateData=0x" + hex.EncodeToString(node.GetOSS().GetData()) + "; "
 	}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// Metric attributes
+const (
+	AttrAgent    = attribute.Key("ioam.agent")
+	AttrLinkFrom = attribute.Key("ioam.link.from")
+	AttrLinkTo   = attribute.Key("ioam.link.to")
+
+	AttrLinkFromName = attribute.Key("ioam.link.from_name") // Hostnames from the inventory, empty if unknown
+	AttrLinkToName   = attribute.Key("ioam.link.to_name")
+
+	AttrReason = attribute.Key("ioam.invalid.reason")
+)
+
+// Metrics records the measurements carried by the IOAM traces.
+type Metrics struct {
+	format string
+
+	transitDelay    metric.Int64Histogram
+	queueDepth      metric.Int64Histogram
+	bufferOccupancy metric.Int64Histogram
+	linkDelay       metric.Int64Histogram
+	traces          metric.Int64Counter
+	agentTraces     metric.Int64Counter
+	invalidTraces   metric.Int64Counter
+	csumMismatches  metric.Int64Counter
+}
+
+// NewMetrics creates the IOAM instruments. format is the timestamp format
+// used to compute the hop-to-hop delays.
+func NewMetrics(meter metric.Meter, format string) (*Metrics, error) {
+	m := &Metrics{format: format}
+	var err error
+
+	if m.transitDelay, err = meter.Int64Histogram("ioam.node.transit_delay",
+		metric.WithDescription("Transit delay of the packets through an IOAM node"),
+		metric.WithUnit("ns")); err != nil {
+		return nil, err
+	}
+	if m.queueDepth, err = meter.Int64Histogram("ioam.node.queue_depth",
+		metric.WithDescription("Queue depth of the egress interface of an IOAM node"),
+		metric.WithUnit("{unit}")); err != nil {
+		return nil, err
+	}
+	if m.bufferOccupancy, err = meter.Int64Histogram("ioam.node.buffer_occupancy",
+		metric.WithDescription("Buffer occupancy of an IOAM node"),
+		metric.WithUnit("{unit}")); err != nil {
+		return nil, err
+	}
+	if m.linkDelay, err = meter.Int64Histogram("ioam.link.delay",
+		metric.WithDescription("One-way delay between two consecutive IOAM nodes, from their timestamps"),
+		metric.WithUnit("ns")); err != nil {
+		return nil, err
+	}
+	if m.traces, err = meter.Int64Counter("ioam.traces",
+		metric.WithDescription("IOAM traces received, per namespace"),
+		metric.WithUnit("{trace}")); err != nil {
+		return nil, err
+	}
+	if m.agentTraces, err = meter.Int64Counter("ioam.agent.traces",
+		metric.WithDescription("IOAM traces received, per agent"),
+		metric.WithUnit("{trace}")); err != nil {
+		return nil, err
+	}
+
+	if m.invalidTraces, err = meter.Int64Counter("ioam.traces.invalid",
+		metric.WithDescription("Invalid IOAM traces received, per reason"),
+		metric.WithUnit("{trace}")); err != nil {
+		return nil, err
+	}
+	if m.csumMismatches, err = meter.Int64Counter("ioam.node.checksum_mismatches",
+		metric.WithDescription("IOAM node data not checksum-neutral despite their Checksum Complement, per node"),
+		metric.WithUnit("{trace}")); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// RecordInvalid counts an invalid trace once for every reason.
+func (m *Metrics) RecordInvalid(ctx context.Context, reasons []string) {
+	for _, reason := range reasons {
+		m.invalidTraces.Add(ctx, 1, metric.WithAttributes(AttrReason.String(reason)))
+	}
+}
+
+// Record records the measurements of a trace received from an agent.
+func (m *Metrics) Record(ctx context.Context, agent string, request *ioamAPI.IOAMTrace) {
+	ns := AttrNamespaceID.Int64(int64(request.GetNamespaceId()))
+	fields := ioam.TraceType(request.GetBitField())
+	nodes := request.GetNodes()
+
+	m.traces.Add(ctx, 1, metric.WithAttributes(ns))
+	m.agentTraces.Add(ctx, 1, metric.WithAttributes(AttrAgent.String(agent)))
+
+	for i, node := range nodes {
+		attrs := metric.WithAttributes(ns, AttrNodeID.Int64(int64(NodeID(node, fields))),
+			AttrHostname.String(node.GetLabels().GetHostname()))
+
+		if fields&ioam.TraceTypeTransitDelay != 0 {
+			// The most significant bit is the overflow flag
+			m.transitDelay.Record(ctx, int64(node.GetTransitDelay()&0x7FFFFFFF), attrs)
+		}
+		if fields&ioam.TraceTypeQueueDepth != 0 {
+			m.queueDepth.Record(ctx, int64(node.GetQueueDepth()), attrs)
+		}
+		if fields&ioam.TraceTypeBufferOccupancy != 0 {
+			m.bufferOccupancy.Record(ctx, int64(node.GetBufferOccupancy()), attrs)
+		}
+		if slices.Contains(request.GetChecksum().GetMismatches(), uint32(i)) {
+			m.csumMismatches.Add(ctx, 1, attrs)
+		}
+		if fields&ioam.TraceTypeTimestampSecs != 0 && fields&ioam.TraceTypeTimestampFrac != 0 && i > 0 {
+			delay := NodeTime(node, m.format).Sub(NodeTime(nodes[i-1], m.format))
+			m.linkDelay.Record(ctx, delay.Nanoseconds(), metric.WithAttributes(ns,
+				AttrLinkFrom.Int64(int64(NodeID(nodes[i-1], fields))),
+				AttrLinkTo.Int64(int64(NodeID(node, fields))),
+				AttrLinkFromName.String(nodes[i-1].GetLabels().GetHostname()),
+				AttrLinkToName.String(node.GetLabels().GetHostname())))
+		}
+	}
+}
+
+// NewMetricExporter creates the OTLP metric exporter for the configured
+// protocol, with the same endpoint and headers as the span exporter.
+func NewMetricExporter(ctx context.Context, cfg *Config) (sdkmetric.Exporter, error) {
+	switch cfg.Protocol {
+	case "http":
+		var opts []otlpmetrichttp.Option
+		if strings.Contains(cfg.Endpoint, "://") {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	case "grpc":
+		var opts []otlpmetricgrpc.Option
+		if strings.Contains(cfg.Endpoint, "://") {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+	return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
+}
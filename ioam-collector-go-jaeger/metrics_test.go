@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// collect returns the metrics of the reader by name.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+// histogram returns the count and sum of the data point of a histogram with
+// the given attribute.
+func histogram(t *testing.T, data metricdata.Aggregation, attr attribute.KeyValue) (uint64, int64) {
+	t.Helper()
+	h, ok := data.(metricdata.Histogram[int64])
+	if !ok {
+		t.Fatalf("%T is not a histogram", data)
+	}
+	for _, dp := range h.DataPoints {
+		if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+			return dp.Count, dp.Sum
+		}
+	}
+	return 0, 0
+}
+
+// counter returns the value of a counter with the given attribute.
+func counter(t *testing.T, data metricdata.Aggregation, attr attribute.KeyValue) int64 {
+	t.Helper()
+	s, ok := data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("%T is not a counter", data)
+	}
+	for _, dp := range s.DataPoints {
+		if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+			return dp.Value
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := NewMetrics(mp.Meter("test"), TimestampPTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeTimestampSecs | ioam.TraceTypeTimestampFrac |
+		ioam.TraceTypeTransitDelay | ioam.TraceTypeQueueDepth | ioam.TraceTypeChecksumComplement
+	request := &ioamAPI.IOAMTrace{
+		NamespaceId: 123,
+		BitField:    uint32(fields),
+		Nodes: []*ioamAPI.IOAMNode{
+			{Id: 1, TimestampSecs: 100, TimestampFrac: 999_999_000, TransitDelay: 1<<31 | 500, QueueDepth: 4},
+			{Id: 2, TimestampSecs: 101, TimestampFrac: 2_000, TransitDelay: 700, QueueDepth: 6,
+				Labels: &ioamAPI.NodeLabels{Hostname: "r2"}},
+		},
+		Checksum: &ioamAPI.Checksum{Mismatches: []uint32{1}},
+	}
+	for range 2 {
+		m.Record(context.Background(), "h1/eth0", request)
+	}
+	m.RecordInvalid(context.Background(), []string{InvalidNamespace, InvalidFieldSize})
+
+	metrics := collect(t, reader)
+	node1, node2 := AttrNodeID.Int64(1), AttrNodeID.Int64(2)
+
+	// The overflow flag of the transit delay is masked
+	if count, sum := histogram(t, metrics["ioam.node.transit_delay"], node1); count != 2 || sum != 1000 {
+		t.Errorf("transit delay of node 1: count %d, sum %d, want 2 and 1000", count, sum)
+	}
+	if count, sum := histogram(t, metrics["ioam.node.queue_depth"], node2); count != 2 || sum != 12 {
+		t.Errorf("queue depth of node 2: count %d, sum %d, want 2 and 12", count, sum)
+	}
+	if _, ok := metrics["ioam.node.buffer_occupancy"]; ok {
+		t.Error("buffer occupancy recorded without its trace type bit")
+	}
+	if count, sum := histogram(t, metrics["ioam.link.delay"], AttrLinkToName.String("r2")); count != 2 || sum != 6000 {
+		t.Errorf("link delay: count %d, sum %d, want 2 and 6000", count, sum)
+	}
+	if got := counter(t, metrics["ioam.traces"], AttrNamespaceID.Int64(123)); got != 2 {
+		t.Errorf("traces of namespace 123 = %d, want 2", got)
+	}
+	if got := counter(t, metrics["ioam.agent.traces"], AttrAgent.String("h1/eth0")); got != 2 {
+		t.Errorf("traces of agent = %d, want 2", got)
+	}
+	if got := counter(t, metrics["ioam.node.checksum_mismatches"], node2); got != 2 {
+		t.Errorf("checksum mismatches of node 2 = %d, want 2", got)
+	}
+	if got := counter(t, metrics["ioam.node.checksum_mismatches"], node1); got != 0 {
+		t.Errorf("checksum mismatches of node 1 = %d, want 0", got)
+	}
+	for _, reason := range []string{InvalidNamespace, InvalidFieldSize} {
+		if got := counter(t, metrics["ioam.traces.invalid"], AttrReason.String(reason)); got != 1 {
+			t.Errorf("invalid traces for %s = %d, want 1", reason, got)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+const (
+	storeQueueSize    = 4096 // Traces waiting to be written
+	storeBatchSize    = 1024 // Traces written per transaction
+	storeBatchDelay   = 100 * time.Millisecond
+	retentionInterval = time.Minute
+
+	defaultQueryLimit = 100
+	maxQueryLimit     = 10000
+	maxPathScan       = 100000 // Traces scanned to compute the paths
+)
+
+// Buckets. Traces are keyed by time (8-octet Unix time in ns + 8-octet
+// sequence number), the indexes map <prefix><time key> to nothing.
+var (
+	bucketTraces    = []byte("traces")
+	bucketNamespace = []byte("namespace") // 4-octet namespace ID prefix
+	bucketNode      = []byte("node")      // 4-octet namespace ID + 8-octet node ID prefix
+	bucketTraceID   = []byte("trace_id")  // 16-octet trace ID prefix
+)
+
+type storedTrace struct {
+	key   []byte
+	trace *ioamAPI.IOAMTrace
+}
+
+// Store keeps the received traces in a local database, indexed by time,
+// namespace, node ID and trace ID.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+	maxTraces int
+
+	seq     uint64
+	dropped uint64
+	queue   chan storedTrace
+}
+
+// OpenStore opens (or creates) the database. Traces older than retention
+// are removed, as well as the oldest ones beyond maxTraces.
+func OpenStore(path string, retention time.Duration, maxTraces int) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open store %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketTraces, bucketNamespace, bucketNode, bucketTraceID} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Cannot initialize store %s: %v", path, err)
+	}
+
+	st := &Store{
+		db:        db,
+		retention: retention,
+		maxTraces: maxTraces,
+		seq:       uint64(time.Now().UnixNano()),
+		queue:     make(chan storedTrace, storeQueueSize),
+	}
+	go st.writer()
+	go func() {
+		for range time.Tick(retentionInterval) {
+			if err := st.enforceRetention(time.Now()); err != nil {
+				log.Printf("Error applying store retention: %v", err)
+			}
+		}
+	}()
+
+	return st, nil
+}
+
+// Add queues a trace received at the given time to be stored.
+func (st *Store) Add(received time.Time, request *ioamAPI.IOAMTrace) {
+	select {
+	case st.queue <- storedTrace{key: timeKey(received, atomic.AddUint64(&st.seq, 1)), trace: request}:
+	default:
+		if atomic.AddUint64(&st.dropped, 1)%1000 == 1 {
+			log.Printf("Store queue full, %d trace(s) dropped so far", atomic.LoadUint64(&st.dropped))
+		}
+	}
+}
+
+func (st *Store) writer() {
+	batch := make([]storedTrace, 0, storeBatchSize)
+	timer := time.NewTimer(storeBatchDelay)
+
+	for {
+		select {
+		case t := <-st.queue:
+			batch = append(batch, t)
+			if len(batch) < storeBatchSize {
+				continue
+			}
+		case <-timer.C:
+			timer.Reset(storeBatchDelay)
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := st.db.Update(func(tx *bolt.Tx) error {
+			for _, t := range batch {
+				if err := putTrace(tx, t); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			log.Printf("Error writing traces to store: %v", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+func putTrace(tx *bolt.Tx, t storedTrace) error {
+	data, err := proto.Marshal(t.trace)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketTraces).Put(t.key, data); err != nil {
+		return err
+	}
+	for _, k := range indexKeys(t.key, t.trace) {
+		if err := tx.Bucket(k.bucket).Put(k.key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type indexKey struct {
+	bucket []byte
+	key    []byte
+}
+
+func indexKeys(tkey []byte, trace *ioamAPI.IOAMTrace) []indexKey {
+	keys := []indexKey{
+		{bucketNamespace, concat(namespacePrefix(trace.GetNamespaceId()), tkey)},
+	}
+	seen := make(map[uint64]bool)
+	for _, node := range trace.GetNodes() {
+		id := NodeID(node, ioam.TraceType(trace.GetBitField()))
+		if !seen[id] {
+			seen[id] = true
+			keys = append(keys, indexKey{bucketNode, concat(nodePrefix(trace.GetNamespaceId(), id), tkey)})
+		}
+	}
+	if trace.GetTraceId_High() != 0 || trace.GetTraceId_Low() != 0 {
+		keys = append(keys, indexKey{bucketTraceID, concat(traceIDPrefix(trace.GetTraceId_High(), trace.GetTraceId_Low()), tkey)})
+	}
+	return keys
+}
+
+// enforceRetention removes the traces older than the retention and the
+// oldest ones beyond the maximum number of traces.
+func (st *Store) enforceRetention(now time.Time) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		traces := tx.Bucket(bucketTraces)
+		excess := traces.Stats().KeyN - st.maxTraces
+		limit := timeKey(now.Add(-st.retention), 0)
+
+		c := traces.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			if excess <= 0 && bytes.Compare(k, limit) >= 0 {
+				break
+			}
+			trace := &ioamAPI.IOAMTrace{}
+			if err := proto.Unmarshal(v, trace); err == nil {
+				for _, ik := range indexKeys(k, trace) {
+					if err := tx.Bucket(ik.bucket).Delete(ik.key); err != nil {
+						return err
+					}
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			excess--
+		}
+		return nil
+	})
+}
+
+// Query selects stored traces. Zero values match everything.
+type Query struct {
+	Namespace *uint32
+	Node      *uint64
+	TraceID   []byte // 16 octets
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Result is a stored trace as returned by the HTTP API.
+type Result struct {
+	Received time.Time       `json:"received"`
+	Trace    json.RawMessage `json:"trace"`
+}
+
+// scan calls fn for the traces matching the query, newest first, until fn
+// returns false.
+func (st *Store) scan(q Query, fn func(tkey []byte, trace *ioamAPI.IOAMTrace) bool) error {
+	var bucket, prefix []byte
+	switch {
+	case q.TraceID != nil:
+		bucket, prefix = bucketTraceID, q.TraceID
+	case q.Node != nil && q.Namespace != nil:
+		bucket, prefix = bucketNode, nodePrefix(*q.Namespace, *q.Node)
+	case q.Namespace != nil:
+		bucket, prefix = bucketNamespace, namespacePrefix(*q.Namespace)
+	default:
+		bucket = bucketTraces
+	}
+
+	until := q.Until
+	if until.IsZero() {
+		until = time.Unix(0, 1<<63-1)
+	}
+	since := timeKey(q.Since, 0)
+
+	return st.db.View(func(tx *bolt.Tx) error {
+		traces := tx.Bucket(bucketTraces)
+		c := tx.Bucket(bucket).Cursor()
+
+		start := concat(prefix, timeKey(until, 1<<64-1))
+		k, _ := c.Seek(start)
+		if k == nil {
+			k, _ = c.Last()
+		} else if bytes.Compare(k, start) > 0 {
+			k, _ = c.Prev()
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			tkey := k[len(prefix):]
+			if bytes.Compare(tkey, since) < 0 {
+				break
+			}
+			v := traces.Get(tkey)
+			if v == nil {
+				continue
+			}
+			trace := &ioamAPI.IOAMTrace{}
+			if err := proto.Unmarshal(v, trace); err != nil {
+				continue
+			}
+			if !q.matches(trace) {
+				continue
+			}
+			if !fn(tkey, trace) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (q Query) matches(trace *ioamAPI.IOAMTrace) bool {
+	if q.Namespace != nil && trace.GetNamespaceId() != *q.Namespace {
+		return false
+	}
+	if q.Node != nil {
+		found := false
+		for _, node := range trace.GetNodes() {
+			if NodeID(node, ioam.TraceType(trace.GetBitField())) == *q.Node {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Traces returns the traces matching the query, newest first.
+func (st *Store) Traces(q Query) ([]Result, error) {
+	var results []Result
+	var err error
+
+	scanErr := st.scan(q, func(tkey []byte, trace *ioamAPI.IOAMTrace) bool {
+		var data []byte
+		data, err = protojson.Marshal(trace)
+		if err != nil {
+			return false
+		}
+		results = append(results, Result{Received: keyTime(tkey), Trace: data})
+		return len(results) < q.Limit
+	})
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	return results, err
+}
+
+// Path is a sequence of node IDs taken by the traces of a namespace.
+type Path struct {
+	Namespace uint32    `json:"namespace"`
+	Nodes     []uint64  `json:"nodes"`
+	Traces    int       `json:"traces"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Paths returns the distinct paths of the traces matching the query, most
+// frequent first.
+func (st *Store) Paths(q Query) ([]*Path, error) {
+	paths := make(map[string]*Path)
+	scanned := 0
+
+	err := st.scan(q, func(tkey []byte, trace *ioamAPI.IOAMTrace) bool {
+		nodes := make([]uint64, len(trace.GetNodes()))
+		ids := make([]string, len(nodes))
+		for i, node := range trace.GetNodes() {
+			nodes[i] = NodeID(node, ioam.TraceType(trace.GetBitField()))
+			ids[i] = strconv.FormatUint(nodes[i], 10)
+		}
+		key := strconv.FormatUint(uint64(trace.GetNamespaceId()), 10) + ":" + strings.Join(ids, ",")
+
+		t := keyTime(tkey)
+		p, ok := paths[key]
+		if !ok {
+			p = &Path{Namespace: trace.GetNamespaceId(), Nodes: nodes, LastSeen: t}
+			paths[key] = p
+		}
+		p.Traces++
+		p.FirstSeen = t
+
+		scanned++
+		return scanned < maxPathScan
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Path, 0, len(paths))
+	for _, p := range paths {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Traces > result[j].Traces })
+	return result, nil
+}
+
+// Handler serves the query API:
+//
+//	GET /api/traces?namespace=&node=&trace_id=&since=&until=&limit=
+//	GET /api/paths?namespace=&node=&since=&until=
+//
+// since and until are RFC 3339 times or durations before now (e.g. 1h).
+func (st *Store) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/traces", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results, err := st.Traces(q)
+		writeJSON(w, results, err)
+	})
+	mux.HandleFunc("GET /api/paths", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		paths, err := st.Paths(q)
+		writeJSON(w, paths, err)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func parseQuery(r *http.Request) (Query, error) {
+	values := r.URL.Query()
+	q := Query{Limit: defaultQueryLimit}
+	now := time.Now()
+
+	if v := values.Get("namespace"); v != "" {
+		ns, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return q, fmt.Errorf("invalid namespace: %v", err)
+		}
+		ns32 := uint32(ns)
+		q.Namespace = &ns32
+	}
+	if v := values.Get("node"); v != "" {
+		node, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid node: %v", err)
+		}
+		q.Node = &node
+	}
+	if v := values.Get("trace_id"); v != "" {
+		id, err := hex.DecodeString(v)
+		if err != nil || len(id) != 16 {
+			return q, fmt.Errorf("invalid trace_id: 32 hex digits expected")
+		}
+		q.TraceID = id
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		v := values.Get(name)
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			*dst = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			*dst = t
+		} else {
+			return q, fmt.Errorf("invalid %s: RFC 3339 time or duration expected", name)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxQueryLimit {
+			return q, fmt.Errorf("invalid limit: 1 to %d expected", maxQueryLimit)
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+func timeKey(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	if ns < 0 {
+		ns = 0
+	}
+	binary.BigEndian.PutUint64(k[:8], uint64(ns))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))
+}
+
+func namespacePrefix(ns uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, ns)
+}
+
+func nodePrefix(ns uint32, node uint64) []byte {
+	return binary.BigEndian.AppendUint64(namespacePrefix(ns), node)
+}
+
+func traceIDPrefix(high, low uint64) []byte {
+	return binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, high), low)
+}
+
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+func openTestStore(t *testing.T, retention time.Duration, maxTraces int) *Store {
+	t.Helper()
+	st, err := OpenStore(filepath.Join(t.TempDir(), "ioam.db"), retention, maxTraces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.db.Close() })
+	return st
+}
+
+// put stores a trace synchronously, with the node IDs as nodes.
+func put(t *testing.T, st *Store, received time.Time, ns uint32, traceID uint64, nodes ...uint32) {
+	t.Helper()
+	trace := &ioamAPI.IOAMTrace{NamespaceId: ns, BitField: uint32(ioam.TraceTypeHopLimitNodeID), TraceId_Low: traceID}
+	for _, id := range nodes {
+		trace.Nodes = append(trace.Nodes, &ioamAPI.IOAMNode{Id: id})
+	}
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		st.seq++
+		return putTrace(tx, storedTrace{key: timeKey(received, st.seq), trace: trace})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// namespaces returns the namespaces of the results, to identify them.
+func namespaces(t *testing.T, results []Result) []uint32 {
+	t.Helper()
+	ids := []uint32{}
+	for _, r := range results {
+		var trace struct{ NamespaceId uint32 }
+		if err := json.Unmarshal(r.Trace, &trace); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, trace.NamespaceId)
+	}
+	return ids
+}
+
+func TestStoreQuery(t *testing.T) {
+	st := openTestStore(t, time.Hour, 100)
+	start := time.Now().Add(-time.Minute)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+
+	// The namespace identifies the trace in the results
+	put(t, st, at(0), 10, 1, 1, 2)
+	put(t, st, at(1), 20, 2, 1, 3)
+	put(t, st, at(2), 10, 0, 1, 2)
+	put(t, st, at(3), 30, 1, 2, 3)
+	put(t, st, at(4), 10, 0, 4)
+
+	ns10, ns20, ns30 := uint32(10), uint32(20), uint32(30)
+	node1, node3 := uint64(1), uint64(3)
+	tests := []struct {
+		name string
+		q    Query
+		want []uint32
+	}{
+		{"all", Query{}, []uint32{10, 30, 10, 20, 10}},
+		{"limit", Query{Limit: 2}, []uint32{10, 30}},
+		{"namespace", Query{Namespace: &ns10}, []uint32{10, 10, 10}},
+		{"namespace before others in the index", Query{Namespace: &ns20}, []uint32{20}},
+		{"namespace last in the index", Query{Namespace: &ns30}, []uint32{30}},
+		{"node", Query{Namespace: &ns10, Node: &node1}, []uint32{10, 10}},
+		{"node in any namespace", Query{Node: &node3}, []uint32{30, 20}},
+		{"trace ID", Query{TraceID: traceIDPrefix(0, 1)}, []uint32{30, 10}},
+		{"since", Query{Since: at(2)}, []uint32{10, 30, 10}},
+		{"until", Query{Until: at(2)}, []uint32{10, 20, 10}},
+		{"since and until", Query{Namespace: &ns10, Since: at(1), Until: at(3)}, []uint32{10}},
+		{"none", Query{Until: start.Add(-time.Second)}, []uint32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.q.Limit == 0 {
+				tt.q.Limit = defaultQueryLimit
+			}
+			results, err := st.Traces(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := namespaces(t, results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("namespaces %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Received.After(results[i-1].Received) {
+					t.Errorf("results not sorted newest first")
+				}
+			}
+		})
+	}
+
+	paths, err := st.Paths(Query{Namespace: &ns10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || !reflect.DeepEqual(paths[0].Nodes, []uint64{1, 2}) || paths[0].Traces != 2 ||
+		!paths[0].FirstSeen.Equal(at(0)) || !paths[0].LastSeen.Equal(at(2)) {
+		t.Errorf("Paths() = %+v", paths)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	st := openTestStore(t, time.Hour, 3)
+	now := time.Now()
+
+	put(t, st, now.Add(-2*time.Hour), 1, 1, 1)
+	for i := range 4 {
+		put(t, st, now.Add(time.Duration(i-4)*time.Minute), uint32(i+2), uint64(i+2), uint32(i+2))
+	}
+	if err := st.enforceRetention(now); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := st.Traces(Query{Limit: defaultQueryLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The expired trace and the oldest one beyond 3 traces are removed
+	if got, want := namespaces(t, results), []uint32{5, 4, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces %v, want %v", got, want)
+	}
+
+	// So are their index entries
+	err = st.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketNamespace, bucketNode, bucketTraceID} {
+			if n := tx.Bucket(bucket).Stats().KeyN; n != 3 {
+				t.Errorf("%d keys in the %s index, want 3", n, bucket)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreAdd(t *testing.T) {
+	st := openTestStore(t, time.Hour, 100)
+	st.Add(time.Now(), &ioamAPI.IOAMTrace{NamespaceId: 7})
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		results, err := st.Traces(Query{Limit: defaultQueryLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) == 1 {
+			return
+		}
+	}
+	t.Error("queued trace not written")
+}
+
+func TestStoreHandler(t *testing.T) {
+	st := openTestStore(t, time.Hour, 100)
+	put(t, st, time.Now().Add(-time.Minute), 10, 0x0102, 1)
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/api/traces?namespace=10&node=1&since=1h&limit=10", 200},
+		{"/api/traces?trace_id=00000000000000000000000000000102", 200},
+		{"/api/paths?until=" + time.Now().Format(time.RFC3339), 200},
+		{"/api/traces?namespace=x", 400},
+		{"/api/traces?trace_id=01", 400},
+		{"/api/traces?since=yesterday", 400},
+		{"/api/traces?limit=0", 400},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		st.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d", tt.url, w.Code, tt.status)
+		}
+		if tt.status == 200 && !json.Valid(w.Body.Bytes()) {
+			t.Errorf("GET %s: invalid JSON %q", tt.url, w.Body.String())
+		}
+	}
+}
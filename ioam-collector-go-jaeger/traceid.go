@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// Trace ID strategies, used when the agent did not set a valid trace ID
+const (
+	TraceIDAgent  = "agent"  // Agent IDs if valid, random IDs otherwise
+	TraceIDRandom = "random" // Always random IDs, agent IDs are ignored
+	TraceIDFlow   = "flow"   // Agent IDs if valid, IDs derived from the namespace, flow and time bucket otherwise
+)
+
+type traceIDKey struct{}
+
+// withTraceID requests the trace ID of the next root span started with ctx.
+func withTraceID(ctx context.Context, id trace.TraceID) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// IDGenerator generates random IDs, except for the root spans whose trace ID
+// was requested with withTraceID.
+type IDGenerator struct{}
+
+func (IDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	id, _ := ctx.Value(traceIDKey{}).(trace.TraceID)
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id, IDGenerator{}.NewSpanID(ctx, id)
+}
+
+func (IDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	var id trace.SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+// traceContext returns the context of the trace span of a request, at the
+// given start time, according to the trace ID strategy:
+//   - valid agent trace and span IDs: the span is a child of the agent span;
+//   - valid agent trace ID only: the span is a root span of that trace;
+//   - otherwise, the trace ID is random or derived from the flow.
+func (s *Server) traceContext(request *ioamAPI.IOAMTrace, start time.Time) context.Context {
+	ctx := context.Background()
+	if s.cfg.TraceID == TraceIDRandom {
+		return ctx
+	}
+
+	var traceID trace.TraceID
+	binary.BigEndian.PutUint64(traceID[:8], request.GetTraceId_High())
+	binary.BigEndian.PutUint64(traceID[8:], request.GetTraceId_Low())
+
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], request.GetSpanId())
+
+	switch {
+	case traceID.IsValid() && spanID.IsValid():
+		return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}))
+	case traceID.IsValid():
+		return withTraceID(ctx, traceID)
+	case s.cfg.TraceID == TraceIDFlow && request.GetFlow() != nil:
+		return withTraceID(ctx, FlowTraceID(request, start, s.cfg.TraceIDBucket))
+	}
+	return ctx
+}
+
+// FlowTraceID derives a trace ID from the namespace and flow of a request
+// and the time bucket of start, so that the packets of a flow within the
+// same bucket belong to the same trace. The ID is never all zeros, which
+// would be an invalid trace ID.
+func FlowTraceID(request *ioamAPI.IOAMTrace, start time.Time, bucket time.Duration) trace.TraceID {
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint32(nil, request.GetNamespaceId()))
+	for flow := request.GetFlow(); flow != nil; flow = flow.GetInner() {
+		h.Write(flow.GetSrcAddr())
+		h.Write(flow.GetDstAddr())
+		h.Write(binary.BigEndian.AppendUint32(nil, flow.GetNextHeader()))
+		h.Write(binary.BigEndian.AppendUint32(nil, flow.GetSrcPort()))
+		h.Write(binary.BigEndian.AppendUint32(nil, flow.GetDstPort()))
+		h.Write(binary.BigEndian.AppendUint32(nil, flow.GetFlowLabel()))
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(start.UnixNano()/int64(bucket))))
+
+	var id trace.TraceID
+	copy(id[:], h.Sum(nil))
+	if !id.IsValid() {
+		id[len(id)-1] = 1
+	}
+	return id
+}
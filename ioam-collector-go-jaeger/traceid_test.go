@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+func TestFlowTraceID(t *testing.T) {
+	flow := func(srcPort uint32) *ioamAPI.IOAMTrace {
+		return &ioamAPI.IOAMTrace{NamespaceId: 123, Flow: &ioamAPI.Flow{
+			SrcAddr: []byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}, DstAddr: []byte{0x20, 0x01, 0x0d, 0xb8, 15: 2},
+			NextHeader: 6, SrcPort: srcPort, DstPort: 443,
+		}}
+	}
+	start := time.Unix(1_699_999_980, 0) // On a minute boundary
+	id := FlowTraceID(flow(1234), start, time.Minute)
+
+	tests := []struct {
+		name    string
+		request *ioamAPI.IOAMTrace
+		start   time.Time
+		same    bool
+	}{
+		{"same bucket", flow(1234), start.Add(59 * time.Second), true},
+		{"next bucket", flow(1234), start.Add(time.Minute), false},
+		{"other flow", flow(1235), start, false},
+		{"other namespace", &ioamAPI.IOAMTrace{NamespaceId: 124, Flow: flow(1234).Flow}, start, false},
+		{"inner flow", &ioamAPI.IOAMTrace{NamespaceId: 123, Flow: &ioamAPI.Flow{
+			SrcAddr: flow(1234).Flow.SrcAddr, DstAddr: flow(1234).Flow.DstAddr, NextHeader: 6, SrcPort: 1234, DstPort: 443,
+			Inner: &ioamAPI.Flow{NextHeader: 17},
+		}}, start, false},
+	}
+	for _, tt := range tests {
+		got := FlowTraceID(tt.request, tt.start, time.Minute)
+		if !got.IsValid() {
+			t.Errorf("%s: FlowTraceID() = %v, want a valid ID", tt.name, got)
+		}
+		if (got == id) != tt.same {
+			t.Errorf("%s: FlowTraceID() = %v, same as %v: %v, want %v", tt.name, got, id, got == id, tt.same)
+		}
+	}
+
+	// Not even an empty flow in any bucket gives the invalid all-zero ID
+	for i := range 1000 {
+		if got := FlowTraceID(&ioamAPI.IOAMTrace{}, time.Unix(int64(i), 0), time.Second); !got.IsValid() {
+			t.Fatalf("FlowTraceID() = %v at %d", got, i)
+		}
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	agentTrace := trace.TraceID{0x01, 15: 0x02}
+	agentSpan := trace.SpanID{0x03, 7: 0x04}
+	withFlow := &ioamAPI.IOAMTrace{NamespaceId: 123, Flow: &ioamAPI.Flow{NextHeader: 17, SrcPort: 53, DstPort: 5353}}
+	withAgentIDs := &ioamAPI.IOAMTrace{
+		NamespaceId: 123, Flow: withFlow.Flow,
+		TraceId_High: 0x0100000000000000, TraceId_Low: 0x02, SpanId: 0x0300000000000004,
+	}
+	withTraceOnly := &ioamAPI.IOAMTrace{NamespaceId: 123, Flow: withFlow.Flow, TraceId_High: 0x0100000000000000, TraceId_Low: 0x02}
+	start := time.Unix(1_700_000_000, 0)
+	flowID := FlowTraceID(withFlow, start, time.Minute)
+
+	tests := []struct {
+		name     string
+		strategy string
+		request  *ioamAPI.IOAMTrace
+		want     trace.TraceID // Zero if random
+		parent   bool          // Child of the agent span
+	}{
+		{"agent span", TraceIDAgent, withAgentIDs, agentTrace, true},
+		{"agent trace", TraceIDAgent, withTraceOnly, agentTrace, false},
+		{"agent without IDs", TraceIDAgent, withFlow, trace.TraceID{}, false},
+		{"random ignores the agent", TraceIDRandom, withAgentIDs, trace.TraceID{}, false},
+		{"flow keeps the agent span", TraceIDFlow, withAgentIDs, agentTrace, true},
+		{"flow keeps the agent trace", TraceIDFlow, withTraceOnly, agentTrace, false},
+		{"flow", TraceIDFlow, withFlow, flowID, false},
+		{"flow without flow", TraceIDFlow, &ioamAPI.IOAMTrace{NamespaceId: 123}, trace.TraceID{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.TraceID = tt.strategy
+			s := NewServer(cfg, tracetest.NewSpanRecorder(), nil, nil, nil)
+			ctx := s.traceContext(tt.request, start)
+
+			parent := trace.SpanContextFromContext(ctx)
+			if parent.IsValid() != tt.parent {
+				t.Errorf("parent %v, want one: %v", parent, tt.parent)
+			}
+			if tt.parent && (parent.TraceID() != agentTrace || parent.SpanID() != agentSpan) {
+				t.Errorf("parent %v/%v, want %v/%v", parent.TraceID(), parent.SpanID(), agentTrace, agentSpan)
+			}
+			if tt.parent {
+				return
+			}
+
+			id, spanID := IDGenerator{}.NewIDs(ctx)
+			if !id.IsValid() || !spanID.IsValid() {
+				t.Fatalf("NewIDs() = %v, %v, want valid IDs", id, spanID)
+			}
+			if tt.want.IsValid() && id != tt.want {
+				t.Errorf("trace ID %v, want %v", id, tt.want)
+			}
+			if !tt.want.IsValid() {
+				if other, _ := (IDGenerator{}).NewIDs(ctx); other == id {
+					t.Errorf("trace ID %v twice, want random IDs", id)
+				}
+			}
+		})
+	}
+}
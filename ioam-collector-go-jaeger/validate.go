@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+// Reasons why a trace is invalid
+const (
+	InvalidNamespace       = "namespace"        // Namespace not in the allowlist
+	InvalidTooManyNodes    = "too_many_nodes"   // More nodes than allowed
+	InvalidUndefinedBits   = "undefined_bits"   // Undefined or reserved trace type bits set
+	InvalidMissingField    = "missing_field"    // Field announced by the trace type but absent
+	InvalidUnexpectedField = "unexpected_field" // Field set but not announced by the trace type
+	InvalidFieldSize       = "field_size"       // Field value larger than its size on the wire
+)
+
+var invalidReasons = []string{
+	InvalidNamespace,
+	InvalidTooManyNodes,
+	InvalidUndefinedBits,
+	InvalidMissingField,
+	InvalidUnexpectedField,
+	InvalidFieldSize,
+}
+
+// Handling of the invalid traces
+const (
+	InvalidAnnotate = "annotate" // Exported, with the reasons as attributes
+	InvalidDrop     = "drop"     // Discarded
+)
+
+// Validation attributes
+const (
+	AttrInvalid        = attribute.Key("ioam.invalid")
+	AttrInvalidReasons = attribute.Key("ioam.invalid.reasons")
+)
+
+// Validator checks the traces received from the agents and counts the
+// invalid ones per reason.
+type Validator struct {
+	maxNodes   int
+	namespaces map[uint32]bool // All namespaces allowed if empty
+
+	counts map[string]*atomic.Uint64
+}
+
+func NewValidator(cfg *Config) *Validator {
+	v := &Validator{
+		maxNodes:   cfg.MaxNodes,
+		namespaces: make(map[uint32]bool, len(cfg.Namespaces)),
+		counts:     make(map[string]*atomic.Uint64, len(invalidReasons)),
+	}
+	for _, ns := range cfg.Namespaces {
+		v.namespaces[ns] = true
+	}
+	for _, reason := range invalidReasons {
+		v.counts[reason] = &atomic.Uint64{}
+	}
+	return v
+}
+
+// Validate returns the reasons why the trace is invalid, each one at most
+// once, and counts them. The trace is valid if none is returned.
+func (v *Validator) Validate(request *ioamAPI.IOAMTrace) []string {
+	var reasons []string
+	add := func(reason string) {
+		for _, r := range reasons {
+			if r == reason {
+				return
+			}
+		}
+		reasons = append(reasons, reason)
+	}
+
+	if len(v.namespaces) > 0 && !v.namespaces[request.GetNamespaceId()] {
+		add(InvalidNamespace)
+	}
+	if len(request.GetNodes()) > v.maxNodes {
+		add(InvalidTooManyNodes)
+	}
+
+	fields := ioam.TraceType(request.GetBitField())
+	if fields&^ioam.TraceTypeDefined != 0 {
+		add(InvalidUndefinedBits)
+	}
+	for _, node := range request.GetNodes() {
+		for _, reason := range checkNode(node, fields) {
+			add(reason)
+		}
+	}
+
+	for _, reason := range reasons {
+		v.counts[reason].Add(1)
+	}
+	return reasons
+}
+
+// checkNode checks that the fields of a node match the trace type. Integer
+// fields set to zero cannot be told apart from absent ones and are
+// accepted, while the namespace data must be present. The OSS may be
+// absent: nodes without a schema add an empty snapshot, which the agent
+// does not report.
+func checkNode(node *ioamAPI.IOAMNode, fields ioam.TraceType) []string {
+	var reasons []string
+	check := func(bit ioam.TraceType, set bool, fits bool) {
+		if set && fields&bit == 0 {
+			reasons = append(reasons, InvalidUnexpectedField)
+		}
+		if !fits {
+			reasons = append(reasons, InvalidFieldSize)
+		}
+	}
+
+	check(ioam.TraceTypeHopLimitNodeID|ioam.TraceTypeHopLimitNodeIDWide, node.GetHopLimit() != 0, node.GetHopLimit() <= ioam.MaxHopLimit)
+	check(ioam.TraceTypeHopLimitNodeID, node.GetId() != 0, node.GetId() <= ioam.MaxNodeID)
+	check(ioam.TraceTypeInterfaceIDs, node.GetIngressId() != 0, node.GetIngressId() <= 0xFFFF)
+	check(ioam.TraceTypeInterfaceIDs, node.GetEgressId() != 0, node.GetEgressId() <= 0xFFFF)
+	check(ioam.TraceTypeTimestampSecs, node.GetTimestampSecs() != 0, true)
+	check(ioam.TraceTypeTimestampFrac, node.GetTimestampFrac() != 0, true)
+	check(ioam.TraceTypeTransitDelay, node.GetTransitDelay() != 0, true)
+	check(ioam.TraceTypeNamespaceData, len(node.GetNamespaceData()) != 0, len(node.GetNamespaceData()) == 0 || fields&ioam.TraceTypeNamespaceData == 0 || len(node.GetNamespaceData()) == ioam.FieldSize(5))
+	check(ioam.TraceTypeQueueDepth, node.GetQueueDepth() != 0, true)
+	check(ioam.TraceTypeChecksumComplement, node.GetCsumComp() != 0, true)
+	check(ioam.TraceTypeHopLimitNodeIDWide, node.GetIdWide() != 0, node.GetIdWide() <= ioam.MaxNodeIDWide)
+	check(ioam.TraceTypeInterfaceIDsWide, node.GetIngressIdWide() != 0, true)
+	check(ioam.TraceTypeInterfaceIDsWide, node.GetEgressIdWide() != 0, true)
+	check(ioam.TraceTypeNamespaceDataWide, len(node.GetNamespaceDataWide()) != 0, len(node.GetNamespaceDataWide()) == 0 || fields&ioam.TraceTypeNamespaceDataWide == 0 || len(node.GetNamespaceDataWide()) == ioam.FieldSize(10))
+	check(ioam.TraceTypeBufferOccupancy, node.GetBufferOccupancy() != 0, true)
+
+	oss := node.GetOSS()
+	check(ioam.TraceTypeOSS, oss != nil, oss.GetSchemaId() <= ioam.MaxSchemaID && len(oss.GetData())%4 == 0)
+
+	missing := fields&ioam.TraceTypeNamespaceData != 0 && len(node.GetNamespaceData()) == 0 ||
+		fields&ioam.TraceTypeNamespaceDataWide != 0 && len(node.GetNamespaceDataWide()) == 0
+	if missing {
+		reasons = append(reasons, InvalidMissingField)
+	}
+
+	return reasons
+}
+
+// Counts returns the number of invalid traces per reason.
+func (v *Validator) Counts() map[string]uint64 {
+	counts := make(map[string]uint64, len(v.counts))
+	for reason, count := range v.counts {
+		counts[reason] = count.Load()
+	}
+	return counts
+}
+
+// ServeHTTP returns the number of invalid traces per reason in JSON.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v.Counts())
+}
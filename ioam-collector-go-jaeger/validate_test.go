@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/Advanced-Observability/ioam-agent/pkg/ioam"
+	ioamAPI "ioam-collector/github.com/Advanced-Observability/ioam-api"
+)
+
+func validTrace() *ioamAPI.IOAMTrace {
+	return &ioamAPI.IOAMTrace{
+		NamespaceId: 123,
+		BitField:    uint32(ioam.TraceTypeHopLimitNodeID | ioam.TraceTypeInterfaceIDs | ioam.TraceTypeNamespaceData),
+		Nodes: []*ioamAPI.IOAMNode{
+			{HopLimit: 64, Id: 1, IngressId: 1, EgressId: 2, NamespaceData: []byte{0, 0, 0, 1}},
+			{HopLimit: 63, Id: 2, IngressId: 3, EgressId: 4, NamespaceData: []byte{0, 0, 0, 2}},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ioamAPI.IOAMTrace)
+		want   []string
+	}{
+		{"valid", func(*ioamAPI.IOAMTrace) {}, nil},
+		{"namespace", func(tr *ioamAPI.IOAMTrace) { tr.NamespaceId = 7 }, []string{InvalidNamespace}},
+		{"too many nodes", func(tr *ioamAPI.IOAMTrace) {
+			tr.Nodes = append(tr.Nodes, tr.Nodes[0], tr.Nodes[1])
+		}, []string{InvalidTooManyNodes}},
+		{"undefined bits", func(tr *ioamAPI.IOAMTrace) { tr.BitField |= uint32(ioam.Bit(15)) }, []string{InvalidUndefinedBits}},
+		{"OSS of a single node", func(tr *ioamAPI.IOAMTrace) {
+			tr.BitField |= uint32(ioam.TraceTypeOSS)
+			tr.Nodes[0].OSS = &ioamAPI.Opaque{SchemaId: 7, Data: []byte{1, 2, 3, 4}}
+		}, nil},
+		{"OSS size", func(tr *ioamAPI.IOAMTrace) {
+			tr.BitField |= uint32(ioam.TraceTypeOSS)
+			tr.Nodes[0].OSS = &ioamAPI.Opaque{SchemaId: 7, Data: []byte{1}}
+		}, []string{InvalidFieldSize}},
+		{"unexpected field", func(tr *ioamAPI.IOAMTrace) { tr.Nodes[1].QueueDepth = 10 }, []string{InvalidUnexpectedField}},
+		{"unexpected OSS", func(tr *ioamAPI.IOAMTrace) {
+			tr.Nodes[0].OSS = &ioamAPI.Opaque{SchemaId: 1}
+		}, []string{InvalidUnexpectedField}},
+		{"namespace data size", func(tr *ioamAPI.IOAMTrace) { tr.Nodes[0].NamespaceData = []byte{1} }, []string{InvalidFieldSize}},
+		{"missing namespace data", func(tr *ioamAPI.IOAMTrace) { tr.Nodes[1].NamespaceData = nil }, []string{InvalidMissingField}},
+		{"missing wide namespace data", func(tr *ioamAPI.IOAMTrace) {
+			tr.BitField |= uint32(ioam.TraceTypeNamespaceDataWide)
+			tr.Nodes[0].NamespaceDataWide = make([]byte, 8)
+		}, []string{InvalidMissingField}},
+		{"node ID size", func(tr *ioamAPI.IOAMTrace) { tr.Nodes[0].Id = 1 << 24 }, []string{InvalidFieldSize}},
+		{"several reasons", func(tr *ioamAPI.IOAMTrace) {
+			tr.NamespaceId = 7
+			tr.Nodes[0].Id = 1 << 24
+			tr.Nodes[1].Id = 1 << 24
+		}, []string{InvalidNamespace, InvalidFieldSize}},
+	}
+
+	cfg := defaultConfig()
+	cfg.MaxNodes = 3
+	cfg.Namespaces = []uint32{123}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValidator(cfg)
+			trace := validTrace()
+			tt.modify(trace)
+
+			got := v.Validate(trace)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", got, tt.want)
+			}
+			for _, reason := range invalidReasons {
+				want := uint64(0)
+				for _, r := range tt.want {
+					if r == reason {
+						want = 1
+					}
+				}
+				if count := v.Counts()[reason]; count != want {
+					t.Errorf("count of %s = %d, want %d", reason, count, want)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateGolden checks that the traces of the agent on the golden
+// corpus, captured from the kernel, are valid.
+func TestValidateGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "internal", "parser", "testdata", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("golden files: %v, error %v", files, err)
+	}
+	v := NewValidator(defaultConfig())
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []json.RawMessage
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			t.Fatal(err)
+		}
+		for i, msg := range msgs {
+			var trace ioamAPI.IOAMTrace
+			if err := protojson.Unmarshal(msg, &trace); err != nil {
+				t.Fatalf("%s: trace %d: %v", file, i, err)
+			}
+			if reasons := v.Validate(&trace); reasons != nil {
+				t.Errorf("%s: trace %d invalid: %v", filepath.Base(file), i, reasons)
+			}
+		}
+	}
+}
+
+// startServer serves the collector over an in-memory connection and returns
+// a client, the server and the recorder of the exported spans.
+func startServer(t *testing.T, cfg *Config) (ioamAPI.IOAMServiceClient, *Server, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	server := NewServer(cfg, recorder, nil, nil, nil)
+	ioamAPI.RegisterIOAMServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return ioamAPI.NewIOAMServiceClient(conn), server, recorder
+}
+
+// report streams the traces to the collector and waits until they are
+// processed.
+func report(t *testing.T, client ioamAPI.IOAMServiceClient, traces ...*ioamAPI.IOAMTrace) {
+	t.Helper()
+
+	stream, err := client.Report(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trace := range traces {
+		if err := stream.Send(trace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// traceSpans returns the trace-level spans among the recorded ones.
+func traceSpans(recorder *tracetest.SpanRecorder) []tracesdk.ReadOnlySpan {
+	var spans []tracesdk.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "ioam-span" {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func invalidAttribute(span tracesdk.ReadOnlySpan) []string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == AttrInvalidReasons {
+			return attr.Value.AsStringSlice()
+		}
+	}
+	return nil
+}
+
+func TestReportAnnotate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Namespaces = []uint32{123}
+	client, server, recorder := startServer(t, cfg)
+
+	invalid := validTrace()
+	invalid.NamespaceId = 7
+	report(t, client, validTrace(), invalid)
+
+	spans := traceSpans(recorder)
+	if len(spans) != 2 {
+		t.Fatalf("%d trace spans, want 2", len(spans))
+	}
+	if reasons := invalidAttribute(spans[0]); reasons != nil {
+		t.Errorf("valid trace annotated with %v", reasons)
+	}
+	if reasons := invalidAttribute(spans[1]); !reflect.DeepEqual(reasons, []string{InvalidNamespace}) {
+		t.Errorf("invalid trace annotated with %v, want [%s]", reasons, InvalidNamespace)
+	}
+	if count := server.validator.Counts()[InvalidNamespace]; count != 1 {
+		t.Errorf("count of %s = %d, want 1", InvalidNamespace, count)
+	}
+}
+
+func TestReportDrop(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Invalid = InvalidDrop
+	client, server, recorder := startServer(t, cfg)
+
+	invalid := validTrace()
+	invalid.Nodes[1].NamespaceData = nil
+	report(t, client, invalid, validTrace(), invalid)
+
+	spans := traceSpans(recorder)
+	if len(spans) != 1 {
+		t.Fatalf("%d trace spans, want 1", len(spans))
+	}
+	if reasons := invalidAttribute(spans[0]); reasons != nil {
+		t.Errorf("valid trace annotated with %v", reasons)
+	}
+	if count := server.validator.Counts()[InvalidMissingField]; count != 2 {
+		t.Errorf("count of %s = %d, want 2", InvalidMissingField, count)
+	}
+}
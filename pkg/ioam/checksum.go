@@ -0,0 +1,47 @@
+package ioam
+
+import "encoding/binary"
+
+// Checksum adds the 16-bit words of b to a one's complement sum (RFC 1071),
+// an odd last octet being padded with zero, and returns the folded sum.
+func Checksum(sum uint16, b []byte) uint16 {
+	s := uint64(sum)
+	for len(b) >= 2 {
+		s += uint64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		s += uint64(b[0]) << 8
+	}
+	for s > 0xFFFF {
+		s = s>>16 + s&0xFFFF
+	}
+	return uint16(s)
+}
+
+// ChecksumNeutral reports whether a one's complement sum is zero (0x0000 or
+// 0xFFFF), i.e. whether the summed data leave a checksum unchanged.
+func ChecksumNeutral(sum uint16) bool {
+	return sum == 0 || sum == 0xFFFF
+}
+
+// ChecksumMismatch reports whether a decoded node set its Checksum
+// Complement (RFC 9197 section 4.4.2.9) but its data, OSS included, are not
+// checksum-neutral, i.e. the node changed the upper-layer checksum. A node
+// with a zero Checksum Complement is expected to update the checksum
+// itself, and never mismatches.
+func (n *Node) ChecksumMismatch() bool {
+	return n.ChecksumComplement>>16 != 0 && !ChecksumNeutral(n.Checksum)
+}
+
+// SetChecksumComplement sets the Checksum Complement of the node, the first
+// two octets of the field, so that its data for the trace type, OSS
+// included, are checksum-neutral.
+func (n *Node) SetChecksumComplement(traceType TraceType) {
+	n.ChecksumComplement &= 0xFFFF
+	b := AppendNode(nil, n, traceType)
+	if traceType&TraceTypeOSS != 0 {
+		b = appendOSS(b, n.OSS)
+	}
+	n.ChecksumComplement |= uint32(^Checksum(0, b)) << 16
+}
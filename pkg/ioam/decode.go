@@ -0,0 +1,244 @@
+package ioam
+
+import (
+	"encoding/binary"
+)
+
+// Option is an IOAM option found in an IPv6 extension header.
+type Option struct {
+	Type OptionType
+	Data []byte // After the 4-octet IOAM option header
+}
+
+// Options returns the IOAM options of an IPv6 Hop-by-Hop or Destination
+// Options header, starting with the Next Header field. If the header is
+// malformed, the options found before the error are returned with it.
+func Options(header []byte) ([]Option, error) {
+	return AppendOptions(nil, header)
+}
+
+// AppendOptions appends the IOAM options of the header to options, like
+// Options.
+func AppendOptions(options []Option, header []byte) ([]Option, error) {
+	if len(header) < 8 {
+		return options, decodeError(ErrHeaderLength, 0)
+	}
+	hdrLen := (int(header[1]) + 1) * 8
+	if hdrLen > len(header) {
+		return options, decodeError(ErrHeaderLength, 1)
+	}
+
+	for offset := 2; offset < hdrLen; {
+		if header[offset] == 0 { // Pad1
+			offset++
+			continue
+		}
+		if offset+2 > hdrLen {
+			return options, decodeError(ErrOptionLength, offset)
+		}
+		optType := header[offset]
+		end := offset + 2 + int(header[offset+1])
+		if end > hdrLen {
+			return options, decodeError(ErrOptionLength, offset+1)
+		}
+		if optType == IPv6OptionHopByHop || optType == IPv6OptionDestination {
+			if end-offset < 4 {
+				return options, decodeError(ErrOptionLength, offset+1)
+			}
+			options = append(options, Option{
+				Type: OptionType(header[offset+3]),
+				Data: header[offset+4 : end],
+			})
+		}
+		offset = end
+	}
+
+	return options, nil
+}
+
+// DecodeTrace decodes the data of a pre-allocated or incremental trace
+// option, starting with the trace option header. The option is validated
+// against RFC 9197: the remaining length must be within the option, the
+// node length must match the trace type and the node data must be made of
+// complete nodes.
+func DecodeTrace(data []byte) (*Trace, error) {
+	trace := &Trace{}
+	if _, err := trace.decode(data, false); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// DecodeTraceLenient decodes a trace option like DecodeTrace, but salvages
+// what can be: the nodes are decoded with the announced node length if it
+// is larger than required by the trace type, and the complete nodes before
+// malformed node data are kept. The trace is returned with the error, or
+// nil if no node can be located.
+func DecodeTraceLenient(data []byte) (*Trace, error) {
+	trace := &Trace{}
+	located, err := trace.decode(data, true)
+	if !located {
+		return nil, err
+	}
+	return trace, err
+}
+
+// Decode decodes a trace option into t like DecodeTrace, or like
+// DecodeTraceLenient if lenient, reusing the Nodes of t and their OSS to
+// avoid allocations. On error, t holds the salvaged nodes in lenient mode
+// and is undefined in strict mode.
+func (t *Trace) Decode(data []byte, lenient bool) error {
+	_, err := t.decode(data, lenient)
+	return err
+}
+
+// decode reports whether the nodes could be located, even if some of them
+// are malformed.
+func (t *Trace) decode(data []byte, lenient bool) (bool, error) {
+	t.Nodes = t.Nodes[:0]
+	if len(data) < 8 || len(data)%4 != 0 {
+		return false, decodeError(ErrOptionLength, 0)
+	}
+
+	t.Namespace = binary.BigEndian.Uint16(data[:2])
+	t.Flags = Flags((data[2]&0x07)<<1 | data[3]>>7)
+	t.RemLen = data[3] & 0x7F
+	t.Type = TraceType(binary.BigEndian.Uint32(data[4:8]) >> 8)
+	nodeLen := int(data[2]>>3) * 4
+	offset := 8 + int(t.RemLen)*4
+
+	if offset > len(data) {
+		return false, decodeError(ErrRemainingLength, 3)
+	}
+
+	// Salvaged nodes are returned with the first error
+	var err error
+	if nodeLen != t.Type.NodeLen()*4 {
+		err = decodeError(ErrNodeLength, 2)
+		if !lenient || nodeLen < t.Type.NodeLen()*4 {
+			return lenient, err
+		}
+	}
+	if nodeLen == 0 && t.Type&TraceTypeOSS == 0 && offset < len(data) {
+		return false, decodeError(ErrNodeData, offset)
+	}
+
+	for offset < len(data) {
+		if offset+nodeLen > len(data) {
+			if err == nil {
+				err = decodeError(ErrNodeData, offset)
+			}
+			break
+		}
+
+		start := offset
+
+		// Keep the OSS of a previous decoding to fill it again
+		var oss *OSS
+		if len(t.Nodes) < cap(t.Nodes) {
+			oss = t.Nodes[:len(t.Nodes)+1][len(t.Nodes)].OSS
+		}
+		node, _ := DecodeNode(data[offset:offset+nodeLen], t.Type)
+
+		if t.Type&TraceTypeOSS != 0 {
+			ossOffset := offset + nodeLen
+			if len(data)-ossOffset < 4 || len(data)-ossOffset < 4+int(data[ossOffset])*4 {
+				if err == nil {
+					err = decodeError(ErrOSSLength, ossOffset)
+				}
+				break
+			}
+			ossLen := int(data[ossOffset]) * 4
+			if ossLen > 0 {
+				if oss == nil {
+					oss = &OSS{}
+				}
+				oss.SchemaID = binary.BigEndian.Uint32(data[ossOffset:ossOffset+4]) & MaxSchemaID
+				oss.Data = data[ossOffset+4 : ossOffset+4+ossLen]
+				node.OSS = oss
+			}
+			offset = ossOffset + 4 + ossLen
+		} else {
+			offset += nodeLen
+		}
+		if t.Type&TraceTypeChecksumComplement != 0 {
+			node.Checksum = Checksum(0, data[start:offset])
+		}
+
+		t.Nodes = append(t.Nodes, node)
+	}
+	if err != nil && !lenient {
+		return false, err
+	}
+
+	// The last node inserted its data first
+	for i, j := 0, len(t.Nodes)-1; i < j; i, j = i+1, j-1 {
+		t.Nodes[i], t.Nodes[j] = t.Nodes[j], t.Nodes[i]
+	}
+
+	return true, err
+}
+
+// DecodeNode decodes the data of a node (excluding the OSS) for the trace
+// type. Namespace data fields refer to data.
+func DecodeNode(data []byte, traceType TraceType) (Node, error) {
+	var node Node
+	if len(data) < traceType.NodeLen()*4 {
+		return node, decodeError(ErrNodeLength, 0)
+	}
+	offset := 0
+
+	if traceType&TraceTypeHopLimitNodeID != 0 {
+		node.HopLimit = data[offset]
+		node.ID = binary.BigEndian.Uint32(data[offset:offset+4]) & MaxNodeID
+		offset += 4
+	}
+	if traceType&TraceTypeInterfaceIDs != 0 {
+		node.IngressID = binary.BigEndian.Uint16(data[offset : offset+2])
+		node.EgressID = binary.BigEndian.Uint16(data[offset+2 : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeTimestampSecs != 0 {
+		node.TimestampSecs = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeTimestampFrac != 0 {
+		node.TimestampFrac = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeTransitDelay != 0 {
+		node.TransitDelay = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeNamespaceData != 0 {
+		node.NamespaceData = data[offset : offset+4]
+		offset += 4
+	}
+	if traceType&TraceTypeQueueDepth != 0 {
+		node.QueueDepth = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeChecksumComplement != 0 {
+		node.ChecksumComplement = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TraceTypeHopLimitNodeIDWide != 0 {
+		node.HopLimit = data[offset]
+		node.IDWide = binary.BigEndian.Uint64(data[offset:offset+8]) & MaxNodeIDWide
+		offset += 8
+	}
+	if traceType&TraceTypeInterfaceIDsWide != 0 {
+		node.IngressIDWide = binary.BigEndian.Uint32(data[offset : offset+4])
+		node.EgressIDWide = binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		offset += 8
+	}
+	if traceType&TraceTypeNamespaceDataWide != 0 {
+		node.NamespaceDataWide = data[offset : offset+8]
+		offset += 8
+	}
+	if traceType&TraceTypeBufferOccupancy != 0 {
+		node.BufferOccupancy = binary.BigEndian.Uint32(data[offset : offset+4])
+	}
+
+	return node, nil
+}
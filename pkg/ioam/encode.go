@@ -0,0 +1,114 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// AppendOption appends an IPv6 option (IPv6OptionHopByHop or
+// IPv6OptionDestination) carrying an IOAM option of the given type.
+func AppendOption(b []byte, ipv6Type uint8, optType OptionType, data []byte) ([]byte, error) {
+	if len(data)+2 > 0xFF {
+		return nil, errors.New("ioam: option too long")
+	}
+	b = append(b, ipv6Type, uint8(len(data)+2), 0, uint8(optType))
+	return append(b, data...), nil
+}
+
+// AppendTrace appends the data of a pre-allocated or incremental trace
+// option: the trace option header, the free space (RemLen) and the nodes,
+// last node first.
+func AppendTrace(b []byte, trace *Trace) ([]byte, error) {
+	nodeLen := trace.Type.NodeLen()
+	if nodeLen > MaxNodeLen {
+		return nil, errors.New("ioam: node length too large")
+	}
+	if trace.RemLen > MaxRemLen {
+		return nil, errors.New("ioam: remaining length too large")
+	}
+
+	b = binary.BigEndian.AppendUint16(b, trace.Namespace)
+	b = append(b,
+		uint8(nodeLen)<<3|uint8(trace.Flags>>1)&0x07,
+		uint8(trace.Flags&1)<<7|trace.RemLen)
+	b = binary.BigEndian.AppendUint32(b, uint32(trace.Type&0xFFFFFF)<<8)
+	b = append(b, make([]byte, int(trace.RemLen)*4)...)
+
+	for i := len(trace.Nodes) - 1; i >= 0; i-- {
+		node := &trace.Nodes[i]
+		b = AppendNode(b, node, trace.Type)
+
+		if trace.Type&TraceTypeOSS != 0 {
+			if node.OSS != nil && (len(node.OSS.Data)%4 != 0 || len(node.OSS.Data) > 0xFF*4) {
+				return nil, errors.New("ioam: invalid opaque state snapshot length")
+			}
+			b = appendOSS(b, node.OSS)
+		}
+	}
+
+	return b, nil
+}
+
+// appendOSS appends an opaque state snapshot of a valid length, or an empty
+// one if oss is nil.
+func appendOSS(b []byte, oss *OSS) []byte {
+	if oss == nil {
+		return append(b, 0, 0, 0, 0)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(oss.Data)/4)<<24|oss.SchemaID&MaxSchemaID)
+	return append(b, oss.Data...)
+}
+
+// AppendNode appends the data of a node (excluding the OSS) for the trace
+// type. Namespace data fields are truncated or zero-padded to their size,
+// undefined fields are filled with 0xFFFFFFFF.
+func AppendNode(b []byte, node *Node, traceType TraceType) []byte {
+	if traceType&TraceTypeHopLimitNodeID != 0 {
+		b = binary.BigEndian.AppendUint32(b, uint32(node.HopLimit)<<24|node.ID&MaxNodeID)
+	}
+	if traceType&TraceTypeInterfaceIDs != 0 {
+		b = binary.BigEndian.AppendUint16(b, node.IngressID)
+		b = binary.BigEndian.AppendUint16(b, node.EgressID)
+	}
+	if traceType&TraceTypeTimestampSecs != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.TimestampSecs)
+	}
+	if traceType&TraceTypeTimestampFrac != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.TimestampFrac)
+	}
+	if traceType&TraceTypeTransitDelay != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.TransitDelay)
+	}
+	if traceType&TraceTypeNamespaceData != 0 {
+		b = appendFixed(b, node.NamespaceData, 4)
+	}
+	if traceType&TraceTypeQueueDepth != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.QueueDepth)
+	}
+	if traceType&TraceTypeChecksumComplement != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.ChecksumComplement)
+	}
+	if traceType&TraceTypeHopLimitNodeIDWide != 0 {
+		b = binary.BigEndian.AppendUint64(b, uint64(node.HopLimit)<<56|node.IDWide&MaxNodeIDWide)
+	}
+	if traceType&TraceTypeInterfaceIDsWide != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.IngressIDWide)
+		b = binary.BigEndian.AppendUint32(b, node.EgressIDWide)
+	}
+	if traceType&TraceTypeNamespaceDataWide != 0 {
+		b = appendFixed(b, node.NamespaceDataWide, 8)
+	}
+	if traceType&TraceTypeBufferOccupancy != 0 {
+		b = binary.BigEndian.AppendUint32(b, node.BufferOccupancy)
+	}
+	for u := traceType & TraceTypeUndefined; u != 0; u &= u - 1 {
+		b = append(b, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+	return b
+}
+
+func appendFixed(b, data []byte, size int) []byte {
+	field := make([]byte, size)
+	copy(field, data)
+	return append(b, field...)
+}
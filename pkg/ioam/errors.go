@@ -0,0 +1,35 @@
+package ioam
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported when decoding malformed IOAM data, always wrapped in a
+// *DecodeError. Use errors.Is to check for them.
+var (
+	ErrHeaderLength    = errors.New("ioam: invalid extension header length")
+	ErrOptionLength    = errors.New("ioam: invalid option length")
+	ErrRemainingLength = errors.New("ioam: remaining length beyond option")
+	ErrNodeLength      = errors.New("ioam: node length does not match trace type")
+	ErrNodeData        = errors.New("ioam: node data does not match node length")
+	ErrOSSLength       = errors.New("ioam: invalid opaque state snapshot length")
+)
+
+// DecodeError is a decoding error of malformed IOAM data.
+type DecodeError struct {
+	Err    error // One of the Err values
+	Offset int   // Offset of the malformed field in the decoded data
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v (offset %d)", e.Err, e.Offset)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func decodeError(err error, offset int) *DecodeError {
+	return &DecodeError{Err: err, Offset: offset}
+}
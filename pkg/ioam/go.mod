@@ -0,0 +1,3 @@
+module github.com/Advanced-Observability/ioam-agent/pkg/ioam
+
+go 1.25.6
@@ -0,0 +1,130 @@
+// Package inventory maps the IOAM node and interface IDs of every namespace
+// to names, read from a JSON file that is reloaded when it changes:
+//
+//	{
+//	  "namespaces": {
+//	    "123": {
+//	      "nodes": {
+//	        "1": {
+//	          "hostname": "r1", "site": "paris", "role": "edge",
+//	          "interfaces": { "1": "eth0", "2": "eth1" }
+//	        }
+//	      }
+//	    }
+//	  }
+//	}
+//
+// Node IDs are the short or wide node IDs, and interface IDs the short or
+// wide interface IDs, as found in the traces.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Node describes an IOAM node.
+type Node struct {
+	Hostname   string            `json:"hostname"`
+	Site       string            `json:"site"`
+	Role       string            `json:"role"`
+	Interfaces map[uint32]string `json:"interfaces"` // Interface ID -> name
+}
+
+// Namespace holds the nodes of an IOAM namespace.
+type Namespace struct {
+	Nodes map[uint64]*Node `json:"nodes"`
+}
+
+// Inventory is the content of an inventory file.
+type Inventory struct {
+	Namespaces map[uint32]*Namespace `json:"namespaces"`
+}
+
+// Load reads an inventory file.
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{}
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return inv, nil
+}
+
+// Node returns the node of a namespace, nil if it is not in the inventory.
+// The inventory may be nil.
+func (inv *Inventory) Node(ns uint32, id uint64) *Node {
+	if inv == nil || inv.Namespaces[ns] == nil {
+		return nil
+	}
+	return inv.Namespaces[ns].Nodes[id]
+}
+
+// Interface returns the name of an interface of the node, "" if unknown.
+// The node may be nil.
+func (n *Node) Interface(id uint32) string {
+	if n == nil {
+		return ""
+	}
+	return n.Interfaces[id]
+}
+
+// Watcher holds the inventory of a file, reloaded when the modification
+// time of the file changes.
+type Watcher struct {
+	path    string
+	modTime time.Time
+	current atomic.Pointer[Inventory]
+}
+
+// Watch loads the inventory file and checks it for changes every interval
+// (never if 0). A file that cannot be reloaded is reported to logf, and the
+// previous inventory kept.
+func Watch(path string, interval time.Duration, logf func(format string, v ...any)) (*Watcher, error) {
+	w := &Watcher{path: path}
+	if _, err := w.reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				reloaded, err := w.reload()
+				if err != nil {
+					logf("Cannot reload inventory: %v", err)
+				} else if reloaded {
+					logf("Reloaded inventory %s", w.path)
+				}
+			}
+		}()
+	}
+	return w, nil
+}
+
+// reload loads the file if it changed, and reports whether it did.
+func (w *Watcher) reload() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+	if w.current.Load() != nil && info.ModTime().Equal(w.modTime) {
+		return false, nil
+	}
+	inv, err := Load(w.path)
+	if err != nil {
+		return false, err
+	}
+	w.modTime = info.ModTime()
+	w.current.Store(inv)
+	return true, nil
+}
+
+// Inventory returns the current inventory.
+func (w *Watcher) Inventory() *Inventory {
+	return w.current.Load()
+}
@@ -0,0 +1,183 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInventory = `{
+  "namespaces": {
+    "123": {
+      "nodes": {
+        "1": {
+          "hostname": "r1", "site": "paris", "role": "edge",
+          "interfaces": { "1": "eth0", "2": "eth1" }
+        },
+        "18446744073709551615": { "hostname": "wide" }
+      }
+    },
+    "124": {
+      "nodes": { "1": { "hostname": "other" } }
+    }
+  }
+}`
+
+func writeInventory(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	writeInventory(t, path, testInventory, time.Now())
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ns       uint32
+		id       uint64
+		iface    uint32
+		hostname string // "" if not in the inventory
+		want     string // Interface name
+	}{
+		{"node", 123, 1, 1, "r1", "eth0"},
+		{"other interface", 123, 1, 2, "r1", "eth1"},
+		{"unknown interface", 123, 1, 3, "r1", ""},
+		{"wide ID", 123, 1<<64 - 1, 1, "wide", ""},
+		{"same ID in another namespace", 124, 1, 1, "other", ""},
+		{"unknown node", 123, 2, 1, "", ""},
+		{"unknown namespace", 125, 1, 1, "", ""},
+	}
+	for _, tt := range tests {
+		n := inv.Node(tt.ns, tt.id)
+		if got := n.Interface(tt.iface); got != tt.want {
+			t.Errorf("%s: Interface() = %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.hostname == "" {
+			if n != nil {
+				t.Errorf("%s: Node() = %+v, want nil", tt.name, n)
+			}
+			continue
+		}
+		if n == nil || n.Hostname != tt.hostname {
+			t.Errorf("%s: Node() = %+v, want %s", tt.name, n, tt.hostname)
+		}
+	}
+	if n := inv.Node(123, 1); n.Site != "paris" || n.Role != "edge" {
+		t.Errorf("Node() = %+v, want the site and role", n)
+	}
+	if n := (*Inventory)(nil).Node(123, 1); n != nil {
+		t.Errorf("Node() of a nil inventory = %+v", n)
+	}
+
+	for _, content := range []string{`{"namespaces": {"x": {}}}`, `{"namespaces": `, `{"namespaces": {"1": {"nodes": {"1": {"interfaces": {"-1": "eth0"}}}}}}`} {
+		writeInventory(t, path, content, time.Now())
+		if _, err := Load(path); err == nil || !strings.HasPrefix(err.Error(), path) {
+			t.Errorf("Load(%s) error %v, want one naming the file", content, err)
+		}
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeInventory(t, path, testInventory, modTime)
+
+	var logs []string
+	logf := func(format string, v ...any) { logs = append(logs, fmt.Sprintf(format, v...)) }
+	if _, err := Watch(filepath.Join(t.TempDir(), "missing.json"), 0, logf); err == nil {
+		t.Error("missing file watched")
+	}
+	w, err := Watch(path, 0, logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := w.Inventory()
+	if first.Node(123, 1).Hostname != "r1" {
+		t.Fatalf("inventory %+v", first)
+	}
+
+	// Unchanged file
+	if reloaded, err := w.reload(); reloaded || err != nil {
+		t.Errorf("reload() = %v, %v, want false without error", reloaded, err)
+	}
+	if w.Inventory() != first {
+		t.Error("unchanged file reloaded")
+	}
+
+	// Changed file
+	modTime = modTime.Add(time.Minute)
+	writeInventory(t, path, `{"namespaces": {"123": {"nodes": {"1": {"hostname": "r1-new"}}}}}`, modTime)
+	if reloaded, err := w.reload(); !reloaded || err != nil {
+		t.Errorf("reload() = %v, %v, want true without error", reloaded, err)
+	}
+	second := w.Inventory()
+	if second.Node(123, 1).Hostname != "r1-new" {
+		t.Errorf("reloaded inventory %+v", second)
+	}
+
+	// A bad file keeps the previous inventory, until fixed
+	writeInventory(t, path, `{"namespaces": `, modTime.Add(time.Minute))
+	if reloaded, err := w.reload(); reloaded || err == nil {
+		t.Errorf("reload() = %v, %v, want false with an error", reloaded, err)
+	}
+	if w.Inventory() != second {
+		t.Error("bad file replaced the inventory")
+	}
+	writeInventory(t, path, testInventory, modTime.Add(time.Minute))
+	if reloaded, err := w.reload(); !reloaded || err != nil {
+		t.Errorf("reload() = %v, %v, want true once fixed", reloaded, err)
+	}
+	if w.Inventory().Node(123, 1).Hostname != "r1" {
+		t.Errorf("fixed inventory %+v", w.Inventory())
+	}
+	if len(logs) != 0 {
+		t.Errorf("logs %q without a reload interval", logs)
+	}
+}
+
+func TestWatcherInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeInventory(t, path, testInventory, modTime)
+
+	logs := make(chan string, 16)
+	logf := func(format string, v ...any) {
+		select {
+		case logs <- fmt.Sprintf(format, v...):
+		default:
+		}
+	}
+	w, err := Watch(path, time.Millisecond, logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeInventory(t, path, `{"namespaces": {"123": {"nodes": {"1": {"hostname": "r1-new"}}}}}`, modTime.Add(time.Minute))
+
+	select {
+	case msg := <-logs:
+		if msg != "Reloaded inventory "+path {
+			t.Errorf("log %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("inventory not reloaded")
+	}
+	if w.Inventory().Node(123, 1).Hostname != "r1-new" {
+		t.Errorf("reloaded inventory %+v", w.Inventory())
+	}
+}
@@ -0,0 +1,162 @@
+// Package ioam defines the In-situ OAM data types (RFC 9197, RFC 9322,
+// RFC 9326, RFC 9486) and decodes and encodes IOAM trace options carried
+// in IPv6 extension headers.
+//
+// The trace type is always handled as the 24-bit IOAM-Trace-Type field of
+// the trace option header, bit 0 being the most significant one.
+package ioam
+
+// IPv6 option types of the IOAM options (RFC 9486)
+const (
+	IPv6OptionHopByHop    = 0x31 // In a Hop-by-Hop Options header
+	IPv6OptionDestination = 0x11 // In a Destination Options header
+)
+
+// OptionType is the IOAM option type (RFC 9197 section 4.1, RFC 9326).
+type OptionType uint8
+
+const (
+	OptionPreallocatedTrace OptionType = 0
+	OptionIncrementalTrace  OptionType = 1
+	OptionPOT               OptionType = 2 // Proof of Transit
+	OptionE2E               OptionType = 3 // Edge-to-Edge
+	OptionDEX               OptionType = 4 // Direct Export
+)
+
+// Flags are the 4-bit flags of a trace option header.
+type Flags uint8
+
+const (
+	FlagOverflow Flags = 1 << 3 // RFC 9197
+	FlagLoopback Flags = 1 << 2 // RFC 9322
+	FlagActive   Flags = 1 << 1 // RFC 9322
+)
+
+// TraceType is the 24-bit IOAM-Trace-Type of a trace option.
+type TraceType uint32
+
+// Trace type bits
+const (
+	TraceTypeHopLimitNodeID     TraceType = 1 << (23 - iota) // Bit 0
+	TraceTypeInterfaceIDs                                    // Bit 1
+	TraceTypeTimestampSecs                                   // Bit 2
+	TraceTypeTimestampFrac                                   // Bit 3
+	TraceTypeTransitDelay                                    // Bit 4
+	TraceTypeNamespaceData                                   // Bit 5
+	TraceTypeQueueDepth                                      // Bit 6
+	TraceTypeChecksumComplement                              // Bit 7
+	TraceTypeHopLimitNodeIDWide                              // Bit 8
+	TraceTypeInterfaceIDsWide                                // Bit 9
+	TraceTypeNamespaceDataWide                               // Bit 10
+	TraceTypeBufferOccupancy                                 // Bit 11
+
+	TraceTypeOSS TraceType = 1 << 1 // Bit 22, Opaque State Snapshot (variable length)
+
+	// Bits defined by RFC 9197, the others are undefined (12-21) or
+	// reserved (23)
+	TraceTypeDefined TraceType = 0xFFF000 | TraceTypeOSS
+
+	// Undefined bits, whose data fields are 4 octets long and filled with
+	// 0xFFFFFFFF (RFC 9197 section 4.4.1)
+	TraceTypeUndefined TraceType = 0x000FFC
+)
+
+// Bit returns the mask of bit n of the trace type.
+func Bit(n int) TraceType {
+	return 1 << (23 - n)
+}
+
+// Has reports whether all the given bits are set.
+func (t TraceType) Has(bits TraceType) bool {
+	return t&bits == bits
+}
+
+// fieldSizes are the sizes in octets of the data fields of bits 0 to 11.
+var fieldSizes = [12]int{4, 4, 4, 4, 4, 4, 4, 4, 8, 8, 8, 4}
+
+// FieldSize returns the size in octets of the data field of bit n, or 0 if
+// the bit is undefined or its field has a variable length (OSS).
+func FieldSize(n int) int {
+	if n < 0 || n >= len(fieldSizes) {
+		return 0
+	}
+	return fieldSizes[n]
+}
+
+// NodeLen returns the length in 4-octet units of the data of a node,
+// excluding the OSS. Every undefined bit adds a 4-octet field.
+func (t TraceType) NodeLen() int {
+	octets := 0
+	for n, size := range fieldSizes {
+		if t&Bit(n) != 0 {
+			octets += size
+		}
+	}
+	for u := t & TraceTypeUndefined; u != 0; u &= u - 1 {
+		octets += 4
+	}
+	return octets / 4
+}
+
+// Maximum values of the fields narrower than their Go type
+const (
+	MaxHopLimit   = 1<<8 - 1
+	MaxNodeID     = 1<<24 - 1
+	MaxNodeIDWide = 1<<56 - 1
+	MaxSchemaID   = 1<<24 - 1
+	MaxNodeLen    = 1<<5 - 1 // In 4-octet units
+	MaxRemLen     = 1<<7 - 1 // In 4-octet units
+)
+
+// Node is the data of a node in a trace option. Only the fields of the
+// trace type are meaningful.
+type Node struct {
+	HopLimit           uint8
+	ID                 uint32 // 24 bits
+	IngressID          uint16
+	EgressID           uint16
+	TimestampSecs      uint32
+	TimestampFrac      uint32
+	TransitDelay       uint32 // The most significant bit is the overflow flag
+	NamespaceData      []byte // 4 octets
+	QueueDepth         uint32
+	ChecksumComplement uint32
+	IDWide             uint64 // 56 bits
+	IngressIDWide      uint32
+	EgressIDWide       uint32
+	NamespaceDataWide  []byte // 8 octets
+	BufferOccupancy    uint32
+	OSS                *OSS // nil if the node has no opaque state snapshot
+
+	// One's complement sum of the node data on the wire, OSS included, set
+	// when decoding a trace type with the Checksum Complement
+	Checksum uint16
+}
+
+// OSS is an Opaque State Snapshot.
+type OSS struct {
+	SchemaID uint32 // 24 bits
+	Data     []byte // Multiple of 4 octets
+}
+
+// Trace is a pre-allocated or incremental trace option.
+type Trace struct {
+	Namespace uint16
+	Flags     Flags
+	RemLen    uint8 // Free space left for the nodes, in 4-octet units
+	Type      TraceType
+	Nodes     []Node // In path order, i.e. the reverse of the order on the wire
+}
+
+// FreeNodes returns the number of nodes that still fit in the remaining
+// length, with an empty opaque state snapshot if the trace type has one.
+func (t *Trace) FreeNodes() int {
+	nodeLen := t.Type.NodeLen()
+	if t.Type&TraceTypeOSS != 0 {
+		nodeLen++
+	}
+	if nodeLen == 0 {
+		return 0
+	}
+	return int(t.RemLen) / nodeLen
+}
@@ -0,0 +1,316 @@
+package ioam
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testNode returns the i-th node of a trace of the given type, with distinct
+// values in the fields of the type only.
+func testNode(i int, traceType TraceType) Node {
+	v := uint32(i+1) * 0x01010101
+	var node Node
+	if traceType&(TraceTypeHopLimitNodeID|TraceTypeHopLimitNodeIDWide) != 0 {
+		node.HopLimit = uint8(64 - i)
+	}
+	if traceType&TraceTypeHopLimitNodeID != 0 {
+		node.ID = v & MaxNodeID
+	}
+	if traceType&TraceTypeInterfaceIDs != 0 {
+		node.IngressID, node.EgressID = uint16(v), uint16(v>>1)
+	}
+	if traceType&TraceTypeTimestampSecs != 0 {
+		node.TimestampSecs = v + 1
+	}
+	if traceType&TraceTypeTimestampFrac != 0 {
+		node.TimestampFrac = v + 2
+	}
+	if traceType&TraceTypeTransitDelay != 0 {
+		node.TransitDelay = v + 3
+	}
+	if traceType&TraceTypeNamespaceData != 0 {
+		node.NamespaceData = []byte{1, 2, 3, byte(i)}
+	}
+	if traceType&TraceTypeQueueDepth != 0 {
+		node.QueueDepth = v + 4
+	}
+	if traceType&TraceTypeChecksumComplement != 0 {
+		node.ChecksumComplement = v + 5
+	}
+	if traceType&TraceTypeHopLimitNodeIDWide != 0 {
+		node.IDWide = uint64(v)<<24 | 0xABCDEF
+	}
+	if traceType&TraceTypeInterfaceIDsWide != 0 {
+		node.IngressIDWide, node.EgressIDWide = v+6, v+7
+	}
+	if traceType&TraceTypeNamespaceDataWide != 0 {
+		node.NamespaceDataWide = []byte{1, 2, 3, 4, 5, 6, 7, byte(i)}
+	}
+	if traceType&TraceTypeBufferOccupancy != 0 {
+		node.BufferOccupancy = v + 8
+	}
+	// Odd nodes have no OSS, encoded as an empty one
+	if traceType&TraceTypeOSS != 0 && i%2 == 0 {
+		node.OSS = &OSS{SchemaID: v & MaxSchemaID, Data: make([]byte, 4*(i+1))}
+	}
+	return node
+}
+
+func TestTraceRoundTrip(t *testing.T) {
+	types := []TraceType{0, TraceTypeDefined, TraceTypeDefined &^ TraceTypeOSS, TraceTypeOSS, Bit(12) | Bit(21) | TraceTypeHopLimitNodeID}
+	for n := 0; n < 12; n++ {
+		types = append(types, Bit(n), Bit(n)|TraceTypeOSS)
+	}
+
+	for _, traceType := range types {
+		trace := &Trace{Namespace: 0xBEEF, Flags: FlagLoopback, RemLen: 3, Type: traceType}
+		if traceType.NodeLen() > 0 || traceType&TraceTypeOSS != 0 {
+			for i := range 3 {
+				trace.Nodes = append(trace.Nodes, testNode(i, traceType))
+			}
+		}
+
+		data, err := AppendTrace(nil, trace)
+		if err != nil {
+			t.Fatalf("type %06x: AppendTrace() error %v", traceType, err)
+		}
+		option, err := AppendOption(nil, IPv6OptionHopByHop, OptionPreallocatedTrace, data)
+		if err != nil {
+			t.Fatalf("type %06x: AppendOption() error %v", traceType, err)
+		}
+		header, err := AppendOptionsHeader(nil, 17, option)
+		if err != nil {
+			t.Fatalf("type %06x: AppendOptionsHeader() error %v", traceType, err)
+		}
+
+		options, err := Options(header)
+		if err != nil || len(options) != 1 || options[0].Type != OptionPreallocatedTrace {
+			t.Fatalf("type %06x: Options() = %v, error %v", traceType, options, err)
+		}
+		got, err := DecodeTrace(options[0].Data)
+		if err != nil {
+			t.Fatalf("type %06x: DecodeTrace() error %v", traceType, err)
+		}
+		for i := range got.Nodes {
+			got.Nodes[i].Checksum = 0 // Computed when decoding
+		}
+		if !reflect.DeepEqual(got, trace) {
+			t.Errorf("type %06x: decoded %+v, want %+v", traceType, got, trace)
+		}
+	}
+}
+
+// FuzzTraceRoundTrip checks that no option makes the decoder panic and that
+// valid options decode the same once encoded again.
+func FuzzTraceRoundTrip(f *testing.F) {
+	for _, traceType := range []TraceType{0xf6e002, TraceTypeDefined, TraceTypeUndefined | TraceTypeHopLimitNodeID} {
+		trace := &Trace{Namespace: 1, RemLen: 2, Type: traceType}
+		for i := range 3 {
+			trace.Nodes = append(trace.Nodes, testNode(i, traceType))
+		}
+		data, err := AppendTrace(nil, trace)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeTraceLenient(data)
+		trace, err := DecodeTrace(data)
+		if err != nil {
+			return
+		}
+		encoded, err := AppendTrace(nil, trace)
+		if err != nil {
+			t.Fatalf("AppendTrace() error %v", err)
+		}
+		again, err := DecodeTrace(encoded)
+		if err != nil {
+			t.Fatalf("encoded option is invalid: %v", err)
+		}
+		// The undefined fields are encoded again as 0xFF, which changes the
+		// checksums
+		for _, tr := range []*Trace{trace, again} {
+			for i := range tr.Nodes {
+				tr.Nodes[i].Checksum = 0
+			}
+		}
+		if !reflect.DeepEqual(again, trace) {
+			t.Errorf("decoded again as %+v, want %+v", again, trace)
+		}
+	})
+}
+
+func TestDecodeTraceReuse(t *testing.T) {
+	traceType := TraceTypeHopLimitNodeID | TraceTypeOSS
+	trace := &Trace{Type: traceType, Nodes: []Node{testNode(0, traceType), testNode(1, traceType), testNode(2, traceType)}}
+	data, err := AppendTrace(nil, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Trace
+	for range 2 {
+		if err := decoded.Decode(data, false); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&decoded, trace) {
+			t.Fatalf("decoded %+v, want %+v", &decoded, trace)
+		}
+	}
+}
+
+func TestDecodeTraceErrors(t *testing.T) {
+	traceType := TraceTypeHopLimitNodeID | TraceTypeQueueDepth
+	trace := &Trace{Namespace: 1, RemLen: 2, Type: traceType, Nodes: []Node{testNode(0, traceType), testNode(1, traceType)}}
+	valid, err := AppendTrace(nil, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		err     error
+		salvage int // Nodes salvaged in lenient mode, -1 if the header is invalid
+	}{
+		{"short", valid[:4], ErrOptionLength, -1},
+		{"remaining length", modify(func(b []byte) []byte { b[3] = 0x7F; return b }), ErrRemainingLength, -1},
+		{"node length", modify(func(b []byte) []byte { b[2] = 1 << 3; return b }), ErrNodeLength, 0},
+		{"larger node length", modify(func(b []byte) []byte { b[2] = 3 << 3; return b }), ErrNodeLength, 1},
+		{"node data", modify(func(b []byte) []byte { return append(b, 0, 0, 0, 0) }), ErrNodeData, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeTrace(tt.data)
+			var decodeErr *DecodeError
+			if !errors.Is(err, tt.err) || !errors.As(err, &decodeErr) {
+				t.Fatalf("DecodeTrace() error %v, want %v", err, tt.err)
+			}
+
+			salvaged, err := DecodeTraceLenient(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("DecodeTraceLenient() error %v, want %v", err, tt.err)
+			}
+			if tt.salvage < 0 {
+				if salvaged != nil {
+					t.Errorf("DecodeTraceLenient() = %+v, want nil", salvaged)
+				}
+			} else if salvaged == nil || len(salvaged.Nodes) != tt.salvage {
+				t.Errorf("DecodeTraceLenient() = %+v, want %d nodes", salvaged, tt.salvage)
+			}
+		})
+	}
+}
+
+func TestNodeLen(t *testing.T) {
+	tests := []struct {
+		traceType TraceType
+		nodeLen   int
+		freeNodes int // With a remaining length of 12
+	}{
+		{0, 0, 0},
+		{TraceTypeHopLimitNodeID, 1, 12},
+		{TraceTypeHopLimitNodeIDWide | TraceTypeInterfaceIDsWide | TraceTypeNamespaceDataWide, 6, 2},
+		{TraceTypeDefined &^ TraceTypeOSS, 15, 0},
+		{TraceTypeHopLimitNodeID | Bit(12) | Bit(21), 3, 4},
+		{TraceTypeHopLimitNodeID | TraceTypeOSS, 1, 6},
+		{TraceTypeOSS, 0, 12},
+	}
+	for _, tt := range tests {
+		if got := tt.traceType.NodeLen(); got != tt.nodeLen {
+			t.Errorf("type %06x: NodeLen() = %d, want %d", tt.traceType, got, tt.nodeLen)
+		}
+		trace := Trace{Type: tt.traceType, RemLen: 12}
+		if got := trace.FreeNodes(); got != tt.freeNodes {
+			t.Errorf("type %06x: FreeNodes() = %d, want %d", tt.traceType, got, tt.freeNodes)
+		}
+	}
+}
+
+func TestE2ERoundTrip(t *testing.T) {
+	for _, e2eType := range []E2EType{0, E2ESequence64, E2ESequence32 | E2ETimestampSecs, E2ESequence64 | E2ESequence32 | E2ETimestampSecs | E2ETimestampFrac} {
+		e2e := &E2E{Namespace: 7, Type: e2eType}
+		if e2eType&E2ESequence64 != 0 {
+			e2e.Sequence64 = 1 << 40
+		}
+		if e2eType&E2ESequence32 != 0 {
+			e2e.Sequence32 = 2
+		}
+		if e2eType&E2ETimestampSecs != 0 {
+			e2e.TimestampSecs = 3
+		}
+		if e2eType&E2ETimestampFrac != 0 {
+			e2e.TimestampFrac = 4
+		}
+
+		data := AppendE2E(nil, e2e)
+		got, err := DecodeE2E(data)
+		if err != nil || !reflect.DeepEqual(got, e2e) {
+			t.Errorf("type %04x: DecodeE2E() = %+v, error %v, want %+v", e2eType, got, err, e2e)
+		}
+		if e2eType != 0 {
+			if _, err := DecodeE2E(data[:len(data)-1]); !errors.Is(err, ErrOptionLength) {
+				t.Errorf("type %04x: DecodeE2E() of truncated data error %v", e2eType, err)
+			}
+		}
+	}
+}
+
+func TestDEXRoundTrip(t *testing.T) {
+	for _, flags := range []uint8{0, DEXFlowID, DEXSequence, DEXFlowID | DEXSequence} {
+		dex := &DEX{Namespace: 7, Flags: 0x80, ExtensionFlags: flags, Type: TraceTypeHopLimitNodeID | TraceTypeOSS}
+		if flags&DEXFlowID != 0 {
+			dex.FlowID = 0xCAFE
+		}
+		if flags&DEXSequence != 0 {
+			dex.Sequence = 42
+		}
+
+		data := AppendDEX(nil, dex)
+		got, err := DecodeDEX(data)
+		if err != nil || !reflect.DeepEqual(got, dex) {
+			t.Errorf("flags %02x: DecodeDEX() = %+v, error %v, want %+v", flags, got, err, dex)
+		}
+		if flags != 0 {
+			if _, err := DecodeDEX(data[:len(data)-4]); !errors.Is(err, ErrOptionLength) {
+				t.Errorf("flags %02x: DecodeDEX() of truncated data error %v", flags, err)
+			}
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	trace, err := AppendTrace(nil, &Trace{Type: TraceTypeHopLimitNodeID, RemLen: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt1, _ := AppendOption(nil, IPv6OptionHopByHop, OptionPreallocatedTrace, trace)
+	opt2, _ := AppendOption(nil, IPv6OptionHopByHop, OptionE2E, AppendE2E(nil, &E2E{Type: E2ESequence32, Sequence32: 1}))
+	other := []byte{0x3E, 2, 0, 0} // Not an IOAM option
+	truncated := []byte{0x3E, 0xFF}
+	header, err := AppendOptionsHeader(nil, 17, opt1, other, opt2, truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header)%8 != 0 {
+		t.Fatalf("header of %d octets", len(header))
+	}
+
+	// Options found before a malformed one are returned
+	options, err := Options(header)
+	if !errors.Is(err, ErrOptionLength) || len(options) != 2 || options[0].Type != OptionPreallocatedTrace || options[1].Type != OptionE2E {
+		t.Fatalf("Options() = %v, error %v", options, err)
+	}
+	if e2e, err := DecodeE2E(options[1].Data); err != nil || e2e.Sequence32 != 1 {
+		t.Errorf("DecodeE2E() = %+v, error %v", e2e, err)
+	}
+	if _, err := Options(header[:7]); !errors.Is(err, ErrHeaderLength) {
+		t.Errorf("Options() of a short header error %v", err)
+	}
+}
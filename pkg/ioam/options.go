@@ -0,0 +1,191 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// E2EType is the 16-bit IOAM-E2E-Type of an edge-to-edge option.
+type E2EType uint16
+
+// E2E type bits (RFC 9197 section 4.6)
+const (
+	E2ESequence64    E2EType = 1 << (15 - iota) // Bit 0, 64-bit sequence number
+	E2ESequence32                               // Bit 1, 32-bit sequence number
+	E2ETimestampSecs                            // Bit 2
+	E2ETimestampFrac                            // Bit 3
+)
+
+// E2E is an edge-to-edge option.
+type E2E struct {
+	Namespace     uint16
+	Type          E2EType
+	Sequence64    uint64
+	Sequence32    uint32
+	TimestampSecs uint32
+	TimestampFrac uint32
+}
+
+// AppendE2E appends the data of an edge-to-edge option.
+func AppendE2E(b []byte, e2e *E2E) []byte {
+	b = binary.BigEndian.AppendUint16(b, e2e.Namespace)
+	b = binary.BigEndian.AppendUint16(b, uint16(e2e.Type))
+	if e2e.Type&E2ESequence64 != 0 {
+		b = binary.BigEndian.AppendUint64(b, e2e.Sequence64)
+	}
+	if e2e.Type&E2ESequence32 != 0 {
+		b = binary.BigEndian.AppendUint32(b, e2e.Sequence32)
+	}
+	if e2e.Type&E2ETimestampSecs != 0 {
+		b = binary.BigEndian.AppendUint32(b, e2e.TimestampSecs)
+	}
+	if e2e.Type&E2ETimestampFrac != 0 {
+		b = binary.BigEndian.AppendUint32(b, e2e.TimestampFrac)
+	}
+	return b
+}
+
+// DecodeE2E decodes the data of an edge-to-edge option.
+func DecodeE2E(data []byte) (*E2E, error) {
+	if len(data) < 4 {
+		return nil, decodeError(ErrOptionLength, 0)
+	}
+	e2e := &E2E{
+		Namespace: binary.BigEndian.Uint16(data[:2]),
+		Type:      E2EType(binary.BigEndian.Uint16(data[2:4])),
+	}
+	offset := 4
+
+	field := func(size int) ([]byte, error) {
+		if len(data)-offset < size {
+			return nil, decodeError(ErrOptionLength, offset)
+		}
+		f := data[offset : offset+size]
+		offset += size
+		return f, nil
+	}
+	if e2e.Type&E2ESequence64 != 0 {
+		f, err := field(8)
+		if err != nil {
+			return nil, err
+		}
+		e2e.Sequence64 = binary.BigEndian.Uint64(f)
+	}
+	if e2e.Type&E2ESequence32 != 0 {
+		f, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		e2e.Sequence32 = binary.BigEndian.Uint32(f)
+	}
+	if e2e.Type&E2ETimestampSecs != 0 {
+		f, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		e2e.TimestampSecs = binary.BigEndian.Uint32(f)
+	}
+	if e2e.Type&E2ETimestampFrac != 0 {
+		f, err := field(4)
+		if err != nil {
+			return nil, err
+		}
+		e2e.TimestampFrac = binary.BigEndian.Uint32(f)
+	}
+
+	return e2e, nil
+}
+
+// DEX extension flags (RFC 9326 section 3.2)
+const (
+	DEXFlowID   = 1 << 7 // Flow ID field present
+	DEXSequence = 1 << 6 // Sequence Number field present
+)
+
+// DEX is a direct export option.
+type DEX struct {
+	Namespace      uint16
+	Flags          uint8
+	ExtensionFlags uint8
+	Type           TraceType
+	FlowID         uint32 // If ExtensionFlags has DEXFlowID
+	Sequence       uint32 // If ExtensionFlags has DEXSequence
+}
+
+// AppendDEX appends the data of a direct export option.
+func AppendDEX(b []byte, dex *DEX) []byte {
+	b = binary.BigEndian.AppendUint16(b, dex.Namespace)
+	b = append(b, dex.Flags, dex.ExtensionFlags)
+	b = binary.BigEndian.AppendUint32(b, uint32(dex.Type&0xFFFFFF)<<8)
+	if dex.ExtensionFlags&DEXFlowID != 0 {
+		b = binary.BigEndian.AppendUint32(b, dex.FlowID)
+	}
+	if dex.ExtensionFlags&DEXSequence != 0 {
+		b = binary.BigEndian.AppendUint32(b, dex.Sequence)
+	}
+	return b
+}
+
+// DecodeDEX decodes the data of a direct export option.
+func DecodeDEX(data []byte) (*DEX, error) {
+	if len(data) < 8 {
+		return nil, decodeError(ErrOptionLength, 0)
+	}
+	dex := &DEX{
+		Namespace:      binary.BigEndian.Uint16(data[:2]),
+		Flags:          data[2],
+		ExtensionFlags: data[3],
+		Type:           TraceType(binary.BigEndian.Uint32(data[4:8]) >> 8),
+	}
+	offset := 8
+	if dex.ExtensionFlags&DEXFlowID != 0 {
+		if len(data) < offset+4 {
+			return nil, decodeError(ErrOptionLength, offset)
+		}
+		dex.FlowID = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if dex.ExtensionFlags&DEXSequence != 0 {
+		if len(data) < offset+4 {
+			return nil, decodeError(ErrOptionLength, offset)
+		}
+		dex.Sequence = binary.BigEndian.Uint32(data[offset : offset+4])
+	}
+	return dex, nil
+}
+
+// AppendOptionsHeader appends an IPv6 Hop-by-Hop or Destination Options
+// header holding the given options (as built by AppendOption). Every
+// option is preceded by padding so that its data starts on a 4-octet
+// boundary, as done by Linux, and the header is padded to a multiple of 8
+// octets.
+func AppendOptionsHeader(b []byte, nextHeader uint8, options ...[]byte) ([]byte, error) {
+	start := len(b)
+	b = append(b, nextHeader, 0)
+
+	for _, opt := range options {
+		if pad := (4 - (len(b)-start)%4) % 4; pad > 0 {
+			b = appendPadding(b, pad)
+		}
+		b = append(b, opt...)
+	}
+	if pad := (8 - (len(b)-start)%8) % 8; pad > 0 {
+		b = appendPadding(b, pad)
+	}
+
+	hdrLen := (len(b)-start)/8 - 1
+	if hdrLen > 0xFF {
+		return nil, errors.New("ioam: extension header too long")
+	}
+	b[start+1] = uint8(hdrLen)
+	return b, nil
+}
+
+// appendPadding appends a Pad1 option (n = 1) or a PadN option of n octets.
+func appendPadding(b []byte, n int) []byte {
+	if n == 1 {
+		return append(b, 0)
+	}
+	b = append(b, 1, uint8(n-2))
+	return append(b, make([]byte, n-2)...)
+}